@@ -0,0 +1,515 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"salestrekker_technical_interview.veljkoilic/internal/data"
+	"salestrekker_technical_interview.veljkoilic/internal/validator"
+	"salestrekker_technical_interview.veljkoilic/internal/vcard"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// The CardDAV server has a single principal with a single address book holding every contact.
+// Cards created by clients keep the name the client PUT them to, like /dav/addressbooks/contacts/0b6e2f.vcf.
+// The cards of all other contacts are named after their id, like /dav/addressbooks/contacts/42.vcf.
+const (
+	davRoot        = "/dav/"
+	davHome        = "/dav/addressbooks/"
+	davAddressBook = "/dav/addressbooks/contacts/"
+)
+
+// Largest vCard a client can PUT
+const maxCardBytes = 100 << 10
+
+// Methods every CardDAV resource allows, and the WebDAV features the server supports
+const (
+	davAllow      = "OPTIONS, GET, HEAD, PUT, DELETE, PROPFIND, REPORT"
+	davCompliance = "1, 3, addressbook"
+)
+
+// davProperty is a property the server computes for a resource. value returns the property as XML,
+// given the element the client asked for it with. Properties without allprop are only sent
+// when the client names them.
+type davProperty struct {
+	name    xml.Name
+	allprop bool
+	value   func(req *xmlElement) (string, error)
+}
+
+// Property with a value which does not depend on the request
+func staticProperty(space, local, value string) davProperty {
+	return davProperty{
+		name:    xml.Name{Space: space, Local: local},
+		allprop: true,
+		value:   func(*xmlElement) (string, error) { return value, nil },
+	}
+}
+
+// Return the href of a contact's card: the name the client created it under, or one made of the contact's id
+func cardHref(id int64, cardName string) string {
+	if cardName != "" {
+		return davAddressBook + url.PathEscape(cardName)
+	}
+	return fmt.Sprintf("%s%d.vcf", davAddressBook, id)
+}
+
+// Return the id of the contact a card name like 42.vcf belongs to
+func parseCardName(name string) (int64, bool) {
+	idText, ok := strings.CutSuffix(name, ".vcf")
+	id, err := strconv.ParseInt(idText, 10, 64)
+	return id, ok && err == nil && id > 0
+}
+
+// Longest card name a client can create a card under
+const maxCardNameBytes = 255
+
+// Report whether a client can create a card under the name. Names made of a number are
+// kept for the cards named after the contacts' ids.
+func validCardName(name string) bool {
+	if _, ok := parseCardName(name); ok {
+		return false
+	}
+	return name != "" && len(name) <= maxCardNameBytes && utf8.ValidString(name) &&
+		!strings.ContainsFunc(name, func(r rune) bool { return unicode.IsControl(r) || r == '/' })
+}
+
+// Return the contact whose card has the name, or ErrRecordNotFound
+func findCard(cm *data.ContactsModel, name string) (*data.Contact, error) {
+	id, ok := parseCardName(name)
+	if !ok {
+		return cm.GetContactByCardName(name)
+	}
+
+	contact, err := cm.GetContact(id)
+	if err != nil {
+		return nil, err
+	}
+	// a card created by a client is only served under the name it was created with
+	if contact.CardName != "" {
+		return nil, data.ErrRecordNotFound
+	}
+	return contact, nil
+}
+
+// Answer OPTIONS with the methods and WebDAV features of the CardDAV resources
+func (app *application) davOptionsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Allow", davAllow)
+	w.Header().Set("DAV", davCompliance)
+	w.WriteHeader(http.StatusOK)
+}
+
+// Send clients looking for the CardDAV server to its root, as RFC 6764 describes
+func (app *application) davWellKnownHandler(w http.ResponseWriter, r *http.Request) {
+	http.Redirect(w, r, davRoot, http.StatusMovedPermanently)
+}
+
+// Properties every collection has
+func (app *application) collectionProperties(displayName, resourceType string) []davProperty {
+	return []davProperty{
+		staticProperty(nsDAV, "resourcetype", resourceType),
+		staticProperty(nsDAV, "displayname", escapeXML(displayName)),
+		staticProperty(nsDAV, "current-user-principal", "<d:href>"+davRoot+"</d:href>"),
+		staticProperty(nsDAV, "current-user-privilege-set",
+			"<d:privilege><d:read/></d:privilege><d:privilege><d:write/></d:privilege>"+
+				"<d:privilege><d:bind/></d:privilege><d:privilege><d:unbind/></d:privilege>"),
+	}
+}
+
+// Properties of the principal at the root, which lead the clients to the address books
+func (app *application) rootProperties() []davProperty {
+	return append(app.collectionProperties("Contacts server", "<d:collection/><d:principal/>"),
+		staticProperty(nsDAV, "principal-URL", "<d:href>"+davRoot+"</d:href>"),
+		staticProperty(nsCardDAV, "addressbook-home-set", "<d:href>"+davHome+"</d:href>"),
+	)
+}
+
+// Properties of the collection holding the address books
+func (app *application) homeProperties() []davProperty {
+	return append(app.collectionProperties("Address books", "<d:collection/>"),
+		staticProperty(nsCardDAV, "addressbook-home-set", "<d:href>"+davHome+"</d:href>"),
+	)
+}
+
+// Properties of the address book of the contacts
+func (app *application) addressBookProperties(contacts *data.ContactsModel) []davProperty {
+	return append(app.collectionProperties("Contacts", "<d:collection/><card:addressbook/>"),
+		staticProperty(nsCardDAV, "addressbook-description", "Every contact of the address book"),
+		staticProperty(nsCardDAV, "supported-address-data",
+			`<card:address-data-type content-type="text/vcard" version="3.0"/>`+
+				`<card:address-data-type content-type="text/vcard" version="4.0"/>`),
+		staticProperty(nsCardDAV, "max-resource-size", strconv.Itoa(maxCardBytes)),
+		staticProperty(nsDAV, "supported-report-set",
+			"<d:supported-report><d:report><card:addressbook-query/></d:report></d:supported-report>"+
+				"<d:supported-report><d:report><card:addressbook-multiget/></d:report></d:supported-report>"+
+				"<d:supported-report><d:report><d:sync-collection/></d:report></d:supported-report>"),
+		davProperty{
+			name:    xml.Name{Space: nsCalendarServer, Local: "getctag"},
+			allprop: true,
+			value: func(*xmlElement) (string, error) {
+				tag, err := contacts.CollectionTag()
+				return escapeXML(tag), err
+			},
+		},
+		davProperty{
+			name:    xml.Name{Space: nsDAV, Local: "sync-token"},
+			allprop: true,
+			value: func(*xmlElement) (string, error) {
+				return escapeXML(contacts.SyncToken()), nil
+			},
+		},
+	)
+}
+
+// Properties of a contact's card. The card itself is only sent when the client asks for address-data,
+// in the version the client names, or 3.0.
+func (app *application) cardProperties(contact *data.Contact) []davProperty {
+	return []davProperty{
+		staticProperty(nsDAV, "resourcetype", ""),
+		staticProperty(nsDAV, "getetag", escapeXML(contactETag(contact))),
+		staticProperty(nsDAV, "getcontenttype", vcard.MediaType+"; charset=utf-8"),
+		{
+			name: xml.Name{Space: nsCardDAV, Local: "address-data"},
+			value: func(req *xmlElement) (string, error) {
+				version := vcard.Version3
+				if req != nil && req.attr("version") == vcard.Version4 {
+					version = vcard.Version4
+				}
+
+				var b strings.Builder
+				err := vcard.NewEncoder(&b).Encode(data.ContactVCard(contact, version))
+				return escapeXML(b.String()), err
+			},
+		},
+	}
+}
+
+// Build the response about a single resource. With no prop the properties sent with allprop are
+// returned, and with names only the property names are.
+func propertiesResponse(href string, properties []davProperty, prop *propNames, namesOnly bool) (davResponse, error) {
+	response := davResponse{href: href}
+
+	if prop == nil {
+		for _, property := range properties {
+			if namesOnly {
+				response.found = append(response.found, davProp{name: property.name})
+				continue
+			}
+			if !property.allprop {
+				continue
+			}
+
+			value, err := property.value(nil)
+			if err != nil {
+				return response, err
+			}
+			response.found = append(response.found, davProp{name: property.name, value: value})
+		}
+		return response, nil
+	}
+
+	for _, req := range prop.Names {
+		i := slices.IndexFunc(properties, func(p davProperty) bool { return p.name == req.XMLName })
+		if i == -1 {
+			response.missing = append(response.missing, req.XMLName)
+			continue
+		}
+
+		value, err := properties[i].value(&req)
+		if err != nil {
+			return response, err
+		}
+		response.found = append(response.found, davProp{name: req.XMLName, value: value})
+	}
+	return response, nil
+}
+
+// Handler for PROPFIND on the collections. With Depth 1 the members of the collection are
+// included, Depth infinity is served as Depth 1.
+func (app *application) davPropfindHandler(w http.ResponseWriter, r *http.Request) {
+	var input propfindRequest
+
+	_, err := readXML(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	type resource struct {
+		href       string
+		properties []davProperty
+	}
+
+	var resources []resource
+	switch r.URL.Path {
+	case davRoot:
+		resources = append(resources, resource{davRoot, app.rootProperties()})
+		if r.Header.Get("Depth") != "0" {
+			resources = append(resources, resource{davHome, app.homeProperties()})
+		}
+	case davHome:
+		resources = append(resources, resource{davHome, app.homeProperties()})
+		if r.Header.Get("Depth") != "0" {
+			resources = append(resources, resource{davAddressBook, app.addressBookProperties(app.contacts(r))})
+		}
+	case davAddressBook:
+		resources = append(resources, resource{davAddressBook, app.addressBookProperties(app.contacts(r))})
+		if r.Header.Get("Depth") != "0" {
+			contacts, err := app.contacts(r).ListContacts()
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+			for i := range contacts {
+				resources = append(resources, resource{cardHref(contacts[i].ID, contacts[i].CardName), app.cardProperties(&contacts[i])})
+			}
+		}
+	default:
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var ms multistatus
+	for _, res := range resources {
+		response, err := propertiesResponse(res.href, res.properties, input.Prop, input.PropName != nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		ms.responses = append(ms.responses, response)
+	}
+
+	ms.write(w)
+}
+
+// Fetch the contact the card in the path belongs to. If it can not be fetched the error response
+// is sent and false is returned.
+func (app *application) readCard(w http.ResponseWriter, r *http.Request) (*data.Contact, bool) {
+	contact, err := findCard(app.contacts(r), httprouter.ParamsFromContext(r.Context()).ByName("card"))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return contact, true
+}
+
+// Handler for PROPFIND on a card
+func (app *application) davPropfindCardHandler(w http.ResponseWriter, r *http.Request) {
+	contact, ok := app.readCard(w, r)
+	if !ok {
+		return
+	}
+
+	var input propfindRequest
+
+	_, err := readXML(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	response, err := propertiesResponse(cardHref(contact.ID, contact.CardName), app.cardProperties(contact), input.Prop, input.PropName != nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	ms := multistatus{responses: []davResponse{response}}
+	ms.write(w)
+}
+
+// Send the card of a contact. Cards are vCard 3.0 unless the client asks for 4.0 in Accept.
+func (app *application) davGetCardHandler(w http.ResponseWriter, r *http.Request) {
+	contact, ok := app.readCard(w, r)
+	if !ok {
+		return
+	}
+
+	etag := contactETag(contact)
+	w.Header().Set("ETag", etag)
+	w.Header().Add("Vary", "Accept")
+
+	if match := r.Header.Get("If-None-Match"); match != "" && etagMatches(match, etag, true) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	version := vcard.Version3
+	if _, params := negotiateContentType(r, vcard.MediaType); params["version"] == vcard.Version4 {
+		version = vcard.Version4
+	}
+
+	app.writeVCards(w, r, version, contact)
+}
+
+// Handler for storing a card. A card PUT to the name of an existing contact replaces its fields,
+// any other name creates a new contact whose card keeps the name, as clients expect to find it
+// where they put it.
+func (app *application) davPutCardHandler(w http.ResponseWriter, r *http.Request) {
+	if !isVCardRequest(r) {
+		app.davErrorResponse(w, http.StatusForbidden, xml.Name{Space: nsCardDAV, Local: "supported-address-data"}, "cards must be sent as text/vcard")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxCardBytes)
+
+	dec := vcard.NewDecoder(r.Body)
+	card, err := dec.Decode()
+	if err == nil {
+		// the body has to hold exactly one card
+		if _, err = dec.Decode(); err == nil {
+			err = errors.New("body must only contain a single card")
+		} else if errors.Is(err, io.EOF) {
+			err = nil
+		}
+	}
+
+	var maxBytesError *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytesError):
+		app.davErrorResponse(w, http.StatusForbidden, xml.Name{Space: nsCardDAV, Local: "max-resource-size"}, "")
+		return
+	case errors.Is(err, io.EOF):
+		app.davErrorResponse(w, http.StatusForbidden, xml.Name{Space: nsCardDAV, Local: "valid-address-data"}, "body must contain a card")
+		return
+	case err != nil:
+		app.davErrorResponse(w, http.StatusForbidden, xml.Name{Space: nsCardDAV, Local: "valid-address-data"}, err.Error())
+		return
+	}
+
+	// a name which is not the card of an existing contact creates a new one
+	name := httprouter.ParamsFromContext(r.Context()).ByName("card")
+	contact, err := findCard(app.contacts(r), name)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	match, noneMatch := r.Header.Get("If-Match"), r.Header.Get("If-None-Match")
+	switch {
+	case contact == nil && match != "",
+		contact != nil && noneMatch != "" && etagMatches(noneMatch, contactETag(contact), false),
+		contact != nil && match != "" && !etagMatches(match, contactETag(contact), false):
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+
+	created := contact == nil
+	if created {
+		if !validCardName(name) {
+			app.cardNameConflictResponse(w, r)
+			return
+		}
+		contact = &data.Contact{CardName: name}
+	}
+
+	fields, err := app.fieldsModel.ListFields()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	// the card carries no custom values, so the required custom fields are not enforced, see data.OptionalFields
+	if data.ReplaceFromVCard(v, contact, card); v.IsValid() {
+		data.ValidateContact(v, contact, data.OptionalFields(fields))
+	}
+	if !v.IsValid() {
+		app.davErrorResponse(w, http.StatusForbidden, xml.Name{Space: nsCardDAV, Local: "valid-address-data"}, validationDescription(v.Errors))
+		return
+	}
+
+	if created {
+		err = app.contacts(r).InsertContact(contact)
+	} else {
+		err = app.contacts(r).UpdateContact(contact)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateContact):
+			app.davErrorResponse(w, http.StatusForbidden, xml.Name{Space: nsCardDAV, Local: "no-uid-conflict"}, err.Error())
+		case errors.Is(err, data.ErrEditConflict), errors.Is(err, data.ErrRecordNotFound):
+			app.preconditionFailedResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// The stored card differs from the one sent, as the numbers are normalized,
+	// so no ETag is sent and the client fetches the card again
+	if created {
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Handler for deleting a card, together with its contact
+func (app *application) davDeleteCardHandler(w http.ResponseWriter, r *http.Request) {
+	contact, ok := app.readCard(w, r)
+	if !ok {
+		return
+	}
+
+	version := data.AnyVersion
+	if match := r.Header.Get("If-Match"); match != "" {
+		if !etagMatches(match, contactETag(contact), false) {
+			app.preconditionFailedResponse(w, r)
+			return
+		}
+		version = contact.Version
+	}
+
+	err := app.contacts(r).DeleteContactVersion(contact.ID, version)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.preconditionFailedResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Describe validation errors in a single line, for the WebDAV error responses which have no place for them
+func validationDescription(errors map[string]string) string {
+	keys := slices.Sorted(maps.Keys(errors))
+
+	descriptions := make([]string, len(keys))
+	for i, key := range keys {
+		descriptions[i] = key + " " + errors[key]
+	}
+	return strings.Join(descriptions, "; ")
+}
+
+// Return the name of the card the href points to. Hrefs may be full URLs.
+func cardNameFromHref(href string) (string, bool) {
+	u, err := url.Parse(strings.TrimSpace(href))
+	if err != nil {
+		return "", false
+	}
+
+	name, ok := strings.CutPrefix(u.Path, davAddressBook)
+	return name, ok && name != "" && !strings.Contains(name, "/")
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"salestrekker_technical_interview.veljkoilic/internal/data"
+	"salestrekker_technical_interview.veljkoilic/internal/vcard"
+	"slices"
+	"strings"
+)
+
+// Body of a REPORT request. XMLName tells which report it is, the other fields belong to
+// addressbook-multiget (Hrefs), addressbook-query (Filter and Limit) or sync-collection (SyncToken).
+type reportRequest struct {
+	XMLName xml.Name
+	Prop    *propNames  `xml:"DAV: prop"`
+	Hrefs   []string    `xml:"DAV: href"`
+	Filter  *cardFilter `xml:"urn:ietf:params:xml:ns:carddav filter"`
+	Limit   *struct {
+		NResults int `xml:"urn:ietf:params:xml:ns:carddav nresults"`
+	} `xml:"urn:ietf:params:xml:ns:carddav limit"`
+	SyncToken string `xml:"DAV: sync-token"`
+}
+
+// cardFilter selects the cards of an addressbook-query, as described in RFC 6352 section 10.5
+type cardFilter struct {
+	Test        string       `xml:"test,attr"`
+	PropFilters []propFilter `xml:"urn:ietf:params:xml:ns:carddav prop-filter"`
+}
+
+type propFilter struct {
+	Name         string        `xml:"name,attr"`
+	Test         string        `xml:"test,attr"`
+	IsNotDefined *struct{}     `xml:"urn:ietf:params:xml:ns:carddav is-not-defined"`
+	TextMatches  []textMatch   `xml:"urn:ietf:params:xml:ns:carddav text-match"`
+	ParamFilters []paramFilter `xml:"urn:ietf:params:xml:ns:carddav param-filter"`
+}
+
+type paramFilter struct {
+	Name         string     `xml:"name,attr"`
+	IsNotDefined *struct{}  `xml:"urn:ietf:params:xml:ns:carddav is-not-defined"`
+	TextMatch    *textMatch `xml:"urn:ietf:params:xml:ns:carddav text-match"`
+}
+
+type textMatch struct {
+	Collation string `xml:"collation,attr"`
+	MatchType string `xml:"match-type,attr"`
+	Negate    string `xml:"negate-condition,attr"`
+	Text      string `xml:",chardata"`
+}
+
+// Collations text-match supports. The case-insensitive ones are the default.
+var supportedCollations = []string{"", "i;unicode-casemap", "i;ascii-casemap", "i;octet"}
+
+// Report whether every text-match of the filter uses a supported collation
+func (f *cardFilter) valid() bool {
+	valid := func(tm *textMatch) bool {
+		return tm == nil || slices.Contains(supportedCollations, tm.Collation)
+	}
+
+	for _, pf := range f.PropFilters {
+		for i := range pf.TextMatches {
+			if !valid(&pf.TextMatches[i]) {
+				return false
+			}
+		}
+		for _, prf := range pf.ParamFilters {
+			if !valid(prf.TextMatch) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Report whether the card passes the filter. A filter without prop-filters passes every card.
+func (f *cardFilter) matches(card *vcard.Card) bool {
+	if len(f.PropFilters) == 0 {
+		return true
+	}
+
+	return combine(f.Test, len(f.PropFilters), func(i int) bool {
+		return f.PropFilters[i].matches(card)
+	})
+}
+
+func (pf *propFilter) matches(card *vcard.Card) bool {
+	properties := card.All(pf.Name)
+
+	if pf.IsNotDefined != nil {
+		return len(properties) == 0
+	}
+	if len(properties) == 0 {
+		return false
+	}
+
+	tests := len(pf.TextMatches) + len(pf.ParamFilters)
+	if tests == 0 {
+		return true
+	}
+
+	// every test passes when any instance of the property passes it
+	return combine(pf.Test, tests, func(i int) bool {
+		for j := range properties {
+			if i < len(pf.TextMatches) && pf.TextMatches[i].matches(properties[j].Text()) {
+				return true
+			}
+			if i >= len(pf.TextMatches) && pf.ParamFilters[i-len(pf.TextMatches)].matches(&properties[j]) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func (prf *paramFilter) matches(property *vcard.Property) bool {
+	values := property.Param(prf.Name)
+
+	if prf.IsNotDefined != nil {
+		return len(values) == 0
+	}
+	if len(values) == 0 {
+		return false
+	}
+	if prf.TextMatch == nil {
+		return true
+	}
+
+	for _, value := range values {
+		if prf.TextMatch.matches(value) {
+			return true
+		}
+	}
+	return false
+}
+
+func (tm *textMatch) matches(value string) bool {
+	text := tm.Text
+	if tm.Collation != "i;octet" {
+		value, text = strings.ToLower(value), strings.ToLower(text)
+	}
+
+	var matched bool
+	switch tm.MatchType {
+	case "equals":
+		matched = value == text
+	case "starts-with":
+		matched = strings.HasPrefix(value, text)
+	case "ends-with":
+		matched = strings.HasSuffix(value, text)
+	default:
+		matched = strings.Contains(value, text)
+	}
+
+	if tm.Negate == "yes" {
+		return !matched
+	}
+	return matched
+}
+
+// Combine n tests as test says, anyof or allof. anyof is the default.
+func combine(test string, n int, passes func(i int) bool) bool {
+	for i := range n {
+		switch passed := passes(i); {
+		case test == "allof" && !passed:
+			return false
+		case test != "allof" && passed:
+			return true
+		}
+	}
+	return test == "allof"
+}
+
+// Handler for REPORT on the address book. It serves addressbook-multiget, addressbook-query
+// and sync-collection. Without a prop, the reports return the ETags of the cards.
+func (app *application) davReportHandler(w http.ResponseWriter, r *http.Request) {
+	var input reportRequest
+
+	ok, err := readXML(w, r, &input)
+	if err != nil || !ok {
+		if err == nil {
+			err = errors.New("body must not be empty")
+		}
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Prop == nil {
+		input.Prop = &propNames{Names: []xmlElement{{XMLName: xml.Name{Space: nsDAV, Local: "getetag"}}}}
+	}
+
+	contacts := app.contacts(r)
+
+	var ms multistatus
+	switch input.XMLName {
+	case xml.Name{Space: nsCardDAV, Local: "addressbook-multiget"}:
+		err = app.multigetReport(contacts, &ms, &input)
+	case xml.Name{Space: nsCardDAV, Local: "addressbook-query"}:
+		if input.Filter != nil && !input.Filter.valid() {
+			app.davErrorResponse(w, http.StatusForbidden, xml.Name{Space: nsCardDAV, Local: "supported-collation"}, "")
+			return
+		}
+		err = app.queryReport(contacts, &ms, &input)
+	case xml.Name{Space: nsDAV, Local: "sync-collection"}:
+		err = app.syncReport(contacts, &ms, &input)
+		if errors.Is(err, data.ErrInvalidSyncToken) {
+			app.davErrorResponse(w, http.StatusForbidden, xml.Name{Space: nsDAV, Local: "valid-sync-token"}, "")
+			return
+		}
+	default:
+		app.davErrorResponse(w, http.StatusForbidden, xml.Name{Space: nsDAV, Local: "supported-report"}, "")
+		return
+	}
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	ms.write(w)
+}
+
+// Add the response about the contact's card to the multistatus
+func (app *application) addCardResponse(ms *multistatus, contact *data.Contact, prop *propNames) error {
+	response, err := propertiesResponse(cardHref(contact.ID, contact.CardName), app.cardProperties(contact), prop, false)
+	if err != nil {
+		return err
+	}
+	ms.responses = append(ms.responses, response)
+	return nil
+}
+
+// Return the cards the client lists by href. Hrefs which are not cards of existing contacts
+// are reported as not found.
+func (app *application) multigetReport(cm *data.ContactsModel, ms *multistatus, input *reportRequest) error {
+	for _, href := range input.Hrefs {
+		name, ok := cardNameFromHref(href)
+
+		var contact *data.Contact
+		var err error
+		if ok {
+			contact, err = findCard(cm, name)
+		}
+
+		switch {
+		case !ok, errors.Is(err, data.ErrRecordNotFound):
+			ms.responses = append(ms.responses, davResponse{href: href, status: http.StatusNotFound})
+		case err != nil:
+			return err
+		default:
+			err = app.addCardResponse(ms, contact, input.Prop)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Return the cards passing the filter. When there are more than the client's limit,
+// the address book is reported with 507 Insufficient Storage, as RFC 6352 asks.
+func (app *application) queryReport(cm *data.ContactsModel, ms *multistatus, input *reportRequest) error {
+	contacts, err := cm.ListContacts()
+	if err != nil {
+		return err
+	}
+
+	filter := input.Filter
+	if filter == nil {
+		filter = &cardFilter{}
+	}
+
+	for i := range contacts {
+		// filters match the text of the properties, which vCard 3.0 writes without tel: URIs
+		if !filter.matches(data.ContactVCard(&contacts[i], vcard.Version3)) {
+			continue
+		}
+
+		if input.Limit != nil && input.Limit.NResults > 0 && len(ms.responses) == input.Limit.NResults {
+			ms.responses = append(ms.responses, davResponse{href: davAddressBook, status: http.StatusInsufficientStorage})
+			break
+		}
+
+		err := app.addCardResponse(ms, &contacts[i], input.Prop)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Return the cards changed since the client's sync token, or every card when it sent none.
+// Deleted cards are reported as not found.
+func (app *application) syncReport(cm *data.ContactsModel, ms *multistatus, input *reportRequest) error {
+	if input.SyncToken == "" {
+		// the token is taken before the contacts are read, so changes made in between are sent again next time
+		ms.syncToken = cm.SyncToken()
+
+		contacts, err := cm.ListContacts()
+		if err != nil {
+			return err
+		}
+		for i := range contacts {
+			err := app.addCardResponse(ms, &contacts[i], input.Prop)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	ids, token, err := cm.ChangesSince(input.SyncToken)
+	if err != nil {
+		return err
+	}
+	ms.syncToken = token
+
+	for _, id := range ids {
+		contact, err := cm.GetContact(id)
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			ms.responses = append(ms.responses, davResponse{href: cardHref(id, cm.DeletedCardName(id)), status: http.StatusNotFound})
+		case err != nil:
+			return err
+		default:
+			err = app.addCardResponse(ms, contact, input.Prop)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
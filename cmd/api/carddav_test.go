@@ -0,0 +1,282 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+	"salestrekker_technical_interview.veljkoilic/internal/data"
+	"strings"
+	"testing"
+)
+
+// Return the first match of the pattern's group in the body, or fail the test
+func submatch(t *testing.T, pattern string, body []byte) string {
+	t.Helper()
+
+	m := regexp.MustCompile(pattern).FindSubmatch(body)
+	if m == nil {
+		t.Fatalf("want body to match %q; got %q", pattern, body)
+	}
+	return string(m[1])
+}
+
+func TestCardDAVDiscovery(t *testing.T) {
+	app := newTestApp()
+	app.useStore(data.NewMemoryStore(testContacts))
+	ts := newTestServer(app.routes())
+	defer ts.Close()
+
+	code, headers, _ := ts.request(t, "PROPFIND", "/.well-known/carddav", "", nil)
+	if code != http.StatusMovedPermanently || headers.Get("Location") != davRoot {
+		t.Errorf("want a redirect to %s; got %d, %q", davRoot, code, headers.Get("Location"))
+	}
+
+	code, headers, _ = ts.request(t, http.MethodOptions, davAddressBook, "", nil)
+	if code != http.StatusOK || !strings.Contains(headers.Get("DAV"), "addressbook") {
+		t.Errorf("want the addressbook feature in DAV; got %d, %q", code, headers.Get("DAV"))
+	}
+
+	propfind := `<?xml version="1.0"?><d:propfind xmlns:d="DAV:" xmlns:card="urn:ietf:params:xml:ns:carddav">` +
+		`<d:prop><d:current-user-principal/><card:addressbook-home-set/><d:unknown/></d:prop></d:propfind>`
+
+	testCases := []struct {
+		name     string
+		path     string
+		depth    string
+		body     string
+		expected []string
+	}{
+		{"principal", davRoot, "0", propfind, []string{
+			"<d:current-user-principal><d:href>/dav/</d:href></d:current-user-principal>",
+			"<card:addressbook-home-set><d:href>/dav/addressbooks/</d:href></card:addressbook-home-set>",
+			"<d:prop><d:unknown/></d:prop><d:status>HTTP/1.1 404 Not Found</d:status>",
+		}},
+		{"home", davHome, "1", "", []string{
+			"<d:href>/dav/addressbooks/contacts/</d:href>",
+			"<d:resourcetype><d:collection/><card:addressbook/></d:resourcetype>",
+		}},
+		{"address book", davAddressBook, "1", "", []string{
+			"<cs:getctag>",
+			"<d:sync-token>data:,sync-",
+			"<d:href>/dav/addressbooks/contacts/1.vcf</d:href>",
+			"<d:href>/dav/addressbooks/contacts/2.vcf</d:href>",
+			`<d:getetag>&#34;1&#34;</d:getetag>`,
+		}},
+		{"card", davAddressBook + "1.vcf", "0", `<d:propfind xmlns:d="DAV:"><d:propname/></d:propfind>`, []string{
+			"<d:getetag/>",
+			"<card:address-data/>",
+		}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			code, _, body := ts.request(t, "PROPFIND", tc.path, tc.body, http.Header{"Depth": {tc.depth}})
+
+			if code != http.StatusMultiStatus {
+				t.Errorf("want %d; got %d", http.StatusMultiStatus, code)
+			}
+			for _, want := range tc.expected {
+				if !strings.Contains(string(body), want) {
+					t.Errorf("want body to contain %q; got %q", want, body)
+				}
+			}
+		})
+	}
+}
+
+func TestCardDAVReports(t *testing.T) {
+	app := newTestApp()
+	app.useStore(data.NewMemoryStore(testContacts))
+	ts := newTestServer(app.routes())
+	defer ts.Close()
+
+	testCases := []struct {
+		name       string
+		body       string
+		wantCode   int
+		expected   []string
+		unexpected []string
+	}{
+		{
+			"multiget",
+			`<card:addressbook-multiget xmlns:d="DAV:" xmlns:card="urn:ietf:params:xml:ns:carddav">` +
+				`<d:prop><d:getetag/><card:address-data/></d:prop>` +
+				`<d:href>/dav/addressbooks/contacts/2.vcf</d:href><d:href>/dav/addressbooks/contacts/9.vcf</d:href>` +
+				`</card:addressbook-multiget>`,
+			http.StatusMultiStatus,
+			[]string{"FN:Marko Markovic", "<d:href>/dav/addressbooks/contacts/9.vcf</d:href><d:status>HTTP/1.1 404 Not Found</d:status>"},
+			[]string{"Veljko"},
+		},
+		{
+			"query",
+			`<card:addressbook-query xmlns:d="DAV:" xmlns:card="urn:ietf:params:xml:ns:carddav"><card:filter>` +
+				`<card:prop-filter name="FN"><card:text-match match-type="starts-with">veljko</card:text-match></card:prop-filter>` +
+				`</card:filter></card:addressbook-query>`,
+			http.StatusMultiStatus,
+			[]string{"/dav/addressbooks/contacts/1.vcf", "<d:getetag>"},
+			[]string{"2.vcf"},
+		},
+		{
+			"query negated",
+			`<card:addressbook-query xmlns:d="DAV:" xmlns:card="urn:ietf:params:xml:ns:carddav"><card:filter>` +
+				`<card:prop-filter name="FN"><card:text-match negate-condition="yes">veljko</card:text-match></card:prop-filter>` +
+				`</card:filter></card:addressbook-query>`,
+			http.StatusMultiStatus,
+			[]string{"2.vcf"},
+			[]string{"1.vcf"},
+		},
+		{
+			"query limit",
+			`<card:addressbook-query xmlns:d="DAV:" xmlns:card="urn:ietf:params:xml:ns:carddav">` +
+				`<card:limit><card:nresults>1</card:nresults></card:limit></card:addressbook-query>`,
+			http.StatusMultiStatus,
+			[]string{"1.vcf", "HTTP/1.1 507 Insufficient Storage"},
+			[]string{"2.vcf"},
+		},
+		{
+			"unsupported collation",
+			`<card:addressbook-query xmlns:d="DAV:" xmlns:card="urn:ietf:params:xml:ns:carddav"><card:filter>` +
+				`<card:prop-filter name="FN"><card:text-match collation="i;klingon">a</card:text-match></card:prop-filter>` +
+				`</card:filter></card:addressbook-query>`,
+			http.StatusForbidden,
+			[]string{"<card:supported-collation/>"},
+			nil,
+		},
+		{
+			"unsupported report",
+			`<d:expand-property xmlns:d="DAV:"/>`,
+			http.StatusForbidden,
+			[]string{"<d:supported-report/>"},
+			nil,
+		},
+		{
+			"invalid sync token",
+			`<d:sync-collection xmlns:d="DAV:"><d:sync-token>data:,sync-x-1</d:sync-token><d:sync-level>1</d:sync-level></d:sync-collection>`,
+			http.StatusForbidden,
+			[]string{"<d:valid-sync-token/>"},
+			nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			code, _, body := ts.request(t, "REPORT", davAddressBook, tc.body, http.Header{"Depth": {"1"}})
+
+			if code != tc.wantCode {
+				t.Errorf("want %d; got %d", tc.wantCode, code)
+			}
+			for _, want := range tc.expected {
+				if !strings.Contains(string(body), want) {
+					t.Errorf("want body to contain %q; got %q", want, body)
+				}
+			}
+			for _, unwanted := range tc.unexpected {
+				if strings.Contains(string(body), unwanted) {
+					t.Errorf("want body not to contain %q; got %q", unwanted, body)
+				}
+			}
+		})
+	}
+}
+
+// Testing a client's round trip: a full sync, creating, updating and deleting cards,
+// then an incremental sync which reports only those changes
+func TestCardDAVSync(t *testing.T) {
+	app := newTestApp()
+	app.useStore(data.NewMemoryStore(testContacts))
+	ts := newTestServer(app.routes())
+	defer ts.Close()
+
+	syncCollection := func(token string) []byte {
+		t.Helper()
+
+		body := `<d:sync-collection xmlns:d="DAV:"><d:sync-token>` + token + `</d:sync-token>` +
+			`<d:sync-level>1</d:sync-level><d:prop><d:getetag/></d:prop></d:sync-collection>`
+		code, _, respBody := ts.request(t, "REPORT", davAddressBook, body, nil)
+		if code != http.StatusMultiStatus {
+			t.Fatalf("want %d; got %d, %q", http.StatusMultiStatus, code, respBody)
+		}
+		return respBody
+	}
+
+	body := syncCollection("")
+	if !strings.Contains(string(body), "1.vcf") || !strings.Contains(string(body), "2.vcf") {
+		t.Errorf("want every card in the full sync; got %q", body)
+	}
+	token := submatch(t, `<d:sync-token>([^<]+)</d:sync-token>`, body)
+
+	vcardBody := http.Header{"Content-Type": {"text/vcard; charset=utf-8"}}
+	card := "BEGIN:VCARD\r\nVERSION:3.0\r\nFN:Ana Anic\r\nN:Anic;Ana;;;\r\nTEL;TYPE=cell:+381 64 598 332\r\nEND:VCARD\r\n"
+
+	// a new card name creates a contact, whose card stays where the client put it
+	created := davAddressBook + "new-card.vcf"
+	code, _, body := ts.request(t, http.MethodPut, created, card, vcardBody)
+	if code != http.StatusCreated {
+		t.Fatalf("want %d; got %d, %q", http.StatusCreated, code, body)
+	}
+	if code, _, _ := ts.get(t, davAddressBook+"3.vcf"); code != http.StatusNotFound {
+		t.Errorf("want the card only under its own name; got %d", code)
+	}
+
+	// names made of a number are kept for the cards named after the contacts' ids
+	if code, _, body := ts.request(t, http.MethodPut, davAddressBook+"99.vcf", card, vcardBody); code != http.StatusConflict {
+		t.Errorf("want %d; got %d, %q", http.StatusConflict, code, body)
+	}
+
+	code, headers, body := ts.get(t, created)
+	if code != http.StatusOK || !strings.Contains(string(body), "FN:Ana Anic") {
+		t.Errorf("want the stored card; got %d, %q", code, body)
+	}
+	etag := headers.Get("ETag")
+
+	// updates need the current ETag
+	updated := strings.Replace(card, "Ana Anic", "Ana Petrovic", 1)
+	stale := http.Header{"Content-Type": vcardBody["Content-Type"], "If-Match": {`"99"`}}
+	if code, _, _ := ts.request(t, http.MethodPut, created, updated, stale); code != http.StatusPreconditionFailed {
+		t.Errorf("want %d; got %d", http.StatusPreconditionFailed, code)
+	}
+	current := http.Header{"Content-Type": vcardBody["Content-Type"], "If-Match": {etag}}
+	if code, _, body := ts.request(t, http.MethodPut, created, updated, current); code != http.StatusNoContent {
+		t.Errorf("want %d; got %d, %q", http.StatusNoContent, code, body)
+	}
+
+	// a card which is not a valid contact is refused with the precondition it failed
+	invalid := "BEGIN:VCARD\r\nVERSION:3.0\r\nFN:No Phone\r\nEND:VCARD\r\n"
+	code, _, body = ts.request(t, http.MethodPut, davAddressBook+"1.vcf", invalid, vcardBody)
+	if code != http.StatusForbidden || !strings.Contains(string(body), "<card:valid-address-data/>") {
+		t.Errorf("want %d valid-address-data; got %d, %q", http.StatusForbidden, code, body)
+	}
+
+	if code, _, _ := ts.request(t, http.MethodDelete, davAddressBook+"2.vcf", "", nil); code != http.StatusNoContent {
+		t.Errorf("want %d; got %d", http.StatusNoContent, code)
+	}
+	if code, _, _ := ts.get(t, davAddressBook+"2.vcf"); code != http.StatusNotFound {
+		t.Errorf("want %d; got %d", http.StatusNotFound, code)
+	}
+
+	body = syncCollection(token)
+	for _, want := range []string{
+		"<d:href>/dav/addressbooks/contacts/2.vcf</d:href><d:status>HTTP/1.1 404 Not Found</d:status>",
+		"<d:href>/dav/addressbooks/contacts/new-card.vcf</d:href><d:propstat>",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("want body to contain %q; got %q", want, body)
+		}
+	}
+	if strings.Contains(string(body), "1.vcf") {
+		t.Errorf("want the unchanged card left out; got %q", body)
+	}
+
+	next := submatch(t, `<d:sync-token>([^<]+)</d:sync-token>`, body)
+	if next == token {
+		t.Errorf("want a new sync token; got %q again", next)
+	}
+
+	// a deleted card is reported under the name it was created with
+	if code, _, _ := ts.request(t, http.MethodDelete, created, "", nil); code != http.StatusNoContent {
+		t.Errorf("want %d; got %d", http.StatusNoContent, code)
+	}
+	body = syncCollection(next)
+	if want := "<d:href>/dav/addressbooks/contacts/new-card.vcf</d:href><d:status>HTTP/1.1 404 Not Found</d:status>"; !strings.Contains(string(body), want) {
+		t.Errorf("want body to contain %q; got %q", want, body)
+	}
+}
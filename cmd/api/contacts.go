@@ -1,21 +1,109 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"salestrekker_technical_interview.veljkoilic/internal/data"
 	"salestrekker_technical_interview.veljkoilic/internal/validator"
+	"salestrekker_technical_interview.veljkoilic/internal/vcard"
+	"strings"
 )
 
-// Handler for creating contact
-func (app *application) createContactHandler(w http.ResponseWriter, r *http.Request) {
+// Fields of a contact the client sends when creating or replacing it
+type contactInput struct {
+	FirstName  string         `json:"first_name"`
+	LastName   string         `json:"last_name"`
+	Telephone  string         `json:"telephone"`
+	Telephones []data.Phone   `json:"telephones"`
+	Emails     []data.Email   `json:"emails"`
+	Addresses  []data.Address `json:"addresses"`
+	Company    string         `json:"company"`
+	JobTitle   string         `json:"job_title"`
+	Birthday   *data.Date     `json:"birthday"`
+	Notes      string         `json:"notes"`
+	Tags       []string       `json:"tags"`
+	Custom     map[string]any `json:"custom"`
+}
 
-	var input struct {
-		FirstName string `json:"first_name"`
-		LastName  string `json:"last_name"`
-		Telephone string `json:"telephone"`
+// Copy every field of the input to the contact
+func (input *contactInput) copyTo(contact *data.Contact) {
+	contact.FirstName = input.FirstName
+	contact.LastName = input.LastName
+	contact.Telephone = input.Telephone
+	contact.Telephones = input.Telephones
+	contact.Emails = input.Emails
+	contact.Addresses = input.Addresses
+	contact.Company = input.Company
+	contact.JobTitle = input.JobTitle
+	contact.Birthday = input.Birthday
+	contact.Notes = input.Notes
+	contact.Tags = input.Tags
+	contact.Custom = input.Custom
+}
+
+// Fields of a contact the client sends when partially updating it.
+// Pointer fields are nil when the key is missing from the request body.
+type contactPatch struct {
+	FirstName  *string             `json:"first_name"`
+	LastName   *string             `json:"last_name"`
+	Telephone  *string             `json:"telephone"`
+	Telephones *[]data.Phone       `json:"telephones"`
+	Emails     *[]data.Email       `json:"emails"`
+	Addresses  *[]data.Address     `json:"addresses"`
+	Company    *string             `json:"company"`
+	JobTitle   *string             `json:"job_title"`
+	Birthday   nullable[data.Date] `json:"birthday"`
+	Notes      *string             `json:"notes"`
+	Tags       *[]string           `json:"tags"`
+	Custom     *map[string]any     `json:"custom"`
+}
+
+// Copy the fields present in the patch to the contact
+func (patch *contactPatch) applyTo(contact *data.Contact) {
+	if patch.FirstName != nil {
+		contact.FirstName = *patch.FirstName
+	}
+	if patch.LastName != nil {
+		contact.LastName = *patch.LastName
+	}
+	if patch.Telephone != nil {
+		contact.Telephone = *patch.Telephone
+	}
+	if patch.Telephones != nil {
+		contact.Telephones = *patch.Telephones
+	}
+	if patch.Emails != nil {
+		contact.Emails = *patch.Emails
 	}
+	if patch.Addresses != nil {
+		contact.Addresses = *patch.Addresses
+	}
+	if patch.Company != nil {
+		contact.Company = *patch.Company
+	}
+	if patch.JobTitle != nil {
+		contact.JobTitle = *patch.JobTitle
+	}
+	if patch.Birthday.Set {
+		contact.Birthday = patch.Birthday.Value
+	}
+	if patch.Notes != nil {
+		contact.Notes = *patch.Notes
+	}
+	if patch.Tags != nil {
+		contact.Tags = *patch.Tags
+	}
+	if patch.Custom != nil {
+		contact.Custom = *patch.Custom
+	}
+}
+
+// Handler for creating contact
+func (app *application) createContactHandler(w http.ResponseWriter, r *http.Request) {
+	var input contactInput
 
 	err := app.readJSON(w, r, &input)
 	if err != nil {
@@ -23,28 +111,37 @@ func (app *application) createContactHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	contact := &data.Contact{
-		FirstName: input.FirstName,
-		LastName:  input.LastName,
-		Telephone: input.Telephone,
+	contact := &data.Contact{}
+	input.copyTo(contact)
+
+	fields, err := app.fieldsModel.ListFields()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
 	}
 
 	// check if any validation errors have been found
 	v := validator.New()
-	if data.ValidateContact(v, contact); !v.IsValid() {
+	if data.ValidateContact(v, contact, fields); !v.IsValid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	err = app.contactsModel.InsertContact(contact)
+	err = app.contacts(r).InsertContact(contact)
 	if err != nil {
-		app.badRequestResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrDuplicateContact):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
 	// Include location header, so user can access the created contact
 	headers := make(http.Header)
-	headers.Set("Location", fmt.Sprintf("/v1/contacts/%d", contact.ID))
+	headers.Set("Location", fmt.Sprintf("%s/contacts/%d", routePrefix(r), contact.ID))
+	headers.Set("ETag", contactETag(contact))
 
 	// Write a JSON response with a 201 Created status code
 	err = app.writeJSON(w, http.StatusCreated, envelope{"contact": contact}, headers)
@@ -53,9 +150,136 @@ func (app *application) createContactHandler(w http.ResponseWriter, r *http.Requ
 	}
 }
 
-// Envelope all contacts and send them to the user
+// Values the contact lists can be sorted by
+var contactSortSafelist = []string{"id", "first_name", "last_name", "telephone", "-id", "-first_name", "-last_name", "-telephone"}
+
+// Envelope one page of the contacts matching the query string filters and send them to the user
 func (app *application) listAllContactsHandler(w http.ResponseWriter, r *http.Request) {
-	err := app.writeJSON(w, http.StatusOK, envelope{"contacts": app.contactsModel.Contacts}, nil)
+	var input struct {
+		data.ContactFilter
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.ContactFilter = app.readContactFilter(qs, v)
+
+	// Stream every matching contact instead of sending a single page
+	if stream := qs.Get("stream"); stream != "" {
+		if v.Check(stream == "ndjson", "stream", "must be ndjson"); !v.IsValid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		app.streamContacts(w, r, input.ContactFilter)
+		return
+	}
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "id")
+	input.Filters.SortSafelist = contactSortSafelist
+
+	if after := qs.Get("after"); after != "" {
+		id, err := app.decodeCursor(after)
+		if err != nil {
+			v.AddError("after", "must be a cursor returned by a previous request")
+		}
+		input.Filters.After = id
+	}
+
+	if data.ValidateFilters(v, input.Filters); !v.IsValid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	contacts, metadata, err := app.contacts(r).FilterContacts(input.ContactFilter, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if metadata.NextAfter > 0 {
+		metadata.NextCursor = app.encodeCursor(metadata.NextAfter)
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"contacts": contacts, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Read the filters the contact lists can be narrowed down with from the query string
+func (app *application) readContactFilter(qs url.Values, v *validator.Validator) data.ContactFilter {
+	var match data.ContactFilter
+
+	match.FirstName = app.readString(qs, "first_name", "")
+	match.LastName = app.readString(qs, "last_name", "")
+	match.Telephone = app.readString(qs, "telephone", "")
+	match.Carrier = app.readString(qs, "carrier", "")
+	match.Tag = app.readString(qs, "tag", "")
+	match.Group = int64(app.readInt(qs, "group", 0, v))
+	v.Check(match.Group >= 0, "group", "must be a positive integer")
+
+	return match
+}
+
+// Write every contact passing the filter as newline-delimited JSON, one contact per line.
+// The contacts are encoded one at a time, so the whole list is never buffered as one JSON document.
+func (app *application) streamContacts(w http.ResponseWriter, r *http.Request, match data.ContactFilter) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+
+	sw := newStreamWriter(w)
+	enc := json.NewEncoder(sw)
+	written := 0
+
+	err := app.contacts(r).EachContact(match, func(contact *data.Contact) error {
+		err := enc.Encode(contact)
+		if err != nil {
+			return err
+		}
+
+		// Push the contacts to the client in batches
+		written++
+		if written%100 == 0 {
+			return sw.Flush()
+		}
+		return nil
+	})
+
+	// The status line is already sent, so all that is left is to log the error
+	if err != nil {
+		app.logError(r, err)
+	}
+}
+
+// Search contacts by the words in the q query string parameter, best matches first
+func (app *application) searchContactsHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+
+	query := app.readString(qs, "q", "")
+	limit := app.readInt(qs, "limit", 20, v)
+
+	v.Check(strings.TrimSpace(query) != "", "q", "must be provided")
+	v.Check(len(query) <= 200, "q", "must not be more than 200 bytes long")
+	v.Check(limit > 0, "limit", "must be greater than zero")
+	v.Check(limit <= 100, "limit", "must be a maximum of 100")
+
+	if !v.IsValid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	results, err := app.contacts(r).SearchContacts(query, limit)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"results": results}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -70,7 +294,52 @@ func (app *application) showContactHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	contact, err := app.contactsModel.GetContact(id)
+	contact, err := app.contacts(r).GetContact(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// The contact is sent as a vCard to clients which prefer one
+	w.Header().Add("Vary", "Accept")
+
+	// The client already has the current version of the contact
+	etag := contactETag(contact)
+	if match := r.Header.Get("If-None-Match"); match != "" && etagMatches(match, etag, true) {
+		w.Header().Set("ETag", etag)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if mediaType, params := negotiateContentType(r, "application/json", vcard.MediaType, "text/x-vcard"); mediaType != "application/json" {
+		w.Header().Set("ETag", etag)
+		app.writeVCards(w, r, vcardVersion(params["version"]), contact)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"contact": contact}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Handler for replacing all the fields of the contact with the ID provided by the client
+func (app *application) updateContactHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	contact, err := app.contacts(r).GetContact(id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -81,7 +350,91 @@ func (app *application) showContactHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"contact": contact}, nil)
+	var input contactInput
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	input.copyTo(contact)
+
+	app.saveUpdatedContact(w, r, contact)
+}
+
+// Handler for partially updating the contact with the ID provided by the client.
+// Only the fields present in the request body are changed.
+func (app *application) patchContactHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	contact, err := app.contacts(r).GetContact(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input contactPatch
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	input.applyTo(contact)
+
+	app.saveUpdatedContact(w, r, contact)
+}
+
+// Validate the updated contact, save it and send it back to the client
+func (app *application) saveUpdatedContact(w http.ResponseWriter, r *http.Request, contact *data.Contact) {
+	// If the client sent If-Match, it has to hold the version the client based its changes on
+	if match := r.Header.Get("If-Match"); match != "" && !etagMatches(match, contactETag(contact), false) {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+
+	fields, err := app.fieldsModel.ListFields()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateContact(v, contact, fields); !v.IsValid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.contacts(r).UpdateContact(contact)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrDuplicateContact):
+			app.badRequestResponse(w, r, err)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", contactETag(contact))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"contact": contact}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -95,11 +448,35 @@ func (app *application) deleteContactHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	err = app.contactsModel.DeleteContact(id)
+	// Without If-Match any version of the contact is deleted
+	version := data.AnyVersion
+
+	if match := r.Header.Get("If-Match"); match != "" {
+		contact, err := app.contacts(r).GetContact(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		if !etagMatches(match, contactETag(contact), false) {
+			app.preconditionFailedResponse(w, r)
+			return
+		}
+		version = contact.Version
+	}
+
+	err = app.contacts(r).DeleteContactVersion(id, version)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
 			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
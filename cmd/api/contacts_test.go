@@ -0,0 +1,440 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"salestrekker_technical_interview.veljkoilic/internal/data"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Hammer the contact endpoints from many goroutines at once. Run with -race to let the
+// race detector check the contacts model as well.
+func TestConcurrentContactRequests(t *testing.T) {
+	app := newTestApp()
+	ts := newTestServer(app.routes())
+	defer ts.Close()
+
+	const workers = 16
+	const contactsPerWorker = 10
+
+	// send a request and decode the response body into dst
+	send := func(method, urlPath, body string, dst any) (int, error) {
+		req, err := http.NewRequest(method, ts.URL+urlPath, strings.NewReader(body))
+		if err != nil {
+			return 0, err
+		}
+
+		rs, err := ts.Client().Do(req)
+		if err != nil {
+			return 0, err
+		}
+		defer rs.Body.Close()
+
+		if dst == nil {
+			_, err = io.Copy(io.Discard, rs.Body)
+			return rs.StatusCode, err
+		}
+		return rs.StatusCode, json.NewDecoder(rs.Body).Decode(dst)
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+
+			for i := 0; i < contactsPerWorker; i++ {
+				body := fmt.Sprintf(`{"first_name": "Worker%d", "last_name": "Contact%d", "telephone": "+3816%07d"}`, w, i, w*100+i)
+
+				var created struct {
+					Contact struct {
+						ID int64 `json:"id"`
+					} `json:"contact"`
+				}
+				code, err := send(http.MethodPost, "/v1/contacts", body, &created)
+				if err != nil || code != http.StatusCreated {
+					t.Errorf("create: want %d; got %d (%v)", http.StatusCreated, code, err)
+					return
+				}
+
+				code, err = send(http.MethodGet, "/v1/contacts", "", nil)
+				if err != nil || code != http.StatusOK {
+					t.Errorf("list: want %d; got %d (%v)", http.StatusOK, code, err)
+					return
+				}
+
+				// delete every other contact again
+				if i%2 == 1 {
+					code, err = send(http.MethodDelete, fmt.Sprintf("/v1/contacts/%d", created.Contact.ID), "", nil)
+					if err != nil || code != http.StatusOK {
+						t.Errorf("delete: want %d; got %d (%v)", http.StatusOK, code, err)
+						return
+					}
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	code, _, body := ts.get(t, "/v1/contacts?page_size=100")
+	if code != http.StatusOK {
+		t.Fatalf("want %d; got %d", http.StatusOK, code)
+	}
+
+	var list struct {
+		Contacts []struct {
+			ID int64 `json:"id"`
+		} `json:"contacts"`
+	}
+	if err := json.Unmarshal(body, &list); err != nil {
+		t.Fatal(err)
+	}
+
+	want := workers * contactsPerWorker / 2
+	if len(list.Contacts) != want {
+		t.Errorf("want %d contacts; got %d", want, len(list.Contacts))
+	}
+
+	seen := make(map[int64]bool)
+	for _, contact := range list.Contacts {
+		if seen[contact.ID] {
+			t.Errorf("duplicate id %d", contact.ID)
+		}
+		seen[contact.ID] = true
+	}
+}
+
+func TestUpdateContact(t *testing.T) {
+	app := newTestApp()
+	app.useStore(data.NewMemoryStore(testContacts))
+	ts := newTestServer(app.routes())
+	defer ts.Close()
+
+	testCases := []struct {
+		name     string
+		method   string
+		urlPath  string
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{"replace", http.MethodPut, "/v1/contacts/1", `{"first_name": "Veljko", "last_name": "Ilic", "telephone": "+38164111222"}`,
+			http.StatusOK, `"telephone": "+38164111222"`},
+		{"replace missing field", http.MethodPut, "/v1/contacts/1", `{"first_name": "Veljko", "telephone": "+38164111222"}`,
+			http.StatusUnprocessableEntity, `"last_name": "must be provided"`},
+		{"patch one field", http.MethodPatch, "/v1/contacts/1", `{"last_name": "Ilić"}`,
+			http.StatusOK, `"last_name": "Ilić"`},
+		{"patch invalid telephone", http.MethodPatch, "/v1/contacts/1", `{"telephone": "123"}`,
+			http.StatusUnprocessableEntity, `"telephone"`},
+		{"patch into duplicate", http.MethodPatch, "/v1/contacts/2", `{"first_name": "Veljko", "last_name": "Ilić", "telephone": "+38164111222"}`,
+			http.StatusBadRequest, `same contact already exists`},
+		{"missing contact", http.MethodPatch, "/v1/contacts/10", `{"last_name": "Ilic"}`,
+			http.StatusNotFound, `could not be found`},
+		{"unknown field", http.MethodPatch, "/v1/contacts/1", `{"nickname": "Vex"}`,
+			http.StatusBadRequest, `unknown key`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			code, _, body := ts.request(t, tc.method, tc.urlPath, tc.body, nil)
+
+			if code != tc.wantCode {
+				t.Errorf("want %d; got %d", tc.wantCode, code)
+			}
+			if !strings.Contains(string(body), tc.wantBody) {
+				t.Errorf("want body to contain %q; got %q", tc.wantBody, body)
+			}
+		})
+	}
+
+	// the first contact keeps every change made to it
+	contact, err := app.contactsModel.GetContact(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := data.Contact{ID: 1, Tenant: data.DefaultTenant, FirstName: "Veljko", LastName: "Ilić", Telephone: "+38164111222", Carrier: "mts", NumberType: "mobile", Version: 3}
+	if !reflect.DeepEqual(*contact, want) {
+		t.Errorf("want %v; got %v", want, *contact)
+	}
+}
+
+func TestContactConditionalRequests(t *testing.T) {
+	app := newTestApp()
+	app.useStore(data.NewMemoryStore(testContacts))
+	ts := newTestServer(app.routes())
+	defer ts.Close()
+
+	testCases := []struct {
+		name     string
+		method   string
+		body     string
+		header   string
+		value    string
+		wantCode int
+		wantETag string
+	}{
+		{"get", http.MethodGet, "", "", "", http.StatusOK, `"1"`},
+		{"get cached", http.MethodGet, "", "If-None-Match", `W/"1"`, http.StatusNotModified, `"1"`},
+		{"get changed", http.MethodGet, "", "If-None-Match", `"0", "2"`, http.StatusOK, `"1"`},
+		{"patch stale", http.MethodPatch, `{"last_name": "Ilić"}`, "If-Match", `"0"`, http.StatusPreconditionFailed, ""},
+		{"patch weak tag", http.MethodPatch, `{"last_name": "Ilić"}`, "If-Match", `W/"1"`, http.StatusPreconditionFailed, ""},
+		{"patch current", http.MethodPatch, `{"last_name": "Ilić"}`, "If-Match", `"1"`, http.StatusOK, `"2"`},
+		{"put any", http.MethodPut, `{"first_name": "Veljko", "last_name": "Ilic", "telephone": "+38163577442"}`, "If-Match", `*`, http.StatusOK, `"3"`},
+		{"delete stale", http.MethodDelete, "", "If-Match", `"2"`, http.StatusPreconditionFailed, ""},
+		{"delete current", http.MethodDelete, "", "If-Match", `"3"`, http.StatusOK, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			headers := make(http.Header)
+			if tc.header != "" {
+				headers.Set(tc.header, tc.value)
+			}
+
+			code, rsHeaders, _ := ts.request(t, tc.method, "/v1/contacts/1", tc.body, headers)
+
+			if code != tc.wantCode {
+				t.Errorf("want %d; got %d", tc.wantCode, code)
+			}
+			if etag := rsHeaders.Get("ETag"); tc.wantETag != "" && etag != tc.wantETag {
+				t.Errorf("want ETag %s; got %s", tc.wantETag, etag)
+			}
+		})
+	}
+}
+
+func TestListContactsQueryValidation(t *testing.T) {
+	app := newTestApp()
+	app.useStore(data.NewMemoryStore(testContacts))
+	ts := newTestServer(app.routes())
+	defer ts.Close()
+
+	testCases := []struct {
+		urlPath  string
+		wantCode int
+		wantBody string
+	}{
+		{"/v1/contacts?last_name=mark&page_size=5", http.StatusOK, `"total_records": 1`},
+		{"/v1/contacts?sort=-first_name", http.StatusOK, `"current_page": 1`},
+		{"/v1/contacts?carrier=yettel", http.StatusOK, `"carrier": "Yettel"`},
+		{"/v1/contacts?carrier=mts", http.StatusOK, `"contacts": []`},
+		{"/v1/contacts?page=0", http.StatusUnprocessableEntity, `"page": "must be greater than zero"`},
+		{"/v1/contacts?page_size=101", http.StatusUnprocessableEntity, `"page_size": "must be a maximum of 100"`},
+		{"/v1/contacts?page=first", http.StatusUnprocessableEntity, `"page": "must be an integer value"`},
+		{"/v1/contacts?sort=version", http.StatusUnprocessableEntity, `"sort": "invalid sort value"`},
+	}
+
+	for _, tc := range testCases {
+		code, _, body := ts.get(t, tc.urlPath)
+
+		if code != tc.wantCode {
+			t.Errorf("%s: want %d; got %d", tc.urlPath, tc.wantCode, code)
+		}
+		if !strings.Contains(string(body), tc.wantBody) {
+			t.Errorf("%s: want body to contain %q; got %q", tc.urlPath, tc.wantBody, body)
+		}
+	}
+}
+
+func TestListContactsWithCursor(t *testing.T) {
+	var contacts []data.Contact
+	for i := int64(1); i <= 5; i++ {
+		contacts = append(contacts, data.Contact{ID: i, FirstName: "Veljko", LastName: "Ilic", Telephone: fmt.Sprintf("+3816300000%d", i)})
+	}
+
+	app := newTestApp()
+	app.useStore(data.NewMemoryStore(contacts))
+	ts := newTestServer(app.routes())
+	defer ts.Close()
+
+	var page struct {
+		Contacts []data.Contact `json:"contacts"`
+		Metadata data.Metadata  `json:"metadata"`
+	}
+
+	// walk through all the contacts two at a time, deleting a contact of the next page in between
+	urlPath := "/v1/contacts?page_size=2"
+	var ids []int64
+	for urlPath != "" {
+		code, _, body := ts.get(t, urlPath)
+		if code != http.StatusOK {
+			t.Fatalf("want %d; got %d", http.StatusOK, code)
+		}
+
+		page.Metadata = data.Metadata{}
+		if err := json.Unmarshal(body, &page); err != nil {
+			t.Fatal(err)
+		}
+		for _, contact := range page.Contacts {
+			ids = append(ids, contact.ID)
+		}
+
+		if len(ids) == 2 {
+			if err := app.contactsModel.DeleteContact(3); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		urlPath = ""
+		if page.Metadata.NextCursor != "" {
+			urlPath = "/v1/contacts?page_size=2&after=" + page.Metadata.NextCursor
+		}
+	}
+
+	want := []int64{1, 2, 4, 5}
+	if fmt.Sprint(ids) != fmt.Sprint(want) {
+		t.Errorf("want ids %v; got %v", want, ids)
+	}
+
+	// a cursor with a changed id has to be rejected
+	cursor := []byte(app.encodeCursor(2))
+	cursor[0] ^= 1
+	code, _, body := ts.get(t, "/v1/contacts?after="+string(cursor))
+	if code != http.StatusUnprocessableEntity || !strings.Contains(string(body), `"after"`) {
+		t.Errorf("want %d with after error; got %d %q", http.StatusUnprocessableEntity, code, body)
+	}
+
+	code, _, _ = ts.get(t, "/v1/contacts?sort=-id&after="+app.encodeCursor(2))
+	if code != http.StatusUnprocessableEntity {
+		t.Errorf("want %d; got %d", http.StatusUnprocessableEntity, code)
+	}
+}
+
+func TestStreamContacts(t *testing.T) {
+	app := newTestApp()
+	app.useStore(data.NewMemoryStore(testContacts))
+	ts := newTestServer(app.routes())
+	defer ts.Close()
+
+	code, headers, body := ts.get(t, "/v1/contacts?stream=ndjson&last_name=ilic")
+	if code != http.StatusOK {
+		t.Fatalf("want %d; got %d", http.StatusOK, code)
+	}
+
+	if ct := headers.Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("want application/x-ndjson; got %s", ct)
+	}
+
+	want := `{"id":1,"tenant":"default","first_name":"Veljko","last_name":"Ilic","telephone":"+38163577442","carrier":"Yettel","number_type":"mobile","version":1}` + "\n"
+	if string(body) != want {
+		t.Errorf("want %q; got %q", want, body)
+	}
+
+	code, _, _ = ts.get(t, "/v1/contacts?stream=csv")
+	if code != http.StatusUnprocessableEntity {
+		t.Errorf("want %d; got %d", http.StatusUnprocessableEntity, code)
+	}
+}
+
+// Testing that a streamed response may take longer than the server's write timeout, as long as every chunk is taken in time
+func TestStreamWriter(t *testing.T) {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := newStreamWriter(w)
+		for i := range 4 {
+			time.Sleep(50 * time.Millisecond)
+			fmt.Fprintf(sw, "chunk %d\n", i)
+			sw.Flush()
+		}
+	}))
+	ts.Config.WriteTimeout = 100 * time.Millisecond
+	ts.Start()
+	defer ts.Close()
+
+	rs, err := ts.Client().Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Body.Close()
+
+	body, err := io.ReadAll(rs.Body)
+	if err != nil || strings.Count(string(body), "chunk") != 4 {
+		t.Errorf("want 4 chunks; got %q, %v", body, err)
+	}
+}
+
+func TestSearchContacts(t *testing.T) {
+	app := newTestApp()
+	app.useStore(data.NewMemoryStore(testContacts))
+	ts := newTestServer(app.routes())
+	defer ts.Close()
+
+	testCases := []struct {
+		urlPath  string
+		wantCode int
+		wantBody string
+	}{
+		{"/v1/contacts/search?q=Markovc", http.StatusOK, `"last_name": "Markovic"`},
+		{"/v1/contacts/search?q=Илић", http.StatusOK, `"last_name": "Ilic"`},
+		{"/v1/contacts/search", http.StatusUnprocessableEntity, `"q": "must be provided"`},
+		{"/v1/contacts/search?q=ilic&limit=0", http.StatusUnprocessableEntity, `"limit"`},
+		{"/v1/contacts/2", http.StatusOK, `"last_name": "Markovic"`},
+	}
+
+	for _, tc := range testCases {
+		code, _, body := ts.get(t, tc.urlPath)
+
+		if code != tc.wantCode {
+			t.Errorf("%s: want %d; got %d", tc.urlPath, tc.wantCode, code)
+		}
+		if !strings.Contains(string(body), tc.wantBody) {
+			t.Errorf("%s: want body to contain %q; got %q", tc.urlPath, tc.wantBody, body)
+		}
+	}
+}
+
+func TestContactDetails(t *testing.T) {
+	app := newTestApp()
+	ts := newTestServer(app.routes())
+	defer ts.Close()
+
+	testCases := []struct {
+		name     string
+		method   string
+		urlPath  string
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{"create", http.MethodPost, "/v1/contacts", `{"first_name": "Veljko", "last_name": "Ilic", "telephone": "+38163577442",
+			"emails": [{"label": "work", "address": "veljko@example.com"}], "birthday": "1990-05-17", "company": "Salestrekker"}`,
+			http.StatusCreated, `"birthday": "1990-05-17"`},
+		{"create with bad email", http.MethodPost, "/v1/contacts", `{"first_name": "Marko", "last_name": "Markovic", "telephone": "+38163587442",
+			"emails": [{"address": "marko"}]}`,
+			http.StatusUnprocessableEntity, `"emails[0].address": "must be a valid email address"`},
+		{"create with bad date", http.MethodPost, "/v1/contacts", `{"first_name": "Marko", "last_name": "Markovic", "telephone": "+38163587442",
+			"birthday": "17.05.1990"}`,
+			http.StatusBadRequest, `invalid date format`},
+		{"patch address", http.MethodPatch, "/v1/contacts/1", `{"addresses": [{"city": "Novi Sad"}]}`,
+			http.StatusOK, `"city": "Novi Sad"`},
+		{"patch clears birthday", http.MethodPatch, "/v1/contacts/1", `{"birthday": null}`,
+			http.StatusOK, `"company": "Salestrekker"`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			code, _, body := ts.request(t, tc.method, tc.urlPath, tc.body, nil)
+
+			if code != tc.wantCode {
+				t.Errorf("want %d; got %d", tc.wantCode, code)
+			}
+			if !strings.Contains(string(body), tc.wantBody) {
+				t.Errorf("want body to contain %q; got %q", tc.wantBody, body)
+			}
+		})
+	}
+
+	contact, err := app.contactsModel.GetContact(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contact.Birthday != nil || len(contact.Emails) != 1 || len(contact.Addresses) != 1 {
+		t.Errorf("want emails and addresses kept and birthday cleared; got %+v", contact)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"salestrekker_technical_interview.veljkoilic/internal/data"
+)
+
+// Own type for the request context keys, so they can not collide with keys set by other packages
+type contextKey string
+
+const (
+	userContextKey      = contextKey("user")
+	apiKeyContextKey    = contextKey("apiKey")
+	tenantContextKey    = contextKey("tenant")
+	requestIDContextKey = contextKey("requestID")
+	routeContextKey     = contextKey("route")
+)
+
+// Return a copy of the request with the user in its context
+func (app *application) contextSetUser(r *http.Request, user *data.User) *http.Request {
+	ctx := context.WithValue(r.Context(), userContextKey, user)
+	return r.WithContext(ctx)
+}
+
+// Return the user who sent the request. Every request goes through authenticate first,
+// so a request without a user in its context is a bug.
+func (app *application) contextGetUser(r *http.Request) *data.User {
+	user, ok := r.Context().Value(userContextKey).(*data.User)
+	if !ok {
+		panic("missing user value in request context")
+	}
+	return user
+}
+
+// Return a copy of the request with the API key it was authenticated with in its context
+func (app *application) contextSetAPIKey(r *http.Request, key *data.APIKey) *http.Request {
+	ctx := context.WithValue(r.Context(), apiKeyContextKey, key)
+	return r.WithContext(ctx)
+}
+
+// Return the API key the request was authenticated with, or nil when it was not sent with one
+func (app *application) contextGetAPIKey(r *http.Request) *data.APIKey {
+	key, _ := r.Context().Value(apiKeyContextKey).(*data.APIKey)
+	return key
+}
+
+// Return a copy of the request with the tenant it works with in its context
+func (app *application) contextSetTenant(r *http.Request, tenant string) *http.Request {
+	ctx := context.WithValue(r.Context(), tenantContextKey, tenant)
+	return r.WithContext(ctx)
+}
+
+// Return the tenant whose contacts the request works with. Every request goes through authenticate first,
+// so a request without a tenant in its context is a bug.
+func (app *application) contextGetTenant(r *http.Request) string {
+	tenant, ok := r.Context().Value(tenantContextKey).(string)
+	if !ok {
+		panic("missing tenant value in request context")
+	}
+	return tenant
+}
+
+// Return a copy of the request with its request ID in its context
+func (app *application) contextSetRequestID(r *http.Request, id string) *http.Request {
+	ctx := context.WithValue(r.Context(), requestIDContextKey, id)
+	return r.WithContext(ctx)
+}
+
+// Return the ID of the request, or "" when it has none. Errors are logged with the ID,
+// so a missing one must not make the logging fail.
+func (app *application) contextGetRequestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDContextKey).(string)
+	return id
+}
+
+// Return a copy of the request with the place the template of the route it is routed to is written to in its context
+func (app *application) contextSetRoute(r *http.Request, route *string) *http.Request {
+	ctx := context.WithValue(r.Context(), routeContextKey, route)
+	return r.WithContext(ctx)
+}
+
+// Return the place the template of the request's route is written to, or nil when the request
+// did not go through instrument
+func (app *application) contextGetRoute(r *http.Request) *string {
+	route, _ := r.Context().Value(routeContextKey).(*string)
+	return route
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"salestrekker_technical_interview.veljkoilic/internal/data"
+	"salestrekker_technical_interview.veljkoilic/internal/validator"
+	"strings"
+)
+
+// Largest CSV file the import endpoint accepts
+const maxImportBytes = 10 << 20
+
+// Send the contacts matching the query string filters as a CSV file, with a column for every custom field
+func (app *application) exportContactsCSVHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	match := app.readContactFilter(r.URL.Query(), v)
+
+	if !v.IsValid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	fields, err := app.fieldsModel.ListFields()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="contacts.csv"`)
+	w.WriteHeader(http.StatusOK)
+
+	// The status line is already sent, so all that is left is to log the error
+	err = app.contacts(r).ExportCSV(newStreamWriter(w), match, fields)
+	if err != nil {
+		app.logError(r, err)
+	}
+}
+
+// Import the contacts in the CSV or vCard file sent as the request body. Bodies sent as text/vcard
+// are read as vCards, the rest as CSV. Headers are matched with the contact fields by name,
+// unless the map query string parameter says otherwise, as in map=Mobile:telephone.
+// The duplicates parameter says what happens to rows which are the same contact as a stored one:
+// they are skipped, overwrite the stored contact, or fail.
+// Every row is reported in the response, rows which fail do not stop the import.
+func (app *application) importContactsHandler(w http.ResponseWriter, r *http.Request) {
+	if isVCardRequest(r) {
+		app.importVCardsHandler(w, r)
+		return
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	duplicates := app.readString(qs, "duplicates", data.ImportSkip)
+	v.Check(validator.PermittedValue(duplicates, data.ImportModes...), "duplicates", "must be one of skip, overwrite or fail")
+
+	mapping := make(map[string]string)
+	for _, entry := range qs["map"] {
+		// the column names have no colons, so the header is everything before the last one
+		i := strings.LastIndex(entry, ":")
+		if i == -1 {
+			v.AddError("map", "must be in the header:column format")
+			continue
+		}
+		mapping[strings.TrimSpace(entry[:i])] = strings.TrimSpace(entry[i+1:])
+	}
+
+	fields, err := app.fieldsModel.ListFields()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if data.ValidateCSVMapping(v, mapping, fields); !v.IsValid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+
+	summary, err := app.contacts(r).ImportCSV(r.Body, mapping, duplicates, fields)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		switch {
+		case errors.Is(err, data.ErrInvalidCSV):
+			app.badRequestResponse(w, r, err)
+		case errors.As(err, &maxBytesError):
+			app.badRequestResponse(w, r, fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit))
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"summary": summary}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http"
+	"salestrekker_technical_interview.veljkoilic/internal/data"
+	"strings"
+	"testing"
+)
+
+func TestExportContactsCSV(t *testing.T) {
+	app := newTestApp()
+	app.useStore(data.NewMemoryStore(testContacts))
+	ts := newTestServer(app.routes())
+	defer ts.Close()
+
+	testCases := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody string
+	}{
+		{"all", "/v1/contacts/export.csv", http.StatusOK,
+			"id,first_name,last_name,telephone,telephones,emails,company,job_title,birthday,notes,tags\n" +
+				"1,Veljko,Ilic,'+38163577442,,,,,,,\n" +
+				"2,Marko,Markovic,'+38163587442,,,,,,,\n"},
+		{"filtered", "/v1/contacts/export.csv?last_name=mark", http.StatusOK,
+			"tags\n2,Marko,Markovic,'+38163587442,,,,,,,\n"},
+		{"invalid filter", "/v1/contacts/export.csv?group=-1", http.StatusUnprocessableEntity,
+			`"group": "must be a positive integer"`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			code, headers, body := ts.get(t, tc.urlPath)
+
+			if code != tc.wantCode {
+				t.Errorf("want %d; got %d", tc.wantCode, code)
+			}
+			if !strings.Contains(string(body), tc.wantBody) {
+				t.Errorf("want body to contain %q; got %q", tc.wantBody, body)
+			}
+			if ct := headers.Get("Content-Type"); code == http.StatusOK && ct != "text/csv; charset=utf-8" {
+				t.Errorf("want text/csv; got %q", ct)
+			}
+		})
+	}
+}
+
+func TestImportContacts(t *testing.T) {
+	app := newTestApp()
+	app.useStore(data.NewMemoryStore(testContacts))
+	ts := newTestServer(app.routes())
+	defer ts.Close()
+
+	testCases := []struct {
+		name     string
+		method   string
+		urlPath  string
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{"import", http.MethodPost, "/v1/contacts/import?map=Mobile:telephone",
+			"first_name,last_name,Mobile\nAna,Anic,063111222\nAna,,063111333\n",
+			http.StatusOK, `"created": 1`},
+		{"row errors", http.MethodPost, "/v1/contacts/import?map=Mobile:telephone",
+			"first_name,last_name,Mobile\nAna,,063111333\n",
+			http.StatusOK, `"errors": {
+					"last_name": "must be provided"
+				}`},
+		{"skip duplicates", http.MethodPost, "/v1/contacts/import",
+			"first_name,last_name,telephone\nAna,Anic,+38163111222\n",
+			http.StatusOK, `"skipped": 1`},
+		{"overwrite duplicates", http.MethodPost, "/v1/contacts/import?duplicates=overwrite",
+			"first_name,last_name,telephone,company\nAna,Anic,+38163111222,Acme\n",
+			http.StatusOK, `"updated": 1`},
+		{"overwritten contact", http.MethodGet, "/v1/contacts/3", "",
+			http.StatusOK, `"company": "Acme"`},
+		{"unknown mode", http.MethodPost, "/v1/contacts/import?duplicates=merge", "first_name\n",
+			http.StatusUnprocessableEntity, `"duplicates": "must be one of skip, overwrite or fail"`},
+		{"unknown mapped column", http.MethodPost, "/v1/contacts/import?map=Mobile:mobile", "first_name\n",
+			http.StatusUnprocessableEntity, `"map[Mobile]"`},
+		{"missing header", http.MethodPost, "/v1/contacts/import", "",
+			http.StatusBadRequest, `the header row is missing`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			code, _, body := ts.request(t, tc.method, tc.urlPath, tc.body, http.Header{"Content-Type": {"text/csv"}})
+
+			if code != tc.wantCode {
+				t.Errorf("want %d; got %d", tc.wantCode, code)
+			}
+			if !strings.Contains(string(body), tc.wantBody) {
+				t.Errorf("want body to contain %q; got %q", tc.wantBody, body)
+			}
+		})
+	}
+}
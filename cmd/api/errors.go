@@ -5,8 +5,9 @@ import (
 	"net/http"
 )
 
+// Log the error together with the request it happened in
 func (app *application) logError(r *http.Request, err error) {
-	app.logger.Print(err)
+	app.logger.Error(err.Error(), "method", r.Method, "url", r.URL.RequestURI(), "request_id", app.contextGetRequestID(r))
 }
 
 // A generic helper for sending JSON-formatted error responses to the client
@@ -45,8 +46,86 @@ func (app *application) badRequestResponse(w http.ResponseWriter, r *http.Reques
 	app.errorResponse(w, r, http.StatusBadRequest, err.Error())
 }
 
+// A 409 Conflict response, sent when the contact was changed by someone else while the request was handled
+func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Request) {
+	message := "unable to update the record due to an edit conflict, please try again"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+// A 409 Conflict response, sent when a change of a custom field would make the values of stored contacts invalid
+func (app *application) fieldInUseResponse(w http.ResponseWriter, r *http.Request, contacts int) {
+	message := fmt.Sprintf("the change would make the value of %d contacts invalid, change them first", contacts)
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+// A 409 Conflict response, sent when a CardDAV client creates a card under a name it can not have
+func (app *application) cardNameConflictResponse(w http.ResponseWriter, r *http.Request) {
+	message := "card names made of a number are kept for the cards of existing contacts, choose another name"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+// A 412 Precondition Failed response, sent when the If-Match header does not match the current version
+func (app *application) preconditionFailedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the record has been modified since you last retrieved it"
+	app.errorResponse(w, r, http.StatusPreconditionFailed, message)
+}
+
+// A 429 Too Many Requests response, sent when the client has used up its rate limit.
+// The Retry-After header tells it when to try again.
+func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request) {
+	message := "rate limit exceeded"
+	app.errorResponse(w, r, http.StatusTooManyRequests, message)
+}
+
 // A 422 Status Unprocessable Entity response, in the case validation fails
 // Passes a map with all the validation errors to errorResponse function
 func (app *application) failedValidationResponse(w http.ResponseWriter, r *http.Request, errors map[string]string) {
 	app.errorResponse(w, r, http.StatusUnprocessableEntity, errors)
 }
+
+// Realm the API keys and tokens are valid in, sent in the WWW-Authenticate challenges
+const authRealm = "contacts"
+
+// Add the challenges which tell the clients the ways of authenticating the API accepts
+func setAuthChallenges(w http.ResponseWriter, bearerParams string) {
+	w.Header().Add("WWW-Authenticate", fmt.Sprintf(`Bearer realm=%q`, authRealm)+bearerParams)
+	w.Header().Add("WWW-Authenticate", fmt.Sprintf(`Basic realm=%q, charset="UTF-8"`, authRealm))
+}
+
+// A 401 Unauthorized response, sent when a resource needs credentials and the request has none
+func (app *application) authenticationRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	setAuthChallenges(w, "")
+
+	message := "you must be authenticated to access this resource"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+// A 401 Unauthorized response, sent when the API key or token of the request is unknown or expired
+func (app *application) invalidAuthenticationTokenResponse(w http.ResponseWriter, r *http.Request) {
+	setAuthChallenges(w, `, error="invalid_token"`)
+
+	message := "invalid or missing authentication token or API key"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+// A 401 Unauthorized response, sent when a login has the wrong email or password
+func (app *application) invalidCredentialsResponse(w http.ResponseWriter, r *http.Request) {
+	setAuthChallenges(w, "")
+
+	message := "invalid authentication credentials"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+// A 403 Forbidden response, sent when the user has not activated the account yet
+func (app *application) inactiveAccountResponse(w http.ResponseWriter, r *http.Request) {
+	message := "your user account must be activated to access this resource"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+// A 403 Forbidden response, sent when the user or API key lacks the permission the request needs
+func (app *application) notPermittedResponse(w http.ResponseWriter, r *http.Request, code string) {
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm=%q, error="insufficient_scope", scope=%q`, authRealm, code))
+
+	message := fmt.Sprintf("your user account or API key needs the %s permission to access this resource", code)
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"salestrekker_technical_interview.veljkoilic/internal/data"
+	"salestrekker_technical_interview.veljkoilic/internal/validator"
+)
+
+// Handler for adding a field to the custom field schema. A required field is refused with 409 Conflict
+// while any contact has no value for it.
+func (app *application) createFieldHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name       string   `json:"name"`
+		Type       string   `json:"type"`
+		Required   bool     `json:"required"`
+		EnumValues []string `json:"enum_values"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	fields, err := app.fieldsModel.ListFields()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	field := &data.Field{
+		Name:       input.Name,
+		Type:       input.Type,
+		Required:   input.Required,
+		EnumValues: input.EnumValues,
+	}
+
+	v := validator.New()
+	if data.ValidateField(v, field, len(fields)); !v.IsValid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.fieldsModel.InsertField(field)
+	if err != nil {
+		var inUse *data.FieldInUseError
+		switch {
+		case errors.Is(err, data.ErrDuplicateField):
+			app.badRequestResponse(w, r, err)
+		case errors.As(err, &inUse):
+			app.fieldInUseResponse(w, r, inUse.Contacts)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/fields/%s", field.Name))
+	headers.Set("ETag", fieldETag(field))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"field": field}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Send the whole custom field schema to the user
+func (app *application) listFieldsHandler(w http.ResponseWriter, r *http.Request) {
+	fields, err := app.fieldsModel.ListFields()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"fields": fields}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Show the field with the name provided by the client
+func (app *application) showFieldHandler(w http.ResponseWriter, r *http.Request) {
+	field, ok := app.readField(w, r)
+	if !ok {
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", fieldETag(field))
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"field": field}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Handler for changing whether a field is required and which values an enum field allows.
+// The name and the type of a field can not be changed, as the stored values depend on them.
+// The change is refused with 409 Conflict when it would make the value of any contact invalid.
+func (app *application) updateFieldHandler(w http.ResponseWriter, r *http.Request) {
+	field, ok := app.readField(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Required   *bool     `json:"required"`
+		EnumValues *[]string `json:"enum_values"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if match := r.Header.Get("If-Match"); match != "" && !etagMatches(match, fieldETag(field), false) {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+
+	if input.Required != nil {
+		field.Required = *input.Required
+	}
+	if input.EnumValues != nil {
+		field.EnumValues = *input.EnumValues
+	}
+
+	v := validator.New()
+	if data.ValidateField(v, field, -1); !v.IsValid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.fieldsModel.UpdateField(field)
+	if err != nil {
+		var inUse *data.FieldInUseError
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.As(err, &inUse):
+			app.fieldInUseResponse(w, r, inUse.Contacts)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", fieldETag(field))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"field": field}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Remove the field with the name provided by the client from the schema,
+// together with its values in every contact
+func (app *application) deleteFieldHandler(w http.ResponseWriter, r *http.Request) {
+	name := httprouter.ParamsFromContext(r.Context()).ByName("name")
+
+	err := app.fieldsModel.DeleteField(name)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "field successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Fetch the field with the name in the path. If it can not be fetched the error response
+// is sent and false is returned.
+func (app *application) readField(w http.ResponseWriter, r *http.Request) (*data.Field, bool) {
+	name := httprouter.ParamsFromContext(r.Context()).ByName("name")
+
+	field, err := app.fieldsModel.GetField(name)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return field, true
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"net/http"
+	"salestrekker_technical_interview.veljkoilic/internal/data"
+	"strings"
+	"testing"
+)
+
+func TestFields(t *testing.T) {
+	app := newTestApp()
+	app.useStore(data.NewMemoryStore(testContacts))
+	ts := newTestServer(app.routes())
+	defer ts.Close()
+
+	testCases := []struct {
+		name     string
+		method   string
+		urlPath  string
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{"create", http.MethodPost, "/v1/fields", `{"name": "tier", "type": "enum", "enum_values": ["gold", "silver"]}`,
+			http.StatusCreated, `"name": "tier"`},
+		{"create bad type", http.MethodPost, "/v1/fields", `{"name": "industry", "type": "text"}`,
+			http.StatusUnprocessableEntity, `"type": "must be one of string, number, date, enum or bool"`},
+		{"create duplicate", http.MethodPost, "/v1/fields", `{"name": "tier", "type": "string"}`,
+			http.StatusBadRequest, `already exists`},
+		{"create required", http.MethodPost, "/v1/fields", `{"name": "region", "type": "string", "required": true}`,
+			http.StatusConflict, `the change would make the value of 2 contacts invalid`},
+		{"create number", http.MethodPost, "/v1/fields", `{"name": "employees", "type": "number"}`,
+			http.StatusCreated, `"type": "number"`},
+		{"set values", http.MethodPatch, "/v1/contacts/1", `{"custom": {"tier": "gold", "employees": 12}}`,
+			http.StatusOK, `"tier": "gold"`},
+		{"unknown field", http.MethodPatch, "/v1/contacts/1", `{"custom": {"color": "red"}}`,
+			http.StatusUnprocessableEntity, `"custom.color": "is not a known custom field"`},
+		{"wrong type", http.MethodPatch, "/v1/contacts/1", `{"custom": {"employees": "twelve"}}`,
+			http.StatusUnprocessableEntity, `"custom.employees": "must be a number"`},
+		{"value not in enum", http.MethodPatch, "/v1/contacts/1", `{"custom": {"tier": "bronze"}}`,
+			http.StatusUnprocessableEntity, `"custom.tier": "must be one of the field's enum values"`},
+		{"make required while missing", http.MethodPatch, "/v1/fields/employees", `{"required": true}`,
+			http.StatusConflict, `the change would make the value of 1 contacts invalid`},
+		{"remove enum value in use", http.MethodPatch, "/v1/fields/tier", `{"enum_values": ["silver"]}`,
+			http.StatusConflict, `the change would make the value of 1 contacts invalid`},
+		{"add enum value", http.MethodPatch, "/v1/fields/tier", `{"enum_values": ["gold", "silver", "bronze"]}`,
+			http.StatusOK, `"bronze"`},
+		{"set missing value", http.MethodPatch, "/v1/contacts/2", `{"custom": {"employees": 3}}`,
+			http.StatusOK, `"employees": 3`},
+		{"make required", http.MethodPatch, "/v1/fields/employees", `{"required": true}`,
+			http.StatusOK, `"required": true`},
+		{"missing required", http.MethodPost, "/v1/contacts", `{"first_name": "Ana", "last_name": "Anic", "telephone": "+38163111222"}`,
+			http.StatusUnprocessableEntity, `"custom.employees": "must be provided"`},
+		{"change type", http.MethodPatch, "/v1/fields/tier", `{"type": "bool"}`,
+			http.StatusBadRequest, `unknown key`},
+		{"delete", http.MethodDelete, "/v1/fields/tier", "",
+			http.StatusOK, `successfully deleted`},
+		{"values removed with field", http.MethodGet, "/v1/contacts/1", "",
+			http.StatusOK, `"custom": {
+			"employees": 12
+		}`},
+		{"list", http.MethodGet, "/v1/fields", "",
+			http.StatusOK, `"name": "employees"`},
+		{"show deleted", http.MethodGet, "/v1/fields/tier", "",
+			http.StatusNotFound, `could not be found`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			code, _, body := ts.request(t, tc.method, tc.urlPath, tc.body, nil)
+
+			if code != tc.wantCode {
+				t.Errorf("want %d; got %d", tc.wantCode, code)
+			}
+			if !strings.Contains(string(body), tc.wantBody) {
+				t.Errorf("want body to contain %q; got %q", tc.wantBody, body)
+			}
+		})
+	}
+}
+
+// Testing that vCard imports and CardDAV writes, which can not carry custom values, are not refused
+// for lacking the values of required fields, while the values contacts have are kept
+func TestRequiredFieldsOverVCard(t *testing.T) {
+	app := newTestApp()
+	app.useStore(data.NewMemoryStore(testContacts))
+	ts := newTestServer(app.routes())
+	defer ts.Close()
+
+	steps := []struct {
+		method   string
+		urlPath  string
+		body     string
+		wantCode int
+	}{
+		{http.MethodPost, "/v1/fields", `{"name": "employees", "type": "number"}`, http.StatusCreated},
+		{http.MethodPatch, "/v1/contacts/1", `{"custom": {"employees": 12}}`, http.StatusOK},
+		{http.MethodPatch, "/v1/contacts/2", `{"custom": {"employees": 3}}`, http.StatusOK},
+		{http.MethodPatch, "/v1/fields/employees", `{"required": true}`, http.StatusOK},
+	}
+	for _, step := range steps {
+		if code, _, body := ts.request(t, step.method, step.urlPath, step.body, nil); code != step.wantCode {
+			t.Fatalf("%s %s: want %d; got %d, %q", step.method, step.urlPath, step.wantCode, code, body)
+		}
+	}
+
+	vcardBody := http.Header{"Content-Type": {"text/vcard; charset=utf-8"}}
+	card := "BEGIN:VCARD\r\nVERSION:3.0\r\nFN:Ana Anic\r\nN:Anic;Ana;;;\r\nTEL;TYPE=cell:+381 64 598 332\r\nEND:VCARD\r\n"
+
+	code, _, body := ts.request(t, http.MethodPost, "/v1/contacts/import", card, vcardBody)
+	if code != http.StatusOK || !strings.Contains(string(body), `"created": 1`) {
+		t.Errorf("want the card imported; got %d, %q", code, body)
+	}
+
+	updated := "BEGIN:VCARD\r\nVERSION:3.0\r\nFN:Veljko Ilic\r\nN:Ilic;Veljko;;;\r\nTEL;TYPE=cell:+381 63 577 442\r\nEMAIL:veljko@example.com\r\nEND:VCARD\r\n"
+	if code, _, body := ts.request(t, http.MethodPut, davAddressBook+"1.vcf", updated, vcardBody); code != http.StatusNoContent {
+		t.Errorf("want %d; got %d, %q", http.StatusNoContent, code, body)
+	}
+
+	code, _, body = ts.get(t, "/v1/contacts/1")
+	if code != http.StatusOK || !strings.Contains(string(body), `"employees": 12`) || !strings.Contains(string(body), "veljko@example.com") {
+		t.Errorf("want the card applied and the custom value kept; got %d, %q", code, body)
+	}
+}
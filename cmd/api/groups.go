@@ -0,0 +1,349 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"salestrekker_technical_interview.veljkoilic/internal/data"
+	"salestrekker_technical_interview.veljkoilic/internal/validator"
+)
+
+// Most contacts a single membership request can add to a group
+const maxMembersPerRequest = 100
+
+// Handler for creating a group, which starts without members
+func (app *application) createGroupHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	group := &data.Group{Name: input.Name, Description: input.Description}
+
+	v := validator.New()
+	if data.ValidateGroup(v, group); !v.IsValid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.groups(r).InsertGroup(group)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateGroup):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("%s/groups/%d", routePrefix(r), group.ID))
+	headers.Set("ETag", groupETag(group))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"group": group}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Send all the groups to the user
+func (app *application) listGroupsHandler(w http.ResponseWriter, r *http.Request) {
+	groups, err := app.groups(r).ListGroups()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"groups": groups}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Show the group with the ID provided by the client
+func (app *application) showGroupHandler(w http.ResponseWriter, r *http.Request) {
+	group, ok := app.readGroup(w, r)
+	if !ok {
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", groupETag(group))
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"group": group}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Handler for renaming the group or changing its description. Only the fields present
+// in the request body are changed, the members are managed by the membership endpoints.
+func (app *application) updateGroupHandler(w http.ResponseWriter, r *http.Request) {
+	group, ok := app.readGroup(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Name        *string `json:"name"`
+		Description *string `json:"description"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if match := r.Header.Get("If-Match"); match != "" && !etagMatches(match, groupETag(group), false) {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+
+	if input.Name != nil {
+		group.Name = *input.Name
+	}
+	if input.Description != nil {
+		group.Description = *input.Description
+	}
+
+	v := validator.New()
+	if data.ValidateGroup(v, group); !v.IsValid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.groups(r).UpdateGroup(group)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrDuplicateGroup):
+			app.badRequestResponse(w, r, err)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", groupETag(group))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"group": group}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Delete the group with the ID provided by the client. Its members are not deleted.
+func (app *application) deleteGroupHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Without If-Match any version of the group is deleted
+	version := data.AnyVersion
+
+	if match := r.Header.Get("If-Match"); match != "" {
+		group, ok := app.readGroup(w, r)
+		if !ok {
+			return
+		}
+
+		if !etagMatches(match, groupETag(group), false) {
+			app.preconditionFailedResponse(w, r)
+			return
+		}
+		version = group.Version
+	}
+
+	err = app.groups(r).DeleteGroup(id, version)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "group successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Envelope one page of the members of the group and send them to the user
+func (app *application) listGroupContactsHandler(w http.ResponseWriter, r *http.Request) {
+	group, ok := app.readGroup(w, r)
+	if !ok {
+		return
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	var filters data.Filters
+	filters.Page = app.readInt(qs, "page", 1, v)
+	filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	filters.Sort = app.readString(qs, "sort", "id")
+	filters.SortSafelist = contactSortSafelist
+
+	if data.ValidateFilters(v, filters); !v.IsValid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	contacts, metadata, err := app.contacts(r).FilterContacts(data.ContactFilter{Group: group.ID}, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"contacts": contacts, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Add the contacts listed in the request body to the group. Contacts which are
+// already members are left as they are, so the request can be safely repeated.
+func (app *application) addGroupContactsHandler(w http.ResponseWriter, r *http.Request) {
+	group, ok := app.readGroup(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		ContactIDs []int64 `json:"contact_ids"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(len(input.ContactIDs) > 0, "contact_ids", "must contain at least one contact id")
+	v.Check(len(input.ContactIDs) <= maxMembersPerRequest, "contact_ids", fmt.Sprintf("must not contain more than %d entries", maxMembersPerRequest))
+
+	// every contact is checked first, so the response names each one which does not exist.
+	// The contacts are then added in a single change, all of them or none.
+	for i, contactID := range input.ContactIDs {
+		_, err := app.contacts(r).GetContact(contactID)
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError(fmt.Sprintf("contact_ids[%d]", i), "contact does not exist")
+		case err != nil:
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	if !v.IsValid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.groups(r).AddMembers(group.ID, input.ContactIDs)
+	if err != nil {
+		switch {
+		// the group or one of the contacts was deleted since they were checked
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.sendGroup(w, r, group.ID)
+}
+
+// Remove the contact with the contact_id in the path from the group
+func (app *application) removeGroupContactHandler(w http.ResponseWriter, r *http.Request) {
+	groupID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	contactID, err := app.readNamedIDParam(r, "contact_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.groups(r).RemoveMember(groupID, contactID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.sendGroup(w, r, groupID)
+}
+
+// Fetch the group with the ID in the path. If it can not be fetched the error response
+// is sent and false is returned.
+func (app *application) readGroup(w http.ResponseWriter, r *http.Request) (*data.Group, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	group, err := app.groups(r).GetGroup(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return group, true
+}
+
+// Send the current state of the group, after its members have changed
+func (app *application) sendGroup(w http.ResponseWriter, r *http.Request, id int64) {
+	group, err := app.groups(r).GetGroup(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", groupETag(group))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"group": group}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
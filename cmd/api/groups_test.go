@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http"
+	"salestrekker_technical_interview.veljkoilic/internal/data"
+	"strings"
+	"testing"
+)
+
+func TestGroups(t *testing.T) {
+	app := newTestApp()
+	app.useStore(data.NewMemoryStore(testContacts))
+	ts := newTestServer(app.routes())
+	defer ts.Close()
+
+	testCases := []struct {
+		name     string
+		method   string
+		urlPath  string
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{"create", http.MethodPost, "/v1/groups", `{"name": "Suppliers"}`,
+			http.StatusCreated, `"contact_ids": []`},
+		{"create without name", http.MethodPost, "/v1/groups", `{"description": "Nameless"}`,
+			http.StatusUnprocessableEntity, `"name": "must be provided"`},
+		{"create duplicate", http.MethodPost, "/v1/groups", `{"name": "Suppliers"}`,
+			http.StatusBadRequest, `already exists`},
+		{"add members", http.MethodPost, "/v1/groups/1/contacts", `{"contact_ids": [2, 1]}`,
+			http.StatusOK, `"contact_ids": [
+			1,
+			2
+		]`},
+		{"add missing member", http.MethodPost, "/v1/groups/1/contacts", `{"contact_ids": [1, 7]}`,
+			http.StatusUnprocessableEntity, `"contact_ids[1]": "contact does not exist"`},
+		{"add to missing group", http.MethodPost, "/v1/groups/9/contacts", `{"contact_ids": [1]}`,
+			http.StatusNotFound, `could not be found`},
+		{"list members", http.MethodGet, "/v1/groups/1/contacts?sort=-id", "",
+			http.StatusOK, `"total_records": 2`},
+		{"filter contacts by group", http.MethodGet, "/v1/contacts?group=1&last_name=mark", "",
+			http.StatusOK, `"total_records": 1`},
+		{"tag contact", http.MethodPatch, "/v1/contacts/2", `{"tags": ["supplier", "Supplier", "vip"]}`,
+			http.StatusOK, `"tags": [
+			"supplier",
+			"vip"
+		]`},
+		{"filter contacts by tag", http.MethodGet, "/v1/contacts?tag=VIP", "",
+			http.StatusOK, `"first_name": "Marko"`},
+		{"delete member contact", http.MethodDelete, "/v1/contacts/2", "",
+			http.StatusOK, `successfully deleted`},
+		{"member removed with contact", http.MethodGet, "/v1/groups/1", "",
+			http.StatusOK, `"contact_ids": [
+			1
+		]`},
+		{"remove member", http.MethodDelete, "/v1/groups/1/contacts/1", "",
+			http.StatusOK, `"contact_ids": []`},
+		{"remove missing member", http.MethodDelete, "/v1/groups/1/contacts/1", "",
+			http.StatusNotFound, `could not be found`},
+		{"rename", http.MethodPatch, "/v1/groups/1", `{"name": "Belgrade office"}`,
+			http.StatusOK, `"name": "Belgrade office"`},
+		{"list", http.MethodGet, "/v1/groups", "",
+			http.StatusOK, `"name": "Belgrade office"`},
+		{"delete", http.MethodDelete, "/v1/groups/1", "",
+			http.StatusOK, `successfully deleted`},
+		{"show deleted", http.MethodGet, "/v1/groups/1", "",
+			http.StatusNotFound, `could not be found`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			code, _, body := ts.request(t, tc.method, tc.urlPath, tc.body, nil)
+
+			if code != tc.wantCode {
+				t.Errorf("want %d; got %d", tc.wantCode, code)
+			}
+			if !strings.Contains(string(body), tc.wantBody) {
+				t.Errorf("want body to contain %q; got %q", tc.wantBody, body)
+			}
+		})
+	}
+}
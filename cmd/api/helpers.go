@@ -1,32 +1,158 @@
 package main
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/julienschmidt/httprouter"
 	"io"
+	"mime"
 	"net/http"
+	"net/url"
+	"salestrekker_technical_interview.veljkoilic/internal/data"
+	"salestrekker_technical_interview.veljkoilic/internal/validator"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // Read ID parameter from the Request passed in to the function, and return that ID
 func (app *application) readIDParam(r *http.Request) (int64, error) {
+	return app.readNamedIDParam(r, "id")
+}
+
+// Read the ID held by the URL parameter with the given name, for routes with more than one ID in the path
+func (app *application) readNamedIDParam(r *http.Request, name string) (int64, error) {
 	// http routers interpolated URL parameters are stored in the request context
 	// retrieve a slice containing those parameters
 	params := httprouter.ParamsFromContext(r.Context())
 
-	id, err := strconv.ParseInt(params.ByName("id"), 10, 64)
+	id, err := strconv.ParseInt(params.ByName(name), 10, 64)
 	if err != nil || id < 1 {
-		return 0, errors.New("invalid id parameter")
+		return 0, fmt.Errorf("invalid %s parameter", name)
 	}
 
 	return id, nil
 }
 
+// Build the ETag of a contact from its version
+func contactETag(contact *data.Contact) string {
+	return fmt.Sprintf(`"%d"`, contact.Version)
+}
+
+// Build the ETag of a group from its version
+func groupETag(group *data.Group) string {
+	return fmt.Sprintf(`"%d"`, group.Version)
+}
+
+// Build the ETag of a custom field from its version
+func fieldETag(field *data.Field) string {
+	return fmt.Sprintf(`"%d"`, field.Version)
+}
+
+// Pick the offered media type the client prefers, going by the Accept header, and return it
+// together with the parameters of the media range it matched, like version in text/vcard;version=3.0.
+// The first offer is returned when the header is missing or accepts none of the offers.
+func negotiateContentType(r *http.Request, offers ...string) (string, map[string]string) {
+	best, bestQ, bestParams := offers[0], 0.0, map[string]string{}
+
+	for _, offer := range offers {
+		// the most specific range which matches the offer decides its quality
+		q, specificity, params := 0.0, -1, map[string]string{}
+
+		for accepted := range strings.SplitSeq(r.Header.Get("Accept"), ",") {
+			mediaType, rangeParams, err := mime.ParseMediaType(accepted)
+			if err != nil {
+				continue
+			}
+
+			var rangeSpecificity int
+			switch {
+			case mediaType == offer:
+				rangeSpecificity = 2
+			case strings.HasSuffix(mediaType, "/*") && strings.HasPrefix(offer, strings.TrimSuffix(mediaType, "*")):
+				rangeSpecificity = 1
+			case mediaType == "*/*":
+				rangeSpecificity = 0
+			default:
+				continue
+			}
+			if rangeSpecificity <= specificity {
+				continue
+			}
+
+			rangeQ := 1.0
+			if value, ok := rangeParams["q"]; ok {
+				rangeQ, err = strconv.ParseFloat(value, 64)
+				if err != nil {
+					continue
+				}
+			}
+			q, specificity, params = rangeQ, rangeSpecificity, rangeParams
+		}
+
+		if q > bestQ {
+			best, bestQ, bestParams = offer, q, params
+		}
+	}
+
+	return best, bestParams
+}
+
+// Report whether the value of an If-Match or If-None-Match header matches etag.
+// The header holds "*" or a comma-separated list of entity tags. Unless weak is set,
+// weak tags (W/"...") never match, as RFC 9110 requires for If-Match.
+func etagMatches(header, etag string, weak bool) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+
+		if strings.HasPrefix(tag, "W/") {
+			if !weak {
+				continue
+			}
+			tag = strings.TrimPrefix(tag, "W/")
+		}
+
+		if tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
 type envelope map[string]any
 
+// nullable records whether a JSON field was present in the request body at all, so a field
+// set to null (clear the value) can be told apart from a missing one (keep the value)
+type nullable[T any] struct {
+	Set   bool
+	Value *T
+}
+
+func (n *nullable[T]) UnmarshalJSON(b []byte) error {
+	n.Set = true
+
+	if string(b) == "null" {
+		n.Value = nil
+		return nil
+	}
+
+	var value T
+	err := json.Unmarshal(b, &value)
+	if err != nil {
+		return err
+	}
+	n.Value = &value
+	return nil
+}
+
 // Create a JSON response, based on the parameters passed to the function, and write it to the ResponseWriter
 func (app *application) writeJSON(w http.ResponseWriter, status int, data envelope, headers http.Header) error {
 
@@ -108,3 +234,97 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any
 
 	return nil
 }
+
+// Return a string value from the query string, or the provided default value if no matching key is found
+func (app *application) readString(qs url.Values, key string, defaultValue string) string {
+	s := qs.Get(key)
+
+	if s == "" {
+		return defaultValue
+	}
+
+	return s
+}
+
+// Read a string value from the query string and convert it to an integer before returning.
+// If no matching key is found the default value is returned. If the value couldn't be converted
+// to an integer, the error message is recorded in the Validator instance.
+func (app *application) readInt(qs url.Values, key string, defaultValue int, v *validator.Validator) int {
+	s := qs.Get(key)
+
+	if s == "" {
+		return defaultValue
+	}
+
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		v.AddError(key, "must be an integer value")
+		return defaultValue
+	}
+
+	return i
+}
+
+// Create an opaque cursor pointing after the contact with the given id.
+// The cursor holds the id followed by an HMAC of it, so clients can not forge cursors.
+func (app *application) encodeCursor(id int64) string {
+	buf := binary.BigEndian.AppendUint64(nil, uint64(id))
+	buf = append(buf, app.cursorMAC(buf)...)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+// Return the id a cursor created by encodeCursor points after
+func (app *application) decodeCursor(cursor string) (int64, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(buf) != 8+cursorMACSize {
+		return 0, errors.New("invalid cursor")
+	}
+
+	if !hmac.Equal(buf[8:], app.cursorMAC(buf[:8])) {
+		return 0, errors.New("invalid cursor")
+	}
+
+	id := int64(binary.BigEndian.Uint64(buf[:8]))
+	if id < 1 {
+		return 0, errors.New("invalid cursor")
+	}
+
+	return id, nil
+}
+
+// Size of the truncated HMAC carried in cursors
+const cursorMACSize = 16
+
+func (app *application) cursorMAC(payload []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(app.config.cursor.secret))
+	mac.Write(payload)
+	return mac.Sum(nil)[:cursorMACSize]
+}
+
+// How long a streamed response may take to hand a single chunk over to the client
+const streamWriteTimeout = 30 * time.Second
+
+// streamWriter writes the body of a streamed response, such as a large export, pushing the write deadline
+// forward before every chunk. The whole response may take longer than the server's write timeout, but
+// a client which stops reading is cut off once a chunk waits longer than streamWriteTimeout.
+type streamWriter struct {
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+func newStreamWriter(w http.ResponseWriter) *streamWriter {
+	return &streamWriter{w: w, rc: http.NewResponseController(w)}
+}
+
+func (sw *streamWriter) Write(p []byte) (int, error) {
+	err := sw.rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return 0, err
+	}
+	return sw.w.Write(p)
+}
+
+// Send what was written so far to the client
+func (sw *streamWriter) Flush() error {
+	return sw.rc.Flush()
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"salestrekker_technical_interview.veljkoilic/internal/data"
+	"salestrekker_technical_interview.veljkoilic/internal/validator"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Default path of the file the API keys are kept in
+const defaultKeysFile = "keys.json"
+
+const keysUsage = `usage:
+  api keys create -name NAME [-role ROLE | -scopes PERMISSION[,PERMISSION...]] [-tenant TENANT] [-keys-file PATH]
+  api keys list [-keys-file PATH]
+  api keys revoke [-keys-file PATH] ID
+
+roles: viewer, editor, manager, monitoring, admin, superuser
+permissions: contacts:read, contacts:write, contacts:delete, contacts:export, metrics:read, admin, superuser`
+
+// Run the keys subcommand, which mints, lists and revokes API keys. args are the arguments
+// after "keys". Keys and tables are written to stdout, usage and flag errors to stderr.
+func runKeysCommand(args []string, stdout, stderr io.Writer) error {
+	if len(args) == 0 {
+		fmt.Fprintln(stderr, keysUsage)
+		return errors.New("missing keys command")
+	}
+
+	fs := flag.NewFlagSet("keys "+args[0], flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() { fmt.Fprintln(stderr, keysUsage) }
+
+	keysFile := fs.String("keys-file", defaultKeysFile, "Path to the file the API keys are kept in")
+
+	switch args[0] {
+	case "create":
+		name := fs.String("name", "", "Name telling what the key is used for")
+		role := fs.String("role", "", "Role whose permissions the key gets, "+data.DefaultRole+" when no scopes are given either")
+		scopes := fs.String("scopes", "", "Comma separated permissions of the key")
+		tenant := fs.String("tenant", data.DefaultTenant, "Tenant whose contacts the key works with")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+
+		key := &data.APIKey{Name: strings.TrimSpace(*name), Tenant: *tenant}
+		switch {
+		case *role != "" && *scopes != "":
+			return errors.New("a key is given either a role or scopes, not both")
+		case *scopes != "":
+			for scope := range strings.SplitSeq(*scopes, ",") {
+				key.Permissions = append(key.Permissions, strings.TrimSpace(scope))
+			}
+		default:
+			if *role == "" {
+				*role = data.DefaultRole
+			}
+			permissions, ok := data.RolePermissions(*role)
+			if !ok {
+				return fmt.Errorf("unknown role %q", *role)
+			}
+			key.Permissions = permissions
+		}
+
+		v := validator.New()
+		if data.ValidateAPIKey(v, key); !v.IsValid() {
+			return fmt.Errorf("invalid key: %s", validationDescription(v.Errors))
+		}
+
+		plaintext, err := data.NewKeyFile(*keysFile).Mint(key)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(stdout, "Created key %s (%s) for tenant %s with scopes %s\n", key.ID, key.Name, key.Tenant, strings.Join(key.Permissions, ", "))
+		fmt.Fprintf(stdout, "%s\n", plaintext)
+		fmt.Fprintln(stdout, "Store the key now, it can not be shown again.")
+		return nil
+
+	case "list":
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+
+		keys, err := data.NewKeyFile(*keysFile).List()
+		if err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tNAME\tTENANT\tSCOPES\tCREATED")
+		for _, key := range keys {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", key.ID, key.Name, key.Tenant, strings.Join(key.Permissions, ","), key.CreatedAt.Format(time.RFC3339))
+		}
+		return tw.Flush()
+
+	case "revoke":
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if fs.NArg() != 1 {
+			fs.Usage()
+			return errors.New("revoke takes the id of a single key")
+		}
+
+		err := data.NewKeyFile(*keysFile).Revoke(fs.Arg(0))
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return fmt.Errorf("no key with id %s", fs.Arg(0))
+		} else if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(stdout, "Revoked key %s\n", fs.Arg(0))
+		return nil
+
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown keys command %q", args[0])
+	}
+}
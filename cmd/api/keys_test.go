@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"path/filepath"
+	"salestrekker_technical_interview.veljkoilic/internal/data"
+	"strings"
+	"testing"
+)
+
+// Create a test app which requires API keys, with a key minted for every set of permissions
+func newTestAppWithKeys(t *testing.T, permissions ...data.Permissions) (*application, []string) {
+	t.Helper()
+
+	app := newTestApp()
+	app.useStore(data.NewMemoryStore(testContacts))
+	app.config.auth.enabled = true
+	app.keys = data.NewKeyFile(filepath.Join(t.TempDir(), "keys.json"))
+
+	var plaintexts []string
+	for _, p := range permissions {
+		plaintext, err := app.keys.Mint(&data.APIKey{Name: strings.Join(p, " "), Permissions: p})
+		if err != nil {
+			t.Fatal(err)
+		}
+		plaintexts = append(plaintexts, plaintext)
+	}
+	return app, plaintexts
+}
+
+func TestAPIKeyAuthentication(t *testing.T) {
+	app, keys := newTestAppWithKeys(t,
+		data.Permissions{data.PermissionContactsRead},
+		data.Permissions{data.PermissionContactsRead, data.PermissionContactsWrite},
+		data.Permissions{data.PermissionContactsDelete},
+		data.Permissions{data.PermissionAdmin},
+	)
+	reader, writer, deleter, admin := keys[0], keys[1], keys[2], keys[3]
+
+	ts := newTestServer(app.routes())
+	defer ts.Close()
+
+	testCases := []struct {
+		name      string
+		method    string
+		path      string
+		headers   http.Header
+		wantCode  int
+		wantScope string
+	}{
+		{"healthcheck is public", http.MethodGet, "/v1/healthcheck", nil, http.StatusOK, ""},
+		{"no key", http.MethodGet, "/v1/contacts", nil, http.StatusUnauthorized, ""},
+		{"unknown key", http.MethodGet, "/v1/contacts", http.Header{"X-Api-Key": {data.APIKeyPrefix + "nope"}}, http.StatusUnauthorized, ""},
+		{"other scheme", http.MethodGet, "/v1/contacts", http.Header{"Authorization": {"Digest " + reader}}, http.StatusUnauthorized, ""},
+		{"bearer", http.MethodGet, "/v1/contacts", http.Header{"Authorization": {"Bearer " + reader}}, http.StatusOK, ""},
+		{"header", http.MethodGet, "/v1/contacts/1", http.Header{"X-Api-Key": {reader}}, http.StatusOK, ""},
+		{"read key can not write", http.MethodPost, "/v1/contacts", http.Header{"X-Api-Key": {reader}}, http.StatusForbidden, data.PermissionContactsWrite},
+		{"write key can not delete", http.MethodDelete, "/v1/contacts/1", http.Header{"X-Api-Key": {writer}}, http.StatusForbidden, data.PermissionContactsDelete},
+		{"write key can not change the schema", http.MethodPost, "/v1/fields", http.Header{"X-Api-Key": {writer}}, http.StatusForbidden, data.PermissionSuperuser},
+		{"admin key can not change the schema", http.MethodPost, "/v1/fields", http.Header{"X-Api-Key": {admin}}, http.StatusForbidden, data.PermissionSuperuser},
+		{"delete key can not read", http.MethodGet, "/v1/contacts", http.Header{"X-Api-Key": {deleter}}, http.StatusForbidden, data.PermissionContactsRead},
+		{"delete key deletes", http.MethodDelete, "/v1/contacts/2", http.Header{"X-Api-Key": {deleter}}, http.StatusOK, ""},
+		{"admin writes", http.MethodDelete, "/v1/contacts/1", http.Header{"X-Api-Key": {admin}}, http.StatusOK, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			code, headers, body := ts.request(t, tc.method, tc.path, "", tc.headers)
+
+			if code != tc.wantCode {
+				t.Errorf("want %d; got %d, %q", tc.wantCode, code, body)
+			}
+
+			challenges := strings.Join(headers.Values("WWW-Authenticate"), ", ")
+			switch tc.wantCode {
+			case http.StatusUnauthorized:
+				if !strings.Contains(challenges, `Bearer realm="contacts"`) || !strings.Contains(challenges, `Basic realm="contacts"`) {
+					t.Errorf("want Bearer and Basic challenges; got %q", challenges)
+				}
+			case http.StatusForbidden:
+				if want := `scope="` + tc.wantScope + `"`; !strings.Contains(challenges, want) {
+					t.Errorf("want %s in the challenge; got %q", want, challenges)
+				}
+			}
+		})
+	}
+}
+
+// CardDAV clients send the key as the password of Basic authentication
+func TestAPIKeyBasicAuth(t *testing.T) {
+	app, keys := newTestAppWithKeys(t, data.Permissions{data.PermissionContactsRead})
+	ts := newTestServer(app.routes())
+	defer ts.Close()
+
+	req, err := http.NewRequest("PROPFIND", ts.URL+davAddressBook, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.SetBasicAuth("phone", keys[0])
+
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs.Body.Close()
+
+	if rs.StatusCode != http.StatusMultiStatus {
+		t.Errorf("want %d; got %d", http.StatusMultiStatus, rs.StatusCode)
+	}
+}
+
+func TestKeysCommand(t *testing.T) {
+	keysFile := filepath.Join(t.TempDir(), "keys.json")
+
+	run := func(args ...string) (string, error) {
+		var stdout, stderr bytes.Buffer
+		err := runKeysCommand(args, &stdout, &stderr)
+		return stdout.String(), err
+	}
+
+	if _, err := run("create", "-keys-file", keysFile, "-name", "ci", "-scopes", "contacts:read,contacts:purge"); err == nil {
+		t.Errorf("want an unknown permission refused")
+	}
+	if _, err := run("create", "-keys-file", keysFile, "-name", "ci", "-role", "intern"); err == nil {
+		t.Errorf("want an unknown role refused")
+	}
+	if _, err := run("create", "-keys-file", keysFile, "-name", "ci", "-role", "editor", "-scopes", "admin"); err == nil {
+		t.Errorf("want a role and scopes together refused")
+	}
+
+	out, err := run("create", "-keys-file", keysFile, "-name", "ci", "-scopes", "contacts:read, contacts:write")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := strings.Fields(out)
+	if len(fields) < 3 || !strings.Contains(out, data.APIKeyPrefix) {
+		t.Fatalf("want the id and the key printed; got %q", out)
+	}
+	id := fields[2]
+
+	key, err := data.NewKeyFile(keysFile).Authenticate(strings.Split(out, "\n")[1])
+	if err != nil || key.ID != id || !key.Permissions.Include(data.PermissionContactsWrite) {
+		t.Errorf("want the printed key to authenticate as %s; got %+v, %v", id, key, err)
+	}
+
+	out, err = run("list", "-keys-file", keysFile)
+	if err != nil || !strings.Contains(out, id) || !strings.Contains(out, "contacts:read,contacts:write") {
+		t.Errorf("want the key listed; got %q, %v", out, err)
+	}
+
+	out, err = run("create", "-keys-file", keysFile, "-name", "backup", "-role", "manager")
+	if err != nil || !strings.Contains(out, "contacts:delete") {
+		t.Errorf("want the key given the permissions of the role; got %q, %v", out, err)
+	}
+
+	if _, err := run("create", "-keys-file", keysFile, "-name", "sales", "-tenant", "Sales Team"); err == nil {
+		t.Errorf("want an invalid tenant refused")
+	}
+	out, err = run("create", "-keys-file", keysFile, "-name", "sales", "-tenant", "sales")
+	if err != nil || !strings.Contains(out, "for tenant sales") {
+		t.Errorf("want the key created for the tenant; got %q, %v", out, err)
+	}
+
+	if _, err := run("revoke", "-keys-file", keysFile, id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := run("revoke", "-keys-file", keysFile, id); err == nil {
+		t.Errorf("want revoking a missing key to fail")
+	}
+
+	out, err = run("list", "-keys-file", keysFile)
+	if err != nil || strings.Contains(out, id) {
+		t.Errorf("want the revoked key gone; got %q, %v", out, err)
+	}
+
+	if _, err := run("rotate"); err == nil {
+		t.Errorf("want an unknown command refused")
+	}
+}
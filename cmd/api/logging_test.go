@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNewLogger(t *testing.T) {
+	testCases := []struct {
+		format string
+		level  string
+		valid  bool
+	}{
+		{"text", "info", true},
+		{"json", "DEBUG", true},
+		{"json", "warn", true},
+		{"xml", "info", false},
+		{"text", "verbose", false},
+	}
+
+	for _, tc := range testCases {
+		_, err := newLogger(&bytes.Buffer{}, tc.format, tc.level)
+		if (err == nil) != tc.valid {
+			t.Errorf("%s %s: want valid %v; got %v", tc.format, tc.level, tc.valid, err)
+		}
+	}
+
+	var buf bytes.Buffer
+	logger, err := newLogger(&buf, "json", "warn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("left out")
+	logger.Warn("kept", "key", "value")
+
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil || line["msg"] != "kept" || line["key"] != "value" {
+		t.Errorf("want only the warning logged as JSON; got %q, %v", buf.String(), err)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	app := newTestApp()
+	ts := newTestServer(app.routes())
+	defer ts.Close()
+
+	testCases := []struct {
+		name   string
+		sent   string
+		keptAs string
+	}{
+		{"none", "", ""},
+		{"kept", "4bf92f3577b34da6-a3ce929d0e0e4736", "4bf92f3577b34da6-a3ce929d0e0e4736"},
+		{"spaces", "not an id", ""},
+		{"too long", strings.Repeat("a", 129), ""},
+	}
+
+	for _, tc := range testCases {
+		headers := http.Header{}
+		if tc.sent != "" {
+			headers.Set("X-Request-ID", tc.sent)
+		}
+
+		_, rsHeaders, _ := ts.request(t, http.MethodGet, "/v1/healthcheck", "", headers)
+		got := rsHeaders.Get("X-Request-ID")
+
+		switch {
+		case tc.keptAs != "" && got != tc.keptAs:
+			t.Errorf("%s: want %q; got %q", tc.name, tc.keptAs, got)
+		case tc.keptAs == "" && (got == "" || got == tc.sent):
+			t.Errorf("%s: want a new ID; got %q", tc.name, got)
+		}
+	}
+}
+
+// Testing that every request is logged once it is answered
+func TestAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	app := newTestApp()
+	app.logger = slog.New(slog.NewJSONHandler(&buf, nil))
+
+	ts := newTestServer(app.routes())
+	defer ts.Close()
+
+	code, _, body := ts.request(t, http.MethodGet, "/v1/contacts/99?fields=id", "", http.Header{"X-Request-ID": {"req-1"}})
+	if code != http.StatusNotFound {
+		t.Fatalf("want %d; got %d", http.StatusNotFound, code)
+	}
+
+	var line struct {
+		Level     string  `json:"level"`
+		Msg       string  `json:"msg"`
+		Method    string  `json:"method"`
+		URL       string  `json:"url"`
+		Status    int     `json:"status"`
+		Bytes     int     `json:"bytes"`
+		Latency   float64 `json:"latency"`
+		Client    string  `json:"client"`
+		RequestID string  `json:"request_id"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("want a JSON log line; got %q, %v", buf.String(), err)
+	}
+
+	if line.Level != "INFO" || line.Msg != "request" || line.Method != http.MethodGet || line.URL != "/v1/contacts/99?fields=id" ||
+		line.Status != http.StatusNotFound || line.Bytes != len(body) || line.Latency <= 0 ||
+		line.Client != "127.0.0.1" || line.RequestID != "req-1" {
+		t.Errorf("want the request logged; got %+v", line)
+	}
+}
+
+// Testing that errors are logged with the request they happened in
+func TestLogError(t *testing.T) {
+	var buf bytes.Buffer
+	app := newTestApp()
+	app.logger = slog.New(slog.NewTextHandler(&buf, nil))
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/contacts/import?duplicates=skip", nil)
+	r = app.contextSetRequestID(r, "req-2")
+	app.serverErrorResponse(httptest.NewRecorder(), r, errors.New("disk full"))
+
+	for _, want := range []string{"level=ERROR", `msg="disk full"`, "method=POST", `url="/v1/contacts/import?duplicates=skip"`, "request_id=req-2"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("want %s logged; got %q", want, buf.String())
+		}
+	}
+}
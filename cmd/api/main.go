@@ -1,61 +1,247 @@
 package main
 
 import (
+	"cmp"
+	"crypto/rand"
 	"flag"
 	"fmt"
-	"log"
-	"net/http"
+	"log/slog"
+	"net"
+	"net/netip"
 	"os"
 	"salestrekker_technical_interview.veljkoilic/internal/data"
+	"salestrekker_technical_interview.veljkoilic/internal/phonenumber"
+	"strings"
+	"sync"
 	"time"
 )
 
 const version = "1.0.0"
 
 type config struct {
-	port int
-	env  string
+	port    int
+	env     string
+	storage struct {
+		backend string
+		file    string
+		backups int
+		dsn     string
+	}
+	cursor struct {
+		secret string
+	}
+	auth struct {
+		enabled  bool
+		keysFile string
+	}
+	dev struct {
+		logTokens bool
+	}
+	phone struct {
+		region   string
+		carriers string
+	}
+	log struct {
+		format string
+		level  string
+	}
+	shutdown struct {
+		timeout time.Duration
+	}
+	limiter struct {
+		enabled        bool
+		rps            float64
+		burst          int
+		trustedProxies []netip.Prefix
+	}
 }
 
 type application struct {
 	config        config
 	contactsModel data.ContactsModel
-	logger        *log.Logger
+	groupsModel   data.GroupsModel
+	fieldsModel   data.FieldsModel
+	usersModel    data.UsersModel
+	keys          *data.KeyFile
+	logger        *slog.Logger
+	notifier      notifier
+	metrics       *appMetrics
+	// set by routes, nil when rate limiting is disabled
+	limiter *rateLimiter
+	// background goroutines, waited for on shutdown and told to stop by closing done
+	wg   sync.WaitGroup
+	done chan struct{}
 }
 
 func main() {
+	// API keys are managed with the keys subcommand, which does not start the server
+	if len(os.Args) > 1 && os.Args[1] == "keys" {
+		err := runKeysCommand(os.Args[2:], os.Stdout, os.Stderr)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	var cfg config
 
 	flag.IntVar(&cfg.port, "port", 4000, "API Server Point")
 	flag.StringVar(&cfg.env, "env", "development", "Environment (development|staging|production)")
+	flag.StringVar(&cfg.log.format, "log-format", "text", "Log format (text|json)")
+	flag.StringVar(&cfg.log.level, "log-level", "info", "Lowest level logged (debug|info|warn|error)")
+	flag.DurationVar(&cfg.shutdown.timeout, "shutdown-timeout", 30*time.Second, "How long requests in flight are waited for when the server shuts down")
+	flag.StringVar(&cfg.storage.backend, "storage", "json", "Storage backend (json|memory|sqlite)")
+	flag.StringVar(&cfg.storage.file, "storage-file", "contacts.json", "Path to the contacts file used by the json storage backend")
+	flag.IntVar(&cfg.storage.backups, "storage-backups", data.DefaultBackups, "Number of backup generations kept by the json storage backend")
+	flag.StringVar(&cfg.storage.dsn, "db-dsn", "file:contacts.db", "SQLite DSN used by the sqlite storage backend")
+	flag.StringVar(&cfg.cursor.secret, "cursor-secret", "", "Secret used to sign pagination cursors (random on every start if empty)")
+	flag.StringVar(&cfg.phone.region, "phone-region", "RS", "Region telephone numbers without a country code belong to (ISO 3166-1 alpha-2)")
+	flag.StringVar(&cfg.phone.carriers, "phone-carriers", "", "Path to a carrier prefix table replacing the built-in one")
+	flag.BoolVar(&cfg.auth.enabled, "auth", true, "Require an API key or a user's token for the contacts")
+	flag.StringVar(&cfg.auth.keysFile, "keys-file", defaultKeysFile, "Path to the file the API keys are kept in")
+	flag.BoolVar(&cfg.dev.logTokens, "dev-log-tokens", false, "Log activation tokens at the debug level (development only)")
+	flag.BoolVar(&cfg.limiter.enabled, "limiter-enabled", true, "Enable rate limiting")
+	flag.Float64Var(&cfg.limiter.rps, "limiter-rps", 2, "Rate limiter maximum requests per second")
+	flag.IntVar(&cfg.limiter.burst, "limiter-burst", 4, "Rate limiter maximum burst")
+	flag.Func("limiter-trusted-proxies", "Comma separated addresses or CIDR ranges of proxies whose X-Forwarded-For is trusted", func(s string) error {
+		proxies, err := parseTrustedProxies(s)
+		cfg.limiter.trustedProxies = proxies
+		return err
+	})
 	flag.Parse()
 
-	logger := log.New(os.Stdout, "", log.Ldate|log.Ltime)
+	logger, err := newLogger(os.Stdout, cfg.log.format, cfg.log.level)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if !phonenumber.IsRegion(cfg.phone.region) {
+		logger.Error("unsupported phone region", "region", cfg.phone.region)
+		os.Exit(1)
+	}
+	data.DefaultPhoneRegion = strings.ToUpper(cfg.phone.region)
+
+	if cfg.dev.logTokens && cfg.env != "development" {
+		logger.Error("-dev-log-tokens is only allowed with -env development")
+		os.Exit(1)
+	}
+
+	if cfg.limiter.enabled && (cfg.limiter.rps <= 0 || cfg.limiter.burst < 1) {
+		logger.Error("the rate limiter needs a positive -limiter-rps and a -limiter-burst of at least 1")
+		os.Exit(1)
+	}
+
+	if cfg.phone.carriers != "" {
+		err := loadCarriers(cfg.phone.carriers)
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+	}
+
+	// Without a configured secret cursors are only valid until the server restarts
+	if cfg.cursor.secret == "" {
+		secret := make([]byte, 32)
+		_, err := rand.Read(secret)
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+		cfg.cursor.secret = string(secret)
+	}
 
-	// Create and initialize contactsModel
+	// Open the storage backend selected by the flags and create contactsModel on top of it
 	// If initialization fails, we log it and exit the app
-	contactsModel := data.NewModel()
-	err := contactsModel.GetAllContacts()
+	metrics := newAppMetrics()
+	store, err := openStore(cfg, logger, metrics)
 	if err != nil {
-		logger.Fatal(err)
+		logger.Error(err.Error())
+		os.Exit(1)
 	}
+	contactsModel := data.NewModel(store)
+	groupsModel := data.NewGroupsModel(store)
+	fieldsModel := data.NewFieldsModel(store)
+	usersModel := data.NewUsersModel(store)
 
 	app := &application{
 		config:        cfg,
 		logger:        logger,
+		notifier:      &logNotifier{logger: logger, revealTokens: cfg.dev.logTokens},
+		metrics:       metrics,
 		contactsModel: contactsModel,
+		groupsModel:   groupsModel,
+		fieldsModel:   fieldsModel,
+		usersModel:    usersModel,
+		keys:          data.NewKeyFile(cfg.auth.keysFile),
+		done:          make(chan struct{}),
+	}
+	app.limiter = app.newClientLimiter()
+
+	if !cfg.auth.enabled {
+		logger.Warn("authentication is disabled, anyone who can reach the server can change the contacts")
+	} else if keys, err := app.keys.List(); err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	} else if len(keys) == 0 {
+		logger.Warn("no API keys, create one with: api keys create -name NAME -role superuser", "keys_file", cfg.auth.keysFile)
+	}
+
+	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.port))
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	// Serve until a signal shuts the server down, then close the store so nothing is left half written.
+	// The exit status tells the orchestrator whether everything was shut down cleanly.
+	err = app.serve(ln)
+	if err != nil {
+		logger.Error(err.Error())
 	}
+	if closeErr := store.Close(); closeErr != nil {
+		logger.Error("closing the store", "error", closeErr.Error())
+		err = cmp.Or(err, closeErr)
+	}
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+// Open the contacts store selected with the -storage flag. Saves of the json backend are recorded in the metrics.
+func openStore(cfg config, logger *slog.Logger, metrics *appMetrics) (data.ContactStore, error) {
+	switch cfg.storage.backend {
+	case "json":
+		store, err := data.NewJSONFileStore(cfg.storage.file, cfg.storage.backups)
+		if err != nil {
+			return nil, err
+		}
+		if store.RecoveredFrom != "" {
+			logger.Warn("contacts file is corrupt, contacts recovered from a backup", "file", cfg.storage.file, "backup", store.RecoveredFrom)
+		}
+		store.ObserveSave = metrics.observeSave
+		return store, nil
+	case "memory":
+		return data.NewMemoryStore(nil), nil
+	case "sqlite":
+		return data.NewSQLiteStore(cfg.storage.dsn)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.storage.backend)
+	}
+}
 
-	srv := &http.Server{
-		Addr:         fmt.Sprintf(":%d", cfg.port),
-		Handler:      app.routes(),
-		IdleTimeout:  time.Minute,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 30 * time.Second,
+// Replace the built-in carrier prefix table with the one in the file
+func loadCarriers(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
 	}
+	defer file.Close()
 
-	// Starting HTTP server
-	logger.Printf("Starting %s server on %s", cfg.env, srv.Addr)
-	err = srv.ListenAndServe()
-	logger.Fatal(err)
+	err = phonenumber.LoadCarriers(file)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
 }
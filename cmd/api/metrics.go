@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net/http"
+	"salestrekker_technical_interview.veljkoilic/internal/metrics"
+	"sync"
+	"time"
+)
+
+// Route label of the requests the router found no route for
+const unmatchedRoute = "unmatched"
+
+// The metrics served on GET /metrics in the Prometheus text format
+type appMetrics struct {
+	registry *metrics.Registry
+	requests *metrics.Counter
+	duration *metrics.Histogram
+	inFlight *metrics.Gauge
+	contacts *metrics.Gauge
+	// only saves of the json storage backend are measured, the other backends never save a file
+	saveDuration *metrics.Histogram
+	saveFailures *metrics.Counter
+
+	// the contact counts are read from the store on every scrape, one scrape at a time
+	scrape sync.Mutex
+}
+
+func newAppMetrics() *appMetrics {
+	registry := metrics.NewRegistry()
+
+	m := &appMetrics{
+		registry: registry,
+		requests: registry.NewCounter("http_requests_total",
+			"Number of HTTP requests answered, by method, route template and status code.", "method", "route", "status"),
+		duration: registry.NewHistogram("http_request_duration_seconds",
+			"How long HTTP requests took to answer, by method, route template and status code.", metrics.DefaultBuckets, "method", "route", "status"),
+		inFlight: registry.NewGauge("http_requests_in_flight",
+			"Number of HTTP requests being answered."),
+		contacts: registry.NewGauge("contacts",
+			"Number of contacts stored, by tenant.", "tenant"),
+		saveDuration: registry.NewHistogram("storage_save_duration_seconds",
+			"How long saving the contacts file took.", metrics.DefaultBuckets),
+		saveFailures: registry.NewCounter("storage_save_failures_total",
+			"Number of failed saves of the contacts file."),
+	}
+	registry.RegisterRuntime()
+
+	// values without labels are written from the start, so they read 0 rather than missing
+	m.inFlight.Set(0)
+	m.saveFailures.Add(0)
+
+	return m
+}
+
+// Record a save of the contacts file, set as the JSONFileStore's ObserveSave
+func (m *appMetrics) observeSave(duration time.Duration, err error) {
+	m.saveDuration.Observe(duration.Seconds())
+	if err != nil {
+		m.saveFailures.Inc()
+	}
+}
+
+// Methods of the requests the router found no route for are counted as they are only when they are
+// standard ones, so clients can not make up a new series with every request
+func metricsMethod(method, route string) string {
+	if route != unmatchedRoute {
+		return method
+	}
+
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodOptions, "PROPFIND", "REPORT":
+		return method
+	default:
+		return "other"
+	}
+}
+
+// Record the path template of the route the request was routed to, so the metrics count requests per
+// route rather than per path. instrument gives every request a place in its context for it.
+func (app *application) routeTemplate(template string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if route := app.contextGetRoute(r); route != nil {
+			*route = template
+		}
+		next(w, r)
+	}
+}
+
+// Write the metrics, with the number of contacts of every tenant read from the store first
+func (app *application) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	app.metrics.scrape.Lock()
+	defer app.metrics.scrape.Unlock()
+
+	counts, err := app.contactsModel.Store.Count()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.metrics.contacts.Reset()
+	for tenant, count := range counts {
+		app.metrics.contacts.Set(float64(count), tenant)
+	}
+
+	w.Header().Set("Content-Type", metrics.ContentType)
+	err = app.metrics.registry.Write(w)
+	if err != nil {
+		app.logError(r, err)
+	}
+}
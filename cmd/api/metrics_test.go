@@ -0,0 +1,135 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"salestrekker_technical_interview.veljkoilic/internal/data"
+	"salestrekker_technical_interview.veljkoilic/internal/metrics"
+	"strings"
+	"testing"
+)
+
+// Scrape the metrics with the headers given and fail the test unless they are served
+func scrapeMetrics(t *testing.T, ts *testServer, headers http.Header) string {
+	t.Helper()
+
+	code, rsHeaders, body := ts.request(t, http.MethodGet, "/metrics", "", headers)
+	if code != http.StatusOK {
+		t.Fatalf("want %d; got %d, %q", http.StatusOK, code, body)
+	}
+	if got := rsHeaders.Get("Content-Type"); got != metrics.ContentType {
+		t.Errorf("want content type %q; got %q", metrics.ContentType, got)
+	}
+	return string(body)
+}
+
+// Testing that requests are counted by their route template rather than their path,
+// and that the metrics are only served with the metrics:read permission
+func TestMetrics(t *testing.T) {
+	app, keys := newTestAppWithKeys(t, data.Permissions{data.PermissionAdmin}, data.Permissions{data.PermissionContactsRead},
+		data.Permissions{data.PermissionMetricsRead})
+	admin, reader, scraper := http.Header{"X-Api-Key": {keys[0]}}, http.Header{"X-Api-Key": {keys[1]}}, http.Header{"X-Api-Key": {keys[2]}}
+
+	ts := newTestServer(app.routes())
+	defer ts.Close()
+
+	requests := []struct {
+		method   string
+		path     string
+		headers  http.Header
+		wantCode int
+	}{
+		{http.MethodGet, "/v1/contacts/1", reader, http.StatusOK},
+		{http.MethodGet, "/v1/contacts/2", reader, http.StatusOK},
+		{http.MethodGet, "/v1/contacts/99", reader, http.StatusNotFound},
+		{http.MethodGet, "/v1/contacts/search?q=Veljko", reader, http.StatusOK},
+		{http.MethodGet, "/v1/tenants/default/contacts/1", admin, http.StatusOK},
+		{http.MethodGet, "/v1/contacts", nil, http.StatusUnauthorized},
+		{http.MethodGet, "/v1/nowhere/1", reader, http.StatusNotFound},
+		{"BREW", "/v1/healthcheck", nil, http.StatusMethodNotAllowed},
+		{http.MethodGet, "/metrics", reader, http.StatusForbidden},
+		{http.MethodGet, "/v1/contacts", scraper, http.StatusForbidden},
+	}
+
+	for _, rq := range requests {
+		if code, _, _ := ts.request(t, rq.method, rq.path, "", rq.headers); code != rq.wantCode {
+			t.Fatalf("%s %s: want %d; got %d", rq.method, rq.path, rq.wantCode, code)
+		}
+	}
+
+	got := scrapeMetrics(t, ts, scraper)
+
+	for _, want := range []string{
+		`http_requests_total{method="GET",route="/v1/contacts/:id",status="200"} 2`,
+		`http_requests_total{method="GET",route="/v1/contacts/:id",status="404"} 1`,
+		`http_requests_total{method="GET",route="/v1/contacts/search",status="200"} 1`,
+		`http_requests_total{method="GET",route="/v1/tenants/:tenant/contacts/:id",status="200"} 1`,
+		`http_requests_total{method="GET",route="/v1/contacts",status="401"} 1`,
+		`http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		`http_requests_total{method="other",route="unmatched",status="405"} 1`,
+		`http_requests_total{method="GET",route="/metrics",status="403"} 1`,
+		`http_requests_total{method="GET",route="/v1/contacts",status="403"} 1`,
+		`http_request_duration_seconds_count{method="GET",route="/v1/contacts/:id",status="200"} 2`,
+		`http_request_duration_seconds_bucket{method="GET",route="/v1/contacts/:id",status="200",le="+Inf"} 2`,
+		// the scrape itself is in flight
+		"\nhttp_requests_in_flight 1\n",
+		`contacts{tenant="default"} 2`,
+		"\nstorage_save_failures_total 0\n",
+		"\ngo_goroutines ",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("want %s; got\n%s", want, got)
+		}
+	}
+
+	if strings.Contains(got, "/v1/contacts/1") || strings.Contains(got, "/v1/nowhere") {
+		t.Errorf("want no raw paths in the metrics; got\n%s", got)
+	}
+}
+
+// Testing that the saves of the contacts file are timed and their failures counted
+func TestMetricsStorageSaves(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "contacts")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := data.NewJSONFileStore(filepath.Join(dir, "contacts.json"), data.DefaultBackups)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := newTestApp()
+	app.useStore(store)
+	store.ObserveSave = app.metrics.observeSave
+
+	ts := newTestServer(app.routes())
+	defer ts.Close()
+
+	contact := `{"first_name": "Veljko", "last_name": "Ilic", "telephone": "+38163577442"}`
+	if code, _, _ := ts.request(t, http.MethodPost, "/v1/contacts", contact, nil); code != http.StatusCreated {
+		t.Fatalf("want %d; got %d", http.StatusCreated, code)
+	}
+
+	// Removing the directory makes every following save fail
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	other := `{"first_name": "Marko", "last_name": "Markovic", "telephone": "+38163587442"}`
+	if code, _, _ := ts.request(t, http.MethodPost, "/v1/contacts", other, nil); code != http.StatusInternalServerError {
+		t.Fatalf("want %d; got %d", http.StatusInternalServerError, code)
+	}
+
+	got := scrapeMetrics(t, ts, nil)
+
+	for _, want := range []string{
+		"\nstorage_save_duration_seconds_count 2\n",
+		"\nstorage_save_failures_total 1\n",
+		`contacts{tenant="default"} 1`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("want %s; got\n%s", strings.TrimSpace(want), got)
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"crypto/rand"
+	"errors"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"salestrekker_technical_interview.veljkoilic/internal/data"
+	"salestrekker_technical_interview.veljkoilic/internal/validator"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Give every request an ID, sent back in the X-Request-ID header and logged with everything the request logs.
+// An ID already set by the client or a proxy in front of the API is kept, so the request can be followed
+// across services.
+func (app *application) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !requestIDRX.MatchString(id) {
+			id = rand.Text()
+		}
+
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, app.contextSetRequestID(r, id))
+	})
+}
+
+// Log a line for every request once it is answered, with the status, the size of the body,
+// how long it took and who sent it
+func (app *application) logRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rw := newResponseRecorder(w)
+
+		next.ServeHTTP(rw, r)
+
+		app.logger.Info("request",
+			"method", r.Method,
+			"url", r.URL.RequestURI(),
+			"status", rw.status,
+			"bytes", rw.bytes,
+			"latency", time.Since(start),
+			"client", clientIP(r, app.config.limiter.trustedProxies),
+			"request_id", app.contextGetRequestID(r),
+		)
+	})
+}
+
+// Count every request and how long it took in the metrics, by method, route template and status code,
+// along with the requests in flight. The route template is recorded by routeTemplate once the router
+// has found the route; requests it found none for are counted as unmatchedRoute.
+func (app *application) instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		app.metrics.inFlight.Inc()
+		defer app.metrics.inFlight.Dec()
+
+		route := unmatchedRoute
+		rw := newResponseRecorder(w)
+
+		next.ServeHTTP(rw, app.contextSetRoute(r, &route))
+
+		method, status := metricsMethod(r.Method, route), strconv.Itoa(rw.status)
+		app.metrics.requests.Inc(method, route, status)
+		app.metrics.duration.Observe(time.Since(start).Seconds(), method, route, status)
+	})
+}
+
+// Find out who sent the request and put them in the request context. Requests authenticate either
+// with an API key or with a user's authentication token:
+//
+//	Authorization: Bearer <token>
+//	Authorization: Bearer ck_...
+//	X-API-Key: ck_...
+//
+// API keys can also be sent as the password of Basic authentication, for CardDAV clients which
+// know no other way. Requests without credentials go on as AnonymousUser, and whether that is
+// enough is up to the route. Requests with credentials which are not valid are refused, see refuseCredentials.
+// The request works with the tenant of the user or the API key, anonymous requests with DefaultTenant.
+func (app *application) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = app.contextSetTenant(r, data.DefaultTenant)
+
+		if !app.config.auth.enabled {
+			next.ServeHTTP(w, app.contextSetUser(r, data.AnonymousUser))
+			return
+		}
+
+		// responses differ by who they were sent to
+		w.Header().Add("Vary", "Authorization")
+
+		credentials := credentialsFromRequest(r)
+
+		switch {
+		case credentials == "":
+			r = app.contextSetUser(r, data.AnonymousUser)
+
+		case strings.HasPrefix(credentials, data.APIKeyPrefix):
+			key, err := app.keys.Authenticate(credentials)
+			if err != nil {
+				switch {
+				case errors.Is(err, data.ErrInvalidAPIKey):
+					app.refuseCredentials(w, r)
+				default:
+					app.serverErrorResponse(w, r, err)
+				}
+				return
+			}
+			r = app.contextSetUser(app.contextSetAPIKey(r, key), data.AnonymousUser)
+			r = app.contextSetTenant(r, key.Tenant)
+
+		default:
+			v := validator.New()
+			if data.ValidateTokenPlaintext(v, credentials); !v.IsValid() {
+				app.refuseCredentials(w, r)
+				return
+			}
+
+			user, err := app.usersModel.GetUserForToken(data.TokenAuthentication, credentials)
+			if err != nil {
+				switch {
+				case errors.Is(err, data.ErrRecordNotFound):
+					app.refuseCredentials(w, r)
+				default:
+					app.serverErrorResponse(w, r, err)
+				}
+				return
+			}
+			r = app.contextSetUser(app.contextSetTenant(r, user.Tenant), user)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Return the API key or token sent with the request, or "" when there is none
+func credentialsFromRequest(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+
+	if _, password, ok := r.BasicAuth(); ok {
+		return password
+	}
+
+	scheme, credentials, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	if strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(credentials)
+	}
+	return ""
+}
+
+// Require the request to be sent by an activated user, or with an API key. Nothing is required
+// when authentication is disabled.
+func (app *application) requireAuthenticatedUser(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !app.config.auth.enabled || app.contextGetAPIKey(r) != nil {
+			next(w, r)
+			return
+		}
+
+		user := app.contextGetUser(r)
+		if user.IsAnonymous() {
+			app.authenticationRequiredResponse(w, r)
+			return
+		}
+		if !user.Activated {
+			app.inactiveAccountResponse(w, r)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// Require the user or the API key which sent the request to have the permission with the given code.
+// Users have to be authenticated and activated first. Nothing is required when authentication is disabled.
+// Routes under /v1/tenants/:tenant then go on with the tenant they name, see useTenantParam.
+func (app *application) requirePermission(code string, next http.HandlerFunc) http.HandlerFunc {
+	next = app.useTenantParam(next)
+
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if !app.config.auth.enabled {
+			next(w, r)
+			return
+		}
+
+		if !app.permissions(r).Include(code) {
+			app.notPermittedResponse(w, r, code)
+			return
+		}
+
+		next(w, r)
+	}
+
+	return app.requireAuthenticatedUser(fn)
+}
+
+// Return the permissions of the API key the request was sent with, or else of the user who sent it
+func (app *application) permissions(r *http.Request) data.Permissions {
+	if key := app.contextGetAPIKey(r); key != nil {
+		return key.Permissions
+	}
+	return app.contextGetUser(r).Permissions
+}
+
+// Report whether the request may reach across the tenants. Everything may when authentication is disabled.
+func (app *application) isSuperuser(r *http.Request) bool {
+	return !app.config.auth.enabled || app.permissions(r).Include(data.PermissionSuperuser)
+}
+
+// Switch the request over to the tenant named by the tenant parameter of the route. Only superusers may work
+// with the contacts of a tenant other than their own, to everyone else the other tenants do not exist.
+// Requests of routes without the parameter stay with the tenant authenticate gave them.
+func (app *application) useTenantParam(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenant := httprouter.ParamsFromContext(r.Context()).ByName("tenant")
+		if tenant == "" {
+			next(w, r)
+			return
+		}
+
+		if !data.ValidTenant(tenant) {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		if tenant != app.contextGetTenant(r) && !app.isSuperuser(r) {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		next(w, app.contextSetTenant(r, tenant))
+	}
+}
+
+// Create the rate limiter shared by rateLimit and refuseCredentials, or return nil when rate limiting is disabled.
+// Clients which have been idle for a while are forgotten in the background, until the server shuts down.
+func (app *application) newClientLimiter() *rateLimiter {
+	if !app.config.limiter.enabled {
+		return nil
+	}
+
+	limiter := newRateLimiter(app.config.limiter.rps, app.config.limiter.burst)
+
+	app.background(func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				limiter.evict(limiterIdleTimeout)
+			case <-app.done:
+				return
+			}
+		}
+	})
+
+	return limiter
+}
+
+// Limit the rate of requests of every client with a token bucket. Requests with an API key are
+// limited per key and requests with a user's token per user, so the staff of an office behind
+// a single address do not share a bucket. Anonymous requests are limited per client IP address.
+// Refused requests get 429 Too Many Requests.
+func (app *application) rateLimit(next http.Handler) http.Handler {
+	if app.limiter == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client := "ip:" + clientIP(r, app.config.limiter.trustedProxies)
+		if key := app.contextGetAPIKey(r); key != nil {
+			client = "key:" + key.ID
+		} else if user := app.contextGetUser(r); !user.IsAnonymous() {
+			client = "user:" + strconv.FormatInt(user.ID, 10)
+		}
+
+		if app.allowRequest(w, r, client) {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// Refuse a request whose API key or token is not valid. authenticate refuses them before rateLimit sees
+// the request, so the refusal takes a token from the client IP's bucket itself; otherwise keys and tokens
+// could be guessed without limit. A client out of tokens gets 429 Too Many Requests instead of 401.
+func (app *application) refuseCredentials(w http.ResponseWriter, r *http.Request) {
+	if app.limiter == nil || app.allowRequest(w, r, "ip:"+clientIP(r, app.config.limiter.trustedProxies)) {
+		app.invalidAuthenticationTokenResponse(w, r)
+	}
+}
+
+// Take a token from the client's bucket and set the rate limit headers. When the bucket is empty the request
+// is answered with 429 Too Many Requests and false is returned.
+func (app *application) allowRequest(w http.ResponseWriter, r *http.Request, client string) bool {
+	status := app.limiter.allow(client)
+	setRateLimitHeaders(w, app.config.limiter.burst, status)
+
+	if !status.allowed {
+		app.rateLimitExceededResponse(w, r)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"log/slog"
+	"salestrekker_technical_interview.veljkoilic/internal/data"
+	"time"
+)
+
+// Delivers the messages the API sends its users
+type notifier interface {
+	SendActivation(user *data.User, token *data.Token) error
+}
+
+// Stand-in for a mailer until the API has a mail transport. It only records in the log that a user is
+// waiting for activation, never the token itself, unless revealTokens is set by the development-only
+// -dev-log-tokens flag, which logs the token at the debug level. Outside development admins activate
+// the accounts with PATCH /v1/users/:id/activated instead.
+type logNotifier struct {
+	logger       *slog.Logger
+	revealTokens bool
+}
+
+func (n *logNotifier) SendActivation(user *data.User, token *data.Token) error {
+	n.logger.Info("activation token issued", "user_id", user.ID, "expires", token.Expiry.Format(time.RFC3339))
+	if n.revealTokens {
+		n.logger.Debug("activation token", "user_id", user.ID, "email", user.Email, "activation_token", token.Plaintext)
+	}
+	return nil
+}
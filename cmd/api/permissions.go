@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"salestrekker_technical_interview.veljkoilic/internal/data"
+	"salestrekker_technical_interview.veljkoilic/internal/validator"
+)
+
+// Handler for listing the permission codes and the roles which bundle them
+func (app *application) listPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.writeJSON(w, http.StatusOK, envelope{"permissions": data.PermissionCodes, "roles": data.Roles}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Handler for replacing the permissions of a user. The request gives either a role, whose
+// permissions the user gets, or the list of permission codes itself:
+//
+//	{"role": "editor"}
+//	{"permissions": ["contacts:read", "contacts:export"]}
+func (app *application) updateUserPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readUser(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Role        *string          `json:"role"`
+		Permissions data.Permissions `json:"permissions"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Role == nil || input.Permissions == nil, "role", "must not be provided together with permissions")
+	v.Check(input.Role != nil || input.Permissions != nil, "permissions", "must be provided, or a role instead")
+	if !v.IsValid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if input.Role != nil {
+		permissions, ok := data.RolePermissions(*input.Role)
+		if !ok {
+			v.AddError("role", fmt.Sprintf("must be one of %v", roleNames()))
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+		input.Permissions = permissions
+	}
+
+	// only superusers make or unmake superusers
+	if (user.Permissions.Include(data.PermissionSuperuser) || input.Permissions.Include(data.PermissionSuperuser)) && !app.isSuperuser(r) {
+		app.notPermittedResponse(w, r, data.PermissionSuperuser)
+		return
+	}
+
+	user.Permissions = input.Permissions
+
+	if data.ValidatePermissions(v, "permissions", user.Permissions); !v.IsValid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.usersModel.UpdateUser(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Names of the roles, in the order they are listed
+func roleNames() []string {
+	names := make([]string, len(data.Roles))
+	for i, role := range data.Roles {
+		names[i] = role.Name
+	}
+	return names
+}
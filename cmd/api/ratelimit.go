@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Clients not seen for this long are forgotten, unless their bucket takes longer to fill up again
+const limiterIdleTimeout = 3 * time.Minute
+
+// A token bucket of one client. It holds up to burst tokens and is refilled at rps tokens a second,
+// every request takes one token.
+type tokenBucket struct {
+	tokens float64
+	// when the tokens were last counted
+	last time.Time
+}
+
+// Outcome of a request passing through the rate limiter
+type rateLimitStatus struct {
+	allowed bool
+	// tokens left in the bucket after the request
+	remaining int
+	// how long until the next request would be allowed, zero when it already is
+	retryAfter time.Duration
+	// how long until the bucket is full again
+	reset time.Duration
+}
+
+// rateLimiter keeps a token bucket for every client, created on the client's first request
+type rateLimiter struct {
+	rps     float64
+	burst   int
+	mu      sync.Mutex
+	clients map[string]*tokenBucket
+	now     func() time.Time
+}
+
+func newRateLimiter(rps float64, burst int) *rateLimiter {
+	return &rateLimiter{rps: rps, burst: burst, clients: map[string]*tokenBucket{}, now: time.Now}
+}
+
+// Take a token from the client's bucket, if it has one left
+func (l *rateLimiter) allow(client string) rateLimitStatus {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+
+	bucket, ok := l.clients[client]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(l.burst), last: now}
+		l.clients[client] = bucket
+	}
+
+	// refill the bucket for the time since the tokens were last counted
+	bucket.tokens = min(float64(l.burst), bucket.tokens+now.Sub(bucket.last).Seconds()*l.rps)
+	bucket.last = now
+
+	var status rateLimitStatus
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		status.allowed = true
+	} else {
+		status.retryAfter = l.refillTime(1 - bucket.tokens)
+	}
+
+	status.remaining = int(bucket.tokens)
+	status.reset = l.refillTime(float64(l.burst) - bucket.tokens)
+	return status
+}
+
+// Return how long it takes to refill the given number of tokens
+func (l *rateLimiter) refillTime(tokens float64) time.Duration {
+	return time.Duration(tokens / l.rps * float64(time.Second))
+}
+
+// Forget the clients whose buckets are full again and who have not been seen for idle.
+// Their next request starts with a new, full bucket, the same they would have had.
+func (l *rateLimiter) evict(idle time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	idle = max(idle, l.refillTime(float64(l.burst)))
+	now := l.now()
+	for client, bucket := range l.clients {
+		if now.Sub(bucket.last) > idle {
+			delete(l.clients, client)
+		}
+	}
+}
+
+// Set the headers telling the client its limit, how many requests it has left and
+// in how many seconds the limit is fully restored. Refused requests are also told when to retry.
+func setRateLimitHeaders(w http.ResponseWriter, burst int, status rateLimitStatus) {
+	w.Header().Set("RateLimit-Limit", fmt.Sprint(burst))
+	w.Header().Set("RateLimit-Remaining", fmt.Sprint(status.remaining))
+	w.Header().Set("RateLimit-Reset", fmt.Sprint(ceilSeconds(status.reset)))
+	if !status.allowed {
+		w.Header().Set("Retry-After", fmt.Sprint(max(ceilSeconds(status.retryAfter), 1)))
+	}
+}
+
+// Round the duration up to whole seconds, as the headers take no fractions
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// Parse a comma separated list of IP addresses and CIDR ranges
+func parseTrustedProxies(list string) ([]netip.Prefix, error) {
+	var proxies []netip.Prefix
+	for item := range strings.SplitSeq(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		if strings.Contains(item, "/") {
+			prefix, err := netip.ParsePrefix(item)
+			if err != nil {
+				return nil, err
+			}
+			proxies = append(proxies, prefix.Masked())
+			continue
+		}
+
+		addr, err := netip.ParseAddr(item)
+		if err != nil {
+			return nil, err
+		}
+		addr = addr.Unmap()
+		proxies = append(proxies, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return proxies, nil
+}
+
+// Report whether the address belongs to one of the trusted proxies
+func isTrustedProxy(addr netip.Addr, proxies []netip.Prefix) bool {
+	addr = addr.Unmap()
+	for _, prefix := range proxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Return the IP address of the client who sent the request. Requests coming from a trusted proxy
+// are taken to be sent by the address the proxies put in X-Forwarded-For, found by walking the header
+// from the right past the trusted proxies. Everything to the left of that can be made up by the client.
+func clientIP(r *http.Request, proxies []netip.Prefix) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return host
+	}
+	addr = addr.Unmap()
+
+	if !isTrustedProxy(addr, proxies) {
+		return addr.String()
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+		if err != nil {
+			// a hop the proxies did not write, the last good address is as far as can be trusted
+			break
+		}
+		addr = hop.Unmap()
+
+		if !isTrustedProxy(addr, proxies) {
+			break
+		}
+	}
+	return addr.String()
+}
@@ -3,9 +3,10 @@ package main
 import (
 	"github.com/julienschmidt/httprouter"
 	"net/http"
+	"salestrekker_technical_interview.veljkoilic/internal/data"
 )
 
-func (app *application) routes() *httprouter.Router {
+func (app *application) routes() http.Handler {
 	// initialize a new http router instance
 	router := httprouter.New()
 
@@ -14,13 +15,99 @@ func (app *application) routes() *httprouter.Router {
 	router.NotFound = http.HandlerFunc(app.notFoundResponse)
 	router.MethodNotAllowed = http.HandlerFunc(app.methodNotAllowedResponse)
 
-	// register relevant endpoints and their methods
-	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
-	router.HandlerFunc(http.MethodGet, "/v1/contacts/:id", app.showContactHandler)
-	router.HandlerFunc(http.MethodPost, "/v1/contacts", app.createContactHandler)
-	router.HandlerFunc(http.MethodGet, "/v1/contacts", app.listAllContactsHandler)
-	router.HandlerFunc(http.MethodDelete, "/v1/contacts/:id", app.deleteContactHandler)
+	// every route is registered with its path template, which the metrics count the requests by
+	handle := func(method, path string, handler http.HandlerFunc) {
+		router.HandlerFunc(method, path, app.routeTemplate(path, handler))
+	}
 
-	// return configured router
-	return router
+	// register relevant endpoints and their methods, each with the permission it needs. Everything
+	// but the healthcheck and the user accounts needs an authenticated user or an API key.
+	handle(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
+
+	// the metrics cover every tenant, so they need a permission of their own, which scrapers get
+	// without being able to read any contacts
+	handle(http.MethodGet, "/metrics", app.requirePermission(data.PermissionMetricsRead, app.metricsHandler))
+
+	// the contacts and the groups are those of the caller's tenant. Superusers reach the other tenants
+	// through the same routes under /v1/tenants/:tenant.
+	for _, prefix := range []string{"/v1", "/v1/tenants/:tenant"} {
+		handle(http.MethodGet, prefix+"/contacts/:id", app.staticSegments(app.requirePermission(data.PermissionContactsRead, app.showContactHandler), map[string]http.HandlerFunc{
+			"search":     app.routeTemplate(prefix+"/contacts/search", app.requirePermission(data.PermissionContactsRead, app.searchContactsHandler)),
+			"export.csv": app.routeTemplate(prefix+"/contacts/export.csv", app.requirePermission(data.PermissionContactsExport, app.exportContactsCSVHandler)),
+			"export.vcf": app.routeTemplate(prefix+"/contacts/export.vcf", app.requirePermission(data.PermissionContactsExport, app.exportContactsVCardHandler)),
+		}))
+		handle(http.MethodPost, prefix+"/contacts", app.requirePermission(data.PermissionContactsWrite, app.createContactHandler))
+		handle(http.MethodPost, prefix+"/contacts/import", app.requirePermission(data.PermissionContactsWrite, app.importContactsHandler))
+		handle(http.MethodGet, prefix+"/contacts", app.requirePermission(data.PermissionContactsRead, app.listAllContactsHandler))
+		handle(http.MethodPut, prefix+"/contacts/:id", app.requirePermission(data.PermissionContactsWrite, app.updateContactHandler))
+		handle(http.MethodPatch, prefix+"/contacts/:id", app.requirePermission(data.PermissionContactsWrite, app.patchContactHandler))
+		handle(http.MethodDelete, prefix+"/contacts/:id", app.requirePermission(data.PermissionContactsDelete, app.deleteContactHandler))
+
+		// groups only bundle contacts, removing a group or a member leaves the contacts in place
+		handle(http.MethodPost, prefix+"/groups", app.requirePermission(data.PermissionContactsWrite, app.createGroupHandler))
+		handle(http.MethodGet, prefix+"/groups", app.requirePermission(data.PermissionContactsRead, app.listGroupsHandler))
+		handle(http.MethodGet, prefix+"/groups/:id", app.requirePermission(data.PermissionContactsRead, app.showGroupHandler))
+		handle(http.MethodPatch, prefix+"/groups/:id", app.requirePermission(data.PermissionContactsWrite, app.updateGroupHandler))
+		handle(http.MethodDelete, prefix+"/groups/:id", app.requirePermission(data.PermissionContactsWrite, app.deleteGroupHandler))
+		handle(http.MethodGet, prefix+"/groups/:id/contacts", app.requirePermission(data.PermissionContactsRead, app.listGroupContactsHandler))
+		handle(http.MethodPost, prefix+"/groups/:id/contacts", app.requirePermission(data.PermissionContactsWrite, app.addGroupContactsHandler))
+		handle(http.MethodDelete, prefix+"/groups/:id/contacts/:contact_id", app.requirePermission(data.PermissionContactsWrite, app.removeGroupContactHandler))
+	}
+
+	// the custom field schema is shared by every tenant and changing it changes their contacts, so only superusers may
+	handle(http.MethodPost, "/v1/fields", app.requirePermission(data.PermissionSuperuser, app.createFieldHandler))
+	handle(http.MethodGet, "/v1/fields", app.requirePermission(data.PermissionContactsRead, app.listFieldsHandler))
+	handle(http.MethodGet, "/v1/fields/:name", app.requirePermission(data.PermissionContactsRead, app.showFieldHandler))
+	handle(http.MethodPatch, "/v1/fields/:name", app.requirePermission(data.PermissionSuperuser, app.updateFieldHandler))
+	handle(http.MethodDelete, "/v1/fields/:name", app.requirePermission(data.PermissionSuperuser, app.deleteFieldHandler))
+
+	// CardDAV, for syncing the address book with phones and desktop clients
+	handle(http.MethodGet, "/.well-known/carddav", app.davWellKnownHandler)
+	handle("PROPFIND", "/.well-known/carddav", app.davWellKnownHandler)
+	for _, path := range []string{davRoot, davHome, davAddressBook} {
+		handle(http.MethodOptions, path, app.requirePermission(data.PermissionContactsRead, app.davOptionsHandler))
+		handle("PROPFIND", path, app.requirePermission(data.PermissionContactsRead, app.davPropfindHandler))
+	}
+	handle("REPORT", davAddressBook, app.requirePermission(data.PermissionContactsRead, app.davReportHandler))
+	handle(http.MethodOptions, davAddressBook+":card", app.requirePermission(data.PermissionContactsRead, app.davOptionsHandler))
+	handle("PROPFIND", davAddressBook+":card", app.requirePermission(data.PermissionContactsRead, app.davPropfindCardHandler))
+	handle(http.MethodGet, davAddressBook+":card", app.requirePermission(data.PermissionContactsRead, app.davGetCardHandler))
+	handle(http.MethodHead, davAddressBook+":card", app.requirePermission(data.PermissionContactsRead, app.davGetCardHandler))
+	handle(http.MethodPut, davAddressBook+":card", app.requirePermission(data.PermissionContactsWrite, app.davPutCardHandler))
+	handle(http.MethodDelete, davAddressBook+":card", app.requirePermission(data.PermissionContactsDelete, app.davDeleteCardHandler))
+
+	handle(http.MethodPost, "/v1/users", app.registerUserHandler)
+	handle(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
+	handle(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
+
+	// managing the users, what they may do and the tenant they work in. Admins manage the users of their own tenant,
+	// superusers every user, and only they move users between tenants. Permissions and tenants are changed
+	// with PATCH, as httprouter does not allow the :id wildcard next to PUT /v1/users/activated.
+	handle(http.MethodGet, "/v1/permissions", app.requirePermission(data.PermissionAdmin, app.listPermissionsHandler))
+	handle(http.MethodGet, "/v1/users", app.requirePermission(data.PermissionAdmin, app.listUsersHandler))
+	handle(http.MethodGet, "/v1/users/:id", app.requirePermission(data.PermissionAdmin, app.showUserHandler))
+	handle(http.MethodPatch, "/v1/users/:id/permissions", app.requirePermission(data.PermissionAdmin, app.updateUserPermissionsHandler))
+	handle(http.MethodPatch, "/v1/users/:id/tenant", app.requirePermission(data.PermissionSuperuser, app.updateUserTenantHandler))
+	handle(http.MethodPatch, "/v1/users/:id/activated", app.requirePermission(data.PermissionAdmin, app.updateUserActivatedHandler))
+
+	// return configured router. Every request gets an ID, is logged and counted in the metrics, and is
+	// authenticated before the rate limit, so the limit knows the API key or the user. Requests refused by authenticate
+	// are charged to the same limiter.
+	return app.requestID(app.logRequest(app.instrument(app.authenticate(app.rateLimit(router)))))
+}
+
+// httprouter does not allow static path segments next to a wildcard, so paths like /v1/contacts/search
+// are registered as the :id wildcard and dispatched here. Requests whose parameter is one of the
+// static segments go to that segment's handler, the rest go to next.
+func (app *application) staticSegments(next http.HandlerFunc, segments map[string]http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := httprouter.ParamsFromContext(r.Context())
+
+		if handler, ok := segments[params.ByName("id")]; ok {
+			handler(w, r)
+			return
+		}
+
+		next(w, r)
+	}
 }
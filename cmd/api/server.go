@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// Serve the API on the listener until the process gets SIGINT or SIGTERM. The server then stops
+// accepting connections and waits up to the shutdown timeout for the requests in flight to finish,
+// and after them up to the shutdown timeout again for the background goroutines. Connections still
+// open when the time is up are closed. An error is returned when the server fails, or when the
+// requests or the background goroutines do not finish in time.
+func (app *application) serve(ln net.Listener) error {
+	srv := &http.Server{
+		Handler:      app.routes(),
+		IdleTimeout:  time.Minute,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 30 * time.Second,
+		ErrorLog:     slog.NewLogLogger(app.logger.Handler(), slog.LevelError),
+	}
+
+	// the signals are caught before the server starts, so none of them can kill it while it is serving
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(quit)
+
+	shutdownError := make(chan error)
+
+	go func() {
+		s, ok := <-quit
+		if !ok {
+			return
+		}
+		app.logger.Info("shutting down server", "signal", s.String())
+
+		ctx, cancel := context.WithTimeout(context.Background(), app.config.shutdown.timeout)
+		defer cancel()
+
+		err := srv.Shutdown(ctx)
+		if err != nil {
+			// cut off the clients of the requests left in flight, the background tasks are stopped all the same
+			srv.Close()
+			err = fmt.Errorf("shutting down server: %w", err)
+		}
+
+		app.logger.Info("completing background tasks")
+		close(app.done)
+
+		shutdownError <- errors.Join(err, app.waitBackground(app.config.shutdown.timeout))
+	}()
+
+	app.logger.Info("starting server", "env", app.config.env, "addr", ln.Addr().String())
+
+	err := srv.Serve(ln)
+	if !errors.Is(err, http.ErrServerClosed) {
+		// the server failed on its own, there is nothing to shut down
+		signal.Stop(quit)
+		close(quit)
+		return err
+	}
+
+	err = <-shutdownError
+	if err != nil {
+		return err
+	}
+
+	app.logger.Info("stopped server")
+	return nil
+}
+
+// Wait up to timeout for the goroutines started with background to return
+func (app *application) waitBackground(timeout time.Duration) error {
+	finished := make(chan struct{})
+	go func() {
+		app.wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return nil
+	case <-time.After(timeout):
+		return errors.New("background tasks did not finish in time")
+	}
+}
+
+// Run fn in a goroutine the server waits for when it shuts down. A panic in fn is logged
+// instead of taking the whole server down.
+func (app *application) background(fn func()) {
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+
+		defer func() {
+			if err := recover(); err != nil {
+				app.logger.Error(fmt.Sprint(err), "task", "background")
+			}
+		}()
+
+		fn()
+	}()
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"salestrekker_technical_interview.veljkoilic/internal/data"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// trackingListener hands out connections which close waiting once the server has read
+// at least want bytes from one of them and asks for more
+type trackingListener struct {
+	net.Listener
+	want    int
+	waiting chan struct{}
+	once    sync.Once
+}
+
+func (l *trackingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &trackingConn{Conn: conn, l: l}, nil
+}
+
+type trackingConn struct {
+	net.Conn
+	l    *trackingListener
+	read int
+}
+
+func (c *trackingConn) Read(b []byte) (int, error) {
+	if c.read >= c.l.want {
+		c.l.once.Do(func() { close(c.l.waiting) })
+	}
+	n, err := c.Conn.Read(b)
+	c.read += n
+	return n, err
+}
+
+// The contact the slow request creates, sent in two halves
+const (
+	slowBodyFirst = `{"first_name": "Veljko", "last_name": "Ilic", `
+	slowBodyRest  = `"telephone": "+38163577442"}`
+)
+
+// Serve the app on a random local port and start creating a contact, sending only the first half of it.
+// It returns once the handler is waiting for the rest, so the request is in flight until the rest is
+// written to the returned connection. serve's error is sent to the returned channel once it returns.
+func startSlowRequest(t *testing.T, app *application) (net.Conn, <-chan error) {
+	t.Helper()
+
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	head := fmt.Sprintf("POST /v1/contacts HTTP/1.1\r\nHost: %s\r\nContent-Type: application/json\r\nContent-Length: %d\r\nConnection: close\r\n\r\n",
+		inner.Addr(), len(slowBodyFirst)+len(slowBodyRest))
+	ln := &trackingListener{Listener: inner, want: len(head) + len(slowBodyFirst), waiting: make(chan struct{})}
+
+	served := make(chan error, 1)
+	go func() {
+		served <- app.serve(ln)
+	}()
+
+	conn, err := net.Dial("tcp", inner.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	if _, err := conn.Write([]byte(head + slowBodyFirst)); err != nil {
+		t.Fatal(err)
+	}
+
+	// serve catches the signals before it accepts connections, so from here on the test can send them
+	select {
+	case <-ln.waiting:
+	case err := <-served:
+		t.Fatalf("server stopped: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the request to reach the handler")
+	}
+
+	return conn, served
+}
+
+// Wait up to 5 seconds for serve to return, and return its error
+func waitServed(t *testing.T, served <-chan error) error {
+	t.Helper()
+
+	select {
+	case err := <-served:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not stop")
+		return nil
+	}
+}
+
+// Testing that SIGTERM lets the requests in flight finish and save their changes before the server stops
+func TestServeGracefulShutdown(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "contacts.json")
+	store, err := data.NewJSONFileStore(path, data.DefaultBackups)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := newTestApp()
+	app.useStore(store)
+	app.config.shutdown.timeout = 5 * time.Second
+	// the rate limiter runs a background goroutine the shutdown has to stop
+	app.useLimiter(100, 100)
+
+	conn, served := startSlowRequest(t, app)
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+
+	// new connections are refused once the server is shutting down
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		other, err := net.Dial("tcp", conn.RemoteAddr().String())
+		if err != nil {
+			break
+		}
+		other.Close()
+
+		if time.Now().After(deadline) {
+			t.Fatal("want new connections refused")
+		}
+	}
+
+	if _, err := conn.Write([]byte(slowBodyRest)); err != nil {
+		t.Fatal(err)
+	}
+
+	rs, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs.Body.Close()
+	if rs.StatusCode != http.StatusCreated {
+		t.Errorf("want the request in flight to finish with %d; got %d", http.StatusCreated, rs.StatusCode)
+	}
+
+	if err := waitServed(t, served); err != nil {
+		t.Errorf("want a clean shutdown; got %v", err)
+	}
+
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := data.NewJSONFileStore(path, data.DefaultBackups)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contacts, err := reopened.List(data.DefaultTenant)
+	if err != nil || len(contacts) != 1 || contacts[0].FirstName != "Veljko" {
+		t.Errorf("want the contact saved; got %v, %v", contacts, err)
+	}
+}
+
+// Testing that the shutdown fails when the requests in flight do not finish in time, and still closes
+// their connections and stops the background tasks
+func TestServeShutdownTimeout(t *testing.T) {
+	app := newTestApp()
+	app.config.shutdown.timeout = 100 * time.Millisecond
+
+	stopped := make(chan struct{})
+	app.background(func() {
+		<-app.done
+		close(stopped)
+	})
+
+	conn, served := startSlowRequest(t, app)
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGINT); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := waitServed(t, served); err == nil {
+		t.Error("want an error for the request left in flight; got nil")
+	}
+
+	select {
+	case <-stopped:
+	default:
+		t.Error("want the background tasks stopped")
+	}
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err == nil || errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("want the connection of the request in flight closed; got %v", err)
+	}
+}
+
+// Testing that the shutdown does not wait forever for a background task which does not stop
+func TestServeShutdownStuckBackground(t *testing.T) {
+	app := newTestApp()
+	app.config.shutdown.timeout = 100 * time.Millisecond
+
+	stuck := make(chan struct{})
+	defer close(stuck)
+	app.background(func() { <-stuck })
+
+	conn, served := startSlowRequest(t, app)
+	if _, err := conn.Write([]byte(slowBodyRest)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := waitServed(t, served); err == nil || !strings.Contains(err.Error(), "background tasks") {
+		t.Errorf("want the background tasks reported; got %v", err)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"salestrekker_technical_interview.veljkoilic/internal/data"
+	"salestrekker_technical_interview.veljkoilic/internal/validator"
+)
+
+// Return the model of the contacts of the tenant the request works with
+func (app *application) contacts(r *http.Request) *data.ContactsModel {
+	return app.contactsModel.ForTenant(app.contextGetTenant(r))
+}
+
+// Return the model of the groups of the tenant the request works with
+func (app *application) groups(r *http.Request) *data.GroupsModel {
+	return app.groupsModel.ForTenant(app.contextGetTenant(r))
+}
+
+// Return the prefix of the route the request came through, so links in the response stay under the same tenant
+func routePrefix(r *http.Request) string {
+	if tenant := httprouter.ParamsFromContext(r.Context()).ByName("tenant"); tenant != "" {
+		return "/v1/tenants/" + tenant
+	}
+	return "/v1"
+}
+
+// Handler for moving a user to another tenant. The user works with the contacts of that tenant
+// from the next request on:
+//
+//	{"tenant": "sales"}
+func (app *application) updateUserTenantHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readUser(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Tenant string `json:"tenant"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user.Tenant = input.Tenant
+
+	v := validator.New()
+	if data.ValidateTenant(v, "tenant", user.Tenant); !v.IsValid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.usersModel.UpdateUser(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
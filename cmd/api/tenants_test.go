@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"salestrekker_technical_interview.veljkoilic/internal/data"
+	"strings"
+	"testing"
+)
+
+// Testing that keys only reach the contacts of their own tenant, and superusers those of every tenant
+func TestTenantContacts(t *testing.T) {
+	app, keys := newTestAppWithKeys(t,
+		data.Permissions{data.PermissionContactsRead, data.PermissionContactsWrite},
+		data.Permissions{data.PermissionSuperuser},
+		data.Permissions{data.PermissionAdmin},
+	)
+	reader, superuser, admin := http.Header{"X-Api-Key": {keys[0]}}, http.Header{"X-Api-Key": {keys[1]}}, http.Header{"X-Api-Key": {keys[2]}}
+
+	contacts := append([]data.Contact{{ID: 1, Tenant: "sales", FirstName: "Ana", LastName: "Anic", Telephone: "+38163597442"}}, testContacts...)
+	app.useStore(data.NewMemoryStore(contacts))
+
+	salesKey, err := app.keys.Mint(&data.APIKey{Name: "sales", Tenant: "sales", Permissions: data.Permissions{data.PermissionContactsRead}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sales := http.Header{"X-Api-Key": {salesKey}}
+
+	ts := newTestServer(app.routes())
+	defer ts.Close()
+
+	testCases := []struct {
+		name     string
+		path     string
+		headers  http.Header
+		wantCode int
+		wantBody string
+	}{
+		{"own contact", "/v1/contacts/1", sales, http.StatusOK, "Ana"},
+		{"same id in the default tenant", "/v1/contacts/1", reader, http.StatusOK, "Veljko"},
+		{"contact of another tenant", "/v1/contacts/2", sales, http.StatusNotFound, ""},
+		{"own tenant prefix", "/v1/tenants/sales/contacts/1", sales, http.StatusOK, "Ana"},
+		{"another tenant prefix", "/v1/tenants/default/contacts/1", sales, http.StatusNotFound, ""},
+		{"another tenant's groups", "/v1/tenants/sales/groups", reader, http.StatusNotFound, ""},
+		{"list", "/v1/contacts", sales, http.StatusOK, `"total_records": 1`},
+		{"admin in another tenant", "/v1/tenants/sales/contacts/1", admin, http.StatusNotFound, ""},
+		{"admin in its own tenant", "/v1/tenants/default/contacts/1", admin, http.StatusOK, "Veljko"},
+		{"superuser in another tenant", "/v1/tenants/sales/contacts/1", superuser, http.StatusOK, "Ana"},
+		{"superuser in an empty tenant", "/v1/tenants/support/contacts/1", superuser, http.StatusNotFound, ""},
+		{"invalid tenant", "/v1/tenants/Sales/contacts/1", superuser, http.StatusNotFound, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			code, _, body := ts.request(t, http.MethodGet, tc.path, "", tc.headers)
+			if code != tc.wantCode {
+				t.Errorf("want %d; got %d, %q", tc.wantCode, code, body)
+			}
+			if !strings.Contains(string(body), tc.wantBody) {
+				t.Errorf("want body to contain %q; got %q", tc.wantBody, body)
+			}
+		})
+	}
+
+	body := `{"first_name": "Ivana", "last_name": "Ivic", "telephone": "+38163567442"}`
+	code, headers, _ := ts.request(t, http.MethodPost, "/v1/tenants/support/contacts", body, superuser)
+	if code != http.StatusCreated || headers.Get("Location") != "/v1/tenants/support/contacts/1" {
+		t.Errorf("want the first contact of support created; got %d, %q", code, headers.Get("Location"))
+	}
+	if code, _, _ := ts.request(t, http.MethodPost, "/v1/tenants/support/contacts", body, reader); code != http.StatusNotFound {
+		t.Errorf("want a writer refused another tenant; got %d", code)
+	}
+}
+
+// Testing that a user moved to another tenant works with the contacts of that tenant
+func TestUpdateUserTenant(t *testing.T) {
+	app, keys := newTestAppWithKeys(t, data.Permissions{data.PermissionSuperuser}, data.Permissions{data.PermissionAdmin})
+	superuser, admin := http.Header{"X-Api-Key": {keys[0]}}, http.Header{"X-Api-Key": {keys[1]}}
+
+	contacts := append([]data.Contact{{ID: 1, Tenant: "sales", FirstName: "Ana", LastName: "Anic", Telephone: "+38163597442"}}, testContacts...)
+	app.useStore(data.NewMemoryStore(contacts))
+
+	viewer, _ := data.RolePermissions(data.DefaultRole)
+	user := &data.User{Name: "Ana Anic", Email: "ana@example.com", Activated: true, Permissions: viewer}
+	if err := app.usersModel.InsertUser(user); err != nil {
+		t.Fatal(err)
+	}
+	token, err := app.usersModel.NewToken(user.ID, data.AuthenticationTokenTTL, data.TokenAuthentication)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bearer := http.Header{"Authorization": {"Bearer " + token.Plaintext}}
+
+	ts := newTestServer(app.routes())
+	defer ts.Close()
+
+	if _, _, body := ts.request(t, http.MethodGet, "/v1/contacts/1", "", bearer); !strings.Contains(string(body), "Veljko") {
+		t.Errorf("want the contact of the default tenant; got %q", body)
+	}
+
+	path := fmt.Sprintf("/v1/users/%d/tenant", user.ID)
+	testCases := []struct {
+		name     string
+		headers  http.Header
+		body     string
+		wantCode int
+	}{
+		{"not an admin", bearer, `{"tenant": "sales"}`, http.StatusForbidden},
+		{"admin", admin, `{"tenant": "sales"}`, http.StatusForbidden},
+		{"no tenant", superuser, `{}`, http.StatusUnprocessableEntity},
+		{"invalid tenant", superuser, `{"tenant": "Sales Team"}`, http.StatusUnprocessableEntity},
+		{"tenant", superuser, `{"tenant": "sales"}`, http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		code, _, body := ts.request(t, http.MethodPatch, path, tc.body, tc.headers)
+		if code != tc.wantCode {
+			t.Errorf("%s: want %d; got %d, %q", tc.name, tc.wantCode, code, body)
+		}
+	}
+
+	if _, _, body := ts.request(t, http.MethodGet, "/v1/contacts/1", "", bearer); !strings.Contains(string(body), "Ana") {
+		t.Errorf("want the contact of the sales tenant; got %q", body)
+	}
+	if code, _, _ := ts.request(t, http.MethodGet, "/v1/contacts/2", "", bearer); code != http.StatusNotFound {
+		t.Errorf("want %d; got %d", http.StatusNotFound, code)
+	}
+
+	// the admin of the default tenant no longer manages the user, the superuser still does
+	userPath := fmt.Sprintf("/v1/users/%d", user.ID)
+	if code, _, _ := ts.request(t, http.MethodGet, userPath, "", admin); code != http.StatusNotFound {
+		t.Errorf("want the user hidden from the admin; got %d", code)
+	}
+	if code, _, _ := ts.request(t, http.MethodPatch, userPath+"/activated", `{"activated": false}`, admin); code != http.StatusNotFound {
+		t.Errorf("want the admin refused to deactivate the user; got %d", code)
+	}
+	if _, _, body := ts.request(t, http.MethodGet, "/v1/users", "", admin); strings.Contains(string(body), "ana@example.com") {
+		t.Errorf("want the user left out of the admin's list; got %q", body)
+	}
+	if code, _, _ := ts.request(t, http.MethodGet, userPath, "", superuser); code != http.StatusOK {
+		t.Errorf("want the user shown to the superuser; got %d", code)
+	}
+	if _, _, body := ts.request(t, http.MethodGet, "/v1/users", "", superuser); !strings.Contains(string(body), "ana@example.com") {
+		t.Errorf("want the user listed for the superuser; got %q", body)
+	}
+}
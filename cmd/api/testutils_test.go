@@ -2,8 +2,11 @@ package main
 
 import (
 	"io"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"salestrekker_technical_interview.veljkoilic/internal/data"
+	"strings"
 	"testing"
 )
 
@@ -11,14 +14,42 @@ type testServer struct {
 	*httptest.Server
 }
 
+// Contacts every test app starts with
+var testContacts = []data.Contact{
+	{ID: 1, FirstName: "Veljko", LastName: "Ilic", Telephone: "+38163577442"},
+	{ID: 2, FirstName: "Marko", LastName: "Markovic", Telephone: "+38163587442"},
+}
+
 func newTestApp() *application {
 	app := new(application)
 	cfg := config{env: "testing"}
+	cfg.cursor.secret = "test-cursor-secret"
 	app.config = cfg
+	app.done = make(chan struct{})
+	app.logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	app.notifier = &logNotifier{logger: app.logger}
+	app.metrics = newAppMetrics()
+	app.useStore(data.NewMemoryStore(nil))
 
 	return app
 }
 
+// Make the app keep its contacts, groups, custom fields and users in store
+func (app *application) useStore(store data.ContactStore) {
+	app.contactsModel = data.NewModel(store)
+	app.groupsModel = data.NewGroupsModel(store)
+	app.fieldsModel = data.NewFieldsModel(store)
+	app.usersModel = data.NewUsersModel(store)
+}
+
+// Turn the rate limiter on with the given rate and burst, and build it the way main does
+func (app *application) useLimiter(rps float64, burst int) {
+	app.config.limiter.enabled = true
+	app.config.limiter.rps = rps
+	app.config.limiter.burst = burst
+	app.limiter = app.newClientLimiter()
+}
+
 // Create a newTestServer helper which initializes and returns a new instance of a custom testServer type.
 func newTestServer(h http.Handler) *testServer {
 	ts := httptest.NewServer(h)
@@ -54,3 +85,35 @@ func (ts *testServer) get(t *testing.T, urlPath string) (int, http.Header, []byt
 
 	return rs.StatusCode, rs.Header, body
 }
+
+// Implement a request method on a custom testServer type. It sends a request with the
+// given method, body and headers to a URL path on the test server, and returns the response
+// status code, headers, and body.
+func (ts *testServer) request(t *testing.T, method, urlPath string, body string, headers http.Header) (int, http.Header, []byte) {
+	req, err := http.NewRequest(method, ts.URL+urlPath, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for key, val := range headers {
+		req.Header[key] = val
+	}
+
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		if err := rs.Body.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	respBody, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rs.StatusCode, rs.Header, respBody
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"salestrekker_technical_interview.veljkoilic/internal/data"
+	"salestrekker_technical_interview.veljkoilic/internal/validator"
+	"slices"
+)
+
+// Handler for registering a user. The account starts deactivated, with an activation token
+// the user activates it with.
+func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name     string `json:"name"`
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// new users start in the default tenant with the permissions of the default role, superusers move them
+	// and admins give them more
+	permissions, _ := data.RolePermissions(data.DefaultRole)
+	user := &data.User{Name: input.Name, Email: input.Email, Tenant: data.DefaultTenant, Permissions: permissions}
+
+	// hashing is slow, so a password which is about to be refused is not hashed
+	v := validator.New()
+	if data.ValidatePasswordPlaintext(v, input.Password); !v.IsValid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = user.Password.Set(input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if data.ValidateUser(v, user); !v.IsValid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.usersModel.InsertUser(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateEmail):
+			v.AddError("email", "a user with this email address already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	token, err := app.usersModel.NewToken(user.ID, data.ActivationTokenTTL, data.TokenActivation)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// The user is already stored, so a failed delivery is logged rather than failing the registration
+	err = app.notifier.SendActivation(user, token)
+	if err != nil {
+		app.logError(r, err)
+	}
+
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"user": user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Handler for activating a user account with its activation token
+func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TokenPlaintext string `json:"token"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateTokenPlaintext(v, input.TokenPlaintext); !v.IsValid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.usersModel.GetUserForToken(data.TokenActivation, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired activation token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user.Activated = true
+
+	err = app.usersModel.UpdateUser(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// the account is active, its activation tokens are of no more use
+	err = app.usersModel.DeleteTokensForUser(data.TokenActivation, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Handler for activating or deactivating a user account by an admin, for the users whose activation
+// token never reached them, as logNotifier does not deliver the tokens:
+//
+//	{"activated": true}
+func (app *application) updateUserActivatedHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readUser(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Activated *bool `json:"activated"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Activated != nil, "activated", "must be provided")
+	if !v.IsValid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// a superuser's account is only managed by other superusers
+	if user.Permissions.Include(data.PermissionSuperuser) && !app.isSuperuser(r) {
+		app.notPermittedResponse(w, r, data.PermissionSuperuser)
+		return
+	}
+
+	user.Activated = *input.Activated
+
+	err = app.usersModel.UpdateUser(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// an active account has no use for its activation tokens
+	if user.Activated {
+		err = app.usersModel.DeleteTokensForUser(data.TokenActivation, user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Handler for listing the users, with their permissions. Admins see the users of their own tenant, superusers every user.
+func (app *application) listUsersHandler(w http.ResponseWriter, r *http.Request) {
+	users, err := app.usersModel.ListUsers()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !app.isSuperuser(r) {
+		tenant := app.contextGetTenant(r)
+		users = slices.DeleteFunc(users, func(u data.User) bool { return u.Tenant != tenant })
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"users": users}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Show the user with the ID provided by the client
+func (app *application) showUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Read the id parameter and get the user it names. Users of other tenants only exist for superusers.
+// If the id is invalid or there is no such user, the error response is sent and false is returned.
+func (app *application) readUser(w http.ResponseWriter, r *http.Request) (*data.User, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	user, err := app.usersModel.GetUser(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	if user.Tenant != app.contextGetTenant(r) && !app.isSuperuser(r) {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	return user, true
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"salestrekker_technical_interview.veljkoilic/internal/data"
+	"salestrekker_technical_interview.veljkoilic/internal/validator"
+	"salestrekker_technical_interview.veljkoilic/internal/vcard"
+)
+
+// Return the vCard version the client asked for, or 4.0 when it asked for none or an unknown one
+func vcardVersion(version string) string {
+	if version == vcard.Version3 {
+		return vcard.Version3
+	}
+	return vcard.Version4
+}
+
+// Report whether the request body is a vCard file, going by its Content-Type
+func isVCardRequest(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && (mediaType == vcard.MediaType || mediaType == "text/x-vcard")
+}
+
+// Send the contacts as vCards in the given version
+func (app *application) writeVCards(w http.ResponseWriter, r *http.Request, version string, contacts ...*data.Contact) {
+	var buf bytes.Buffer
+
+	enc := vcard.NewEncoder(&buf)
+	for _, contact := range contacts {
+		err := enc.Encode(data.ContactVCard(contact, version))
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", vcard.MediaType+"; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(buf.Bytes())
+}
+
+// Send the contacts matching the query string filters as a single vCard file
+func (app *application) exportContactsVCardHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+
+	match := app.readContactFilter(qs, v)
+	version := app.readString(qs, "version", vcard.Version4)
+	v.Check(validator.PermittedValue(version, vcard.Version3, vcard.Version4), "version", "must be 3.0 or 4.0")
+
+	if !v.IsValid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	w.Header().Set("Content-Type", vcard.MediaType+"; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="contacts.vcf"`)
+	w.WriteHeader(http.StatusOK)
+
+	// The status line is already sent, so all that is left is to log the error
+	err := app.contacts(r).ExportVCards(newStreamWriter(w), match, version)
+	if err != nil {
+		app.logError(r, err)
+	}
+}
+
+// Import the cards of the vCard file sent as the request body, see importContactsHandler
+func (app *application) importVCardsHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	duplicates := app.readString(r.URL.Query(), "duplicates", data.ImportSkip)
+	if v.Check(validator.PermittedValue(duplicates, data.ImportModes...), "duplicates", "must be one of skip, overwrite or fail"); !v.IsValid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	fields, err := app.fieldsModel.ListFields()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+
+	summary, err := app.contacts(r).ImportVCards(r.Body, duplicates, fields)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesError):
+			app.badRequestResponse(w, r, fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit))
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"summary": summary}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
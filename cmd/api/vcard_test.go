@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http"
+	"salestrekker_technical_interview.veljkoilic/internal/data"
+	"strings"
+	"testing"
+)
+
+func TestShowContactVCard(t *testing.T) {
+	app := newTestApp()
+	app.useStore(data.NewMemoryStore(testContacts))
+	ts := newTestServer(app.routes())
+	defer ts.Close()
+
+	testCases := []struct {
+		name            string
+		accept          string
+		wantContentType string
+		wantBody        string
+	}{
+		{"no accept", "", "application/json", `"first_name": "Veljko"`},
+		{"json", "application/json", "application/json", `"first_name": "Veljko"`},
+		{"vcard", "text/vcard", "text/vcard; charset=utf-8", "VERSION:4.0\r\nUID:contact-1\r\nFN:Veljko Ilic\r\nN:Ilic;Veljko;;;\r\nTEL;PREF=1;VALUE=uri:tel:+38163577442\r\n"},
+		{"vcard 3.0", "text/vcard;version=3.0", "text/vcard; charset=utf-8", "VERSION:3.0\r\nUID:contact-1\r\nFN:Veljko Ilic\r\nN:Ilic;Veljko;;;\r\nTEL;TYPE=pref:+38163577442\r\n"},
+		{"old vcard type", "text/x-vcard", "text/vcard; charset=utf-8", "BEGIN:VCARD"},
+		{"json preferred", "text/vcard;q=0.5, application/json", "application/json", `"first_name": "Veljko"`},
+		{"vcard preferred", "*/*;q=0.1, text/vcard", "text/vcard; charset=utf-8", "BEGIN:VCARD"},
+		{"unsupported", "image/png", "application/json", `"first_name": "Veljko"`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			code, headers, body := ts.request(t, http.MethodGet, "/v1/contacts/1", "", http.Header{"Accept": {tc.accept}})
+
+			if code != http.StatusOK {
+				t.Errorf("want %d; got %d", http.StatusOK, code)
+			}
+			if got := headers.Get("Content-Type"); got != tc.wantContentType {
+				t.Errorf("want %q; got %q", tc.wantContentType, got)
+			}
+			if got := headers.Get("Vary"); got != "Accept" {
+				t.Errorf("want Vary: Accept; got %q", got)
+			}
+			if !strings.Contains(string(body), tc.wantBody) {
+				t.Errorf("want body to contain %q; got %q", tc.wantBody, body)
+			}
+		})
+	}
+}
+
+func TestVCardExportAndImport(t *testing.T) {
+	app := newTestApp()
+	app.useStore(data.NewMemoryStore(testContacts))
+	ts := newTestServer(app.routes())
+	defer ts.Close()
+
+	code, _, body := ts.get(t, "/v1/contacts/export.vcf?version=3.0")
+	if code != http.StatusOK {
+		t.Fatalf("want %d; got %d", http.StatusOK, code)
+	}
+	if got := strings.Count(string(body), "BEGIN:VCARD"); got != 2 {
+		t.Errorf("want 2 cards; got %d in %q", got, body)
+	}
+
+	if code, _, body := ts.get(t, "/v1/contacts/export.vcf?version=2.1"); code != http.StatusUnprocessableEntity {
+		t.Errorf("want %d; got %d, %q", http.StatusUnprocessableEntity, code, body)
+	}
+
+	// importing the export into the same address book finds every contact already there
+	vcardBody := http.Header{"Content-Type": {"text/vcard; charset=utf-8"}}
+	code, _, imported := ts.request(t, http.MethodPost, "/v1/contacts/import", string(body), vcardBody)
+	if code != http.StatusOK || !strings.Contains(string(imported), `"skipped": 2`) {
+		t.Errorf("want 2 skipped cards; got %d, %q", code, imported)
+	}
+
+	card := "BEGIN:VCARD\r\nVERSION:4.0\r\nFN:Ana Anic\r\nEND:VCARD\r\n"
+	code, _, imported = ts.request(t, http.MethodPost, "/v1/contacts/import", card, vcardBody)
+	if code != http.StatusOK || !strings.Contains(string(imported), `"telephone": "must be provided"`) {
+		t.Errorf("want the card without a telephone reported; got %d, %q", code, imported)
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// XML namespaces of the WebDAV and CardDAV elements
+const (
+	nsDAV     = "DAV:"
+	nsCardDAV = "urn:ietf:params:xml:ns:carddav"
+	// getctag comes from the CalendarServer extensions, which clients still use to tell
+	// whether an address book changed at all
+	nsCalendarServer = "http://calendarserver.org/ns/"
+)
+
+// Prefixes the namespaces are written with
+var davPrefixes = map[string]string{
+	nsDAV:            "d",
+	nsCardDAV:        "card",
+	nsCalendarServer: "cs",
+}
+
+// Largest WebDAV request body the server reads
+const maxDAVBodyBytes = 1 << 20
+
+// xmlElement is any element of a request body, like a property name inside DAV:prop
+type xmlElement struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+}
+
+// Return the value of the element's attribute with the given local name, or ""
+func (e *xmlElement) attr(name string) string {
+	for _, attr := range e.Attrs {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// propNames lists the properties a client asks for in DAV:prop
+type propNames struct {
+	Names []xmlElement `xml:",any"`
+}
+
+// Body of a PROPFIND request. No body means allprop.
+type propfindRequest struct {
+	XMLName  xml.Name   `xml:"DAV: propfind"`
+	AllProp  *struct{}  `xml:"DAV: allprop"`
+	PropName *struct{}  `xml:"DAV: propname"`
+	Prop     *propNames `xml:"DAV: prop"`
+}
+
+// Read the XML request body into dst. An empty body leaves dst as it is and reports false.
+func readXML(w http.ResponseWriter, r *http.Request, dst any) (bool, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxDAVBodyBytes)
+
+	err := xml.NewDecoder(r.Body).Decode(dst)
+	switch {
+	case errors.Is(err, io.EOF):
+		return false, nil
+	case err != nil:
+		return false, fmt.Errorf("body contains badly-formed XML: %w", err)
+	}
+	return true, nil
+}
+
+// davProp is a property of a resource, with its value as XML written with the davPrefixes
+type davProp struct {
+	name  xml.Name
+	value string
+}
+
+// davResponse is the part of a multistatus response about a single resource. A response with
+// a status and no properties reports the resource itself, as with a deleted card in a sync report.
+type davResponse struct {
+	href    string
+	status  int
+	found   []davProp
+	missing []xml.Name
+}
+
+// multistatus collects the responses about every resource a request touched
+type multistatus struct {
+	responses []davResponse
+	syncToken string
+}
+
+// Write the multistatus as a 207 response
+func (ms *multistatus) write(w http.ResponseWriter) {
+	var b strings.Builder
+
+	b.WriteString(xml.Header)
+	b.WriteString(`<d:multistatus xmlns:d="DAV:" xmlns:card="urn:ietf:params:xml:ns:carddav" xmlns:cs="http://calendarserver.org/ns/">`)
+
+	for _, response := range ms.responses {
+		b.WriteString("<d:response><d:href>" + escapeXML(response.href) + "</d:href>")
+
+		if response.status != 0 {
+			b.WriteString(statusElement(response.status))
+		}
+
+		if len(response.found) > 0 {
+			b.WriteString("<d:propstat><d:prop>")
+			for _, prop := range response.found {
+				b.WriteString(propElement(prop.name, prop.value))
+			}
+			b.WriteString("</d:prop>" + statusElement(http.StatusOK) + "</d:propstat>")
+		}
+
+		if len(response.missing) > 0 {
+			b.WriteString("<d:propstat><d:prop>")
+			for _, name := range response.missing {
+				b.WriteString(propElement(name, ""))
+			}
+			b.WriteString("</d:prop>" + statusElement(http.StatusNotFound) + "</d:propstat>")
+		}
+
+		b.WriteString("</d:response>")
+	}
+
+	if ms.syncToken != "" {
+		b.WriteString("<d:sync-token>" + escapeXML(ms.syncToken) + "</d:sync-token>")
+	}
+	b.WriteString("</d:multistatus>")
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	_, _ = io.WriteString(w, b.String())
+}
+
+// Write the element with the given name and inner XML. Elements in namespaces without a prefix
+// declare their namespace themselves.
+func propElement(name xml.Name, inner string) string {
+	tag, declaration := name.Local, ""
+	if prefix, ok := davPrefixes[name.Space]; ok {
+		tag = prefix + ":" + name.Local
+	} else if name.Space != "" {
+		tag, declaration = "x:"+name.Local, ` xmlns:x="`+escapeXML(name.Space)+`"`
+	}
+
+	if inner == "" {
+		return "<" + tag + declaration + "/>"
+	}
+	return "<" + tag + declaration + ">" + inner + "</" + tag + ">"
+}
+
+func statusElement(status int) string {
+	return fmt.Sprintf("<d:status>HTTP/1.1 %d %s</d:status>", status, http.StatusText(status))
+}
+
+// Escape text for use in XML character data and attribute values
+func escapeXML(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// Send a WebDAV error response, with the precondition or postcondition which failed
+func (app *application) davErrorResponse(w http.ResponseWriter, status int, condition xml.Name, description string) {
+	body := xml.Header + `<d:error xmlns:d="DAV:" xmlns:card="urn:ietf:params:xml:ns:carddav" xmlns:cs="http://calendarserver.org/ns/">` +
+		propElement(condition, "")
+	if description != "" {
+		body += "<d:responsedescription>" + escapeXML(description) + "</d:responsedescription>"
+	}
+	body += "</d:error>"
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(status)
+	_, _ = io.WriteString(w, body)
+}
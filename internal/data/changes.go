@@ -0,0 +1,155 @@
+package data
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrInvalidSyncToken = errors.New("invalid sync token")
+)
+
+// Most changes the journal remembers. Clients which last synced before the oldest one
+// have to start over with a full sync.
+const maxJournalChanges = 10000
+
+// Sync tokens are URIs, as RFC 6578 requires
+const syncTokenPrefix = "data:,sync-"
+
+// changeJournal remembers which contacts were created, updated or deleted through the model,
+// so clients can ask for the changes since their last sync instead of fetching every contact.
+// The journal lives in memory only. Every process starts a new epoch, so tokens handed out
+// before a restart are rejected rather than silently missing changes.
+type changeJournal struct {
+	mu    sync.Mutex
+	epoch string
+	seq   int64
+	// ids of the changed contacts, the change with sequence number seq-len(ids)+i+1 at index i
+	ids []int64
+	// card names of the deleted contacts which had one, as long as their deletion is in ids
+	cardNames map[int64]string
+}
+
+func newChangeJournal() *changeJournal {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return &changeJournal{epoch: hex.EncodeToString(b), cardNames: map[int64]string{}}
+}
+
+// Record a change of the contact with the given id
+func (j *changeJournal) record(id int64) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.add(id)
+}
+
+// Record the deletion of the contact with the given id, whose card had the given name
+func (j *changeJournal) recordDeleted(id int64, cardName string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.add(id)
+	if cardName != "" {
+		j.cardNames[id] = cardName
+	}
+}
+
+// Add the change, dropping the oldest one when the journal is full. The caller has to hold the lock.
+func (j *changeJournal) add(id int64) {
+	j.seq++
+	j.ids = append(j.ids, id)
+	if len(j.ids) <= maxJournalChanges {
+		return
+	}
+
+	dropped := j.ids[0]
+	j.ids = slices.Clone(j.ids[len(j.ids)-maxJournalChanges:])
+	if _, ok := j.cardNames[dropped]; ok && !slices.Contains(j.ids, dropped) {
+		delete(j.cardNames, dropped)
+	}
+}
+
+// Return the card name of the deleted contact with the given id, or "" when it had none
+func (j *changeJournal) deletedCardName(id int64) string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.cardNames[id]
+}
+
+// Return the token of the current state
+func (j *changeJournal) token() string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return fmt.Sprintf("%s%s-%d", syncTokenPrefix, j.epoch, j.seq)
+}
+
+// Return the ids of the contacts changed since the state the token was handed out for, each once,
+// together with the token of the current state
+func (j *changeJournal) since(token string) ([]int64, string, error) {
+	epoch, seqText, ok := strings.Cut(strings.TrimPrefix(token, syncTokenPrefix), "-")
+	seq, err := strconv.ParseInt(seqText, 10, 64)
+	if !strings.HasPrefix(token, syncTokenPrefix) || !ok || err != nil {
+		return nil, "", ErrInvalidSyncToken
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	oldest := j.seq - int64(len(j.ids))
+	if epoch != j.epoch || seq < oldest || seq > j.seq {
+		return nil, "", ErrInvalidSyncToken
+	}
+
+	var ids []int64
+	for _, id := range j.ids[seq-oldest:] {
+		if !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+
+	return ids, fmt.Sprintf("%s%s-%d", syncTokenPrefix, j.epoch, j.seq), nil
+}
+
+// Return the token of the current state of the contacts, see ChangesSince
+func (cm *ContactsModel) SyncToken() string {
+	return cm.indexes.journal(cm.tenant).token()
+}
+
+// Return the ids of the contacts created, updated or deleted since the token was returned by SyncToken
+// or ChangesSince, and the token of the current state. ErrInvalidSyncToken is returned when the changes
+// since the token are no longer known. Changes made to the store directly, like removing the values of
+// a deleted custom field, are not included.
+func (cm *ContactsModel) ChangesSince(token string) ([]int64, string, error) {
+	return cm.indexes.journal(cm.tenant).since(token)
+}
+
+// Return the card name of a contact ChangesSince reported and which is deleted, or "" when its card
+// was named after its id
+func (cm *ContactsModel) DeletedCardName(id int64) string {
+	return cm.indexes.journal(cm.tenant).deletedCardName(id)
+}
+
+// Return a tag which changes whenever any contact is created, updated or deleted, however it was changed
+func (cm *ContactsModel) CollectionTag() (string, error) {
+	contacts, err := cm.Store.List(cm.tenant)
+	if err != nil {
+		return "", err
+	}
+
+	h := fnv.New64a()
+	for _, contact := range contacts {
+		fmt.Fprintf(h, "%d:%d;", contact.ID, contact.Version)
+	}
+	return strconv.FormatUint(h.Sum64(), 36), nil
+}
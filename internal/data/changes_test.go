@@ -0,0 +1,141 @@
+package data
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestChangeJournal(t *testing.T) {
+	j := newChangeJournal()
+	start := j.token()
+
+	j.record(3)
+	j.record(1)
+	j.record(3)
+	middle := j.token()
+	j.record(2)
+
+	testCases := []struct {
+		name     string
+		token    string
+		expected []int64
+		err      error
+	}{
+		{"from the start", start, []int64{1, 2, 3}, nil},
+		{"from the middle", middle, []int64{2}, nil},
+		{"current", j.token(), nil, nil},
+		{"other epoch", "data:,sync-0000000000000000-1", nil, ErrInvalidSyncToken},
+		{"future", syncTokenPrefix + j.epoch + "-99", nil, ErrInvalidSyncToken},
+		{"malformed", "sync-1", nil, ErrInvalidSyncToken},
+	}
+
+	for _, tc := range testCases {
+		ids, token, err := j.since(tc.token)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("%s: want error %v; got %v", tc.name, tc.err, err)
+			continue
+		}
+		if !slices.Equal(ids, tc.expected) {
+			t.Errorf("%s: want %v; got %v", tc.name, tc.expected, ids)
+		}
+		if err == nil && token != j.token() {
+			t.Errorf("%s: want token %q; got %q", tc.name, j.token(), token)
+		}
+	}
+}
+
+// Testing that tokens older than the changes the journal remembers are rejected
+func TestChangeJournalCap(t *testing.T) {
+	j := newChangeJournal()
+	start := j.token()
+
+	for i := range maxJournalChanges + 1 {
+		j.record(int64(i))
+	}
+
+	if _, _, err := j.since(start); !errors.Is(err, ErrInvalidSyncToken) {
+		t.Errorf("want %v; got %v", ErrInvalidSyncToken, err)
+	}
+}
+
+// Testing that the model journals inserts, updates and deletes, and that the collection tag follows them
+func TestChangesSince(t *testing.T) {
+	data := []Contact{
+		{ID: 1, FirstName: "Veljko", LastName: "Ilic", Telephone: "+38163577442"},
+		{ID: 2, FirstName: "Marko", LastName: "Markovic", Telephone: "+38163587442"},
+	}
+
+	forEachStore(t, data, func(t *testing.T, cm ContactsModel) {
+		token := cm.SyncToken()
+		tag, err := cm.CollectionTag()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		contact := &Contact{FirstName: "Ana", LastName: "Anic", Telephone: "+38164598332"}
+		if err := cm.InsertContact(contact); err != nil {
+			t.Fatal(err)
+		}
+		updated, err := cm.GetContact(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		updated.Notes = "met at the conference"
+		if err := cm.UpdateContact(updated); err != nil {
+			t.Fatal(err)
+		}
+		if err := cm.DeleteContactVersion(2, AnyVersion); err != nil {
+			t.Fatal(err)
+		}
+
+		ids, _, err := cm.ChangesSince(token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []int64{1, 2, contact.ID}; !slices.Equal(ids, want) {
+			t.Errorf("want %v; got %v", want, ids)
+		}
+
+		if got, err := cm.CollectionTag(); err != nil || got == tag {
+			t.Errorf("want the tag to change from %q; got %q, %v", tag, got, err)
+		}
+	})
+}
+
+// Testing that cards created by CardDAV clients keep their names, unique within the tenant,
+// and that a deleted card is reported under its name
+func TestCardNames(t *testing.T) {
+	forEachStore(t, nil, func(t *testing.T, cm ContactsModel) {
+		token := cm.SyncToken()
+
+		card := &Contact{FirstName: "Veljko", LastName: "Ilic", Telephone: "+38163577442", CardName: "0b6e2f.vcf"}
+		if err := cm.InsertContact(card); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := cm.GetContactByCardName("0b6e2f.vcf")
+		if err != nil || got.ID != card.ID || got.CardName != "0b6e2f.vcf" {
+			t.Errorf("want the contact of the card; got %+v, %v", got, err)
+		}
+		if _, err := cm.GetContactByCardName("other.vcf"); !errors.Is(err, ErrRecordNotFound) {
+			t.Errorf("want %v; got %v", ErrRecordNotFound, err)
+		}
+
+		other := &Contact{FirstName: "Marko", LastName: "Markovic", Telephone: "+38163587442", CardName: "0b6e2f.vcf"}
+		if err := cm.InsertContact(other); !errors.Is(err, ErrDuplicateContact) {
+			t.Errorf("want %v for a taken card name; got %v", ErrDuplicateContact, err)
+		}
+		if err := cm.ForTenant("sales").InsertContact(other); err != nil {
+			t.Errorf("want the name free in another tenant; got %v", err)
+		}
+
+		if err := cm.DeleteContact(card.ID); err != nil {
+			t.Fatal(err)
+		}
+		ids, _, err := cm.ChangesSince(token)
+		if err != nil || !slices.Equal(ids, []int64{card.ID}) || cm.DeletedCardName(card.ID) != "0b6e2f.vcf" {
+			t.Errorf("want the deleted card reported by its name; got %v, %q, %v", ids, cm.DeletedCardName(card.ID), err)
+		}
+	})
+}
@@ -1,43 +1,246 @@
 package data
 
 import (
-	"encoding/json"
+	"cmp"
 	"errors"
 	"fmt"
-	"io"
-	"os"
+	"maps"
+	"salestrekker_technical_interview.veljkoilic/internal/phonenumber"
 	"salestrekker_technical_interview.veljkoilic/internal/validator"
+	"slices"
+	"strings"
+	"time"
 )
 
 var (
 	ErrRecordNotFound = errors.New("record not found")
+	ErrEditConflict   = errors.New("edit conflict")
 )
 
+// Passed as the version to DeleteContactVersion when any version of the contact may be deleted
+const AnyVersion int32 = 0
+
+// Region telephone numbers written without a country code are read in.
+// It is set from the command line at startup.
+var DefaultPhoneRegion = "RS"
+
+// Limits on the contact fields, checked by ValidateContact
+const (
+	maxNameChars    = 100
+	maxLabelChars   = 50
+	maxCompanyChars = 200
+	maxNotesChars   = 5000
+	maxListEntries  = 10
+	maxTags         = 20
+)
+
+// Contact is a person in the address book of a tenant. ID is unique among the contacts of the tenant.
+// Telephone is the primary number, Telephones holds any additional labelled numbers.
+// Version starts at 1 and is incremented every time the contact is updated.
+// CardName is the name a CardDAV client created the contact's card under, unique among the cards of the tenant.
+// Contacts created any other way have none, and their cards are named after their id.
+// Carrier and NumberType are derived from Telephone by the model and are never stored.
 type Contact struct {
-	ID        int64  `json:"id"`
-	FirstName string `json:"first_name"`
-	LastName  string `json:"last_name"`
-	Telephone string `json:"telephone"`
+	ID         int64          `json:"id"`
+	Tenant     string         `json:"tenant"`
+	FirstName  string         `json:"first_name"`
+	LastName   string         `json:"last_name"`
+	Telephone  string         `json:"telephone"`
+	Telephones []Phone        `json:"telephones,omitempty"`
+	Emails     []Email        `json:"emails,omitempty"`
+	Addresses  []Address      `json:"addresses,omitempty"`
+	Company    string         `json:"company,omitempty"`
+	JobTitle   string         `json:"job_title,omitempty"`
+	Birthday   *Date          `json:"birthday,omitempty"`
+	Notes      string         `json:"notes,omitempty"`
+	Tags       []string       `json:"tags,omitempty"`
+	Custom     map[string]any `json:"custom,omitempty"`
+	CardName   string         `json:"card_name,omitempty"`
+	Carrier    string         `json:"carrier,omitempty"`
+	NumberType string         `json:"number_type,omitempty"`
+	Version    int32          `json:"version"`
+}
+
+// Phone is a telephone number with a label like "work" or "home"
+type Phone struct {
+	Label  string `json:"label,omitempty"`
+	Number string `json:"number"`
 }
 
+// Email is an email address with a label like "work" or "home"
+type Email struct {
+	Label   string `json:"label,omitempty"`
+	Address string `json:"address"`
+}
+
+// Address is a postal address with a label like "work" or "home"
+type Address struct {
+	Label      string `json:"label,omitempty"`
+	Street     string `json:"street,omitempty"`
+	City       string `json:"city,omitempty"`
+	PostalCode string `json:"postal_code,omitempty"`
+	Country    string `json:"country,omitempty"`
+}
+
+// Return a deep copy of the contact, which shares no slices or pointers with the original
+func (c *Contact) clone() Contact {
+	clone := *c
+	clone.Telephones = slices.Clone(c.Telephones)
+	clone.Emails = slices.Clone(c.Emails)
+	clone.Addresses = slices.Clone(c.Addresses)
+	clone.Tags = slices.Clone(c.Tags)
+	clone.Custom = maps.Clone(c.Custom)
+	if c.Birthday != nil {
+		birthday := *c.Birthday
+		clone.Birthday = &birthday
+	}
+	return clone
+}
+
+// ContactsModel is what the handlers use to work with the contacts of a tenant.
+// The contacts themselves are kept in whichever ContactStore the model was created with,
+// the model keeps a search index of them up to date and a journal of their changes.
 type ContactsModel struct {
-	Contacts []Contact
+	Store   ContactStore
+	tenant  string
+	indexes *tenantIndexes
 }
 
-func NewModel() ContactsModel {
+// Create a model of the contacts of DefaultTenant. Models of the other tenants are made with ForTenant.
+func NewModel(store ContactStore) ContactsModel {
 	return ContactsModel{
-		Contacts: []Contact{},
+		Store:   store,
+		tenant:  DefaultTenant,
+		indexes: newTenantIndexes(),
 	}
 }
 
-func ValidateContact(v *validator.Validator, contact *Contact) {
+// Return a model of the contacts of the tenant, sharing the store, the search indexes and the journals with cm
+func (cm *ContactsModel) ForTenant(tenant string) *ContactsModel {
+	scoped := *cm
+	scoped.tenant = tenant
+	return &scoped
+}
+
+// Return the tenant whose contacts the model works with
+func (cm *ContactsModel) Tenant() string {
+	return cm.tenant
+}
+
+// Validate the contact. Its custom values are checked against the fields of the custom field schema.
+func ValidateContact(v *validator.Validator, contact *Contact, fields []Field) {
 	// check if the fields are empty
 	v.Check(contact.FirstName != "", "first_name", "must be provided")
 	v.Check(contact.LastName != "", "last_name", "must be provided")
 	v.Check(contact.Telephone != "", "telephone", "must be provided")
 
-	// check if the telephone field is valid for Serbia
-	v.Check(validator.Matches(contact.Telephone, validator.PhoneRX), "telephone", "must be valid Serbian number (example: +38163567893)")
+	// check if the telephone field holds a number which can exist, in any of the supported formats
+	v.Check(validPhoneNumber(contact.Telephone), "telephone", "must be a valid telephone number (example: +38163567893)")
+
+	v.Check(validator.MaxChars(contact.FirstName, maxNameChars), "first_name", fmt.Sprintf("must not be more than %d characters long", maxNameChars))
+	v.Check(validator.MaxChars(contact.LastName, maxNameChars), "last_name", fmt.Sprintf("must not be more than %d characters long", maxNameChars))
+
+	v.Check(len(contact.Telephones) <= maxListEntries, "telephones", fmt.Sprintf("must not contain more than %d entries", maxListEntries))
+	for i, phone := range contact.Telephones {
+		key := fmt.Sprintf("telephones[%d]", i)
+		v.Check(phone.Number != "", key+".number", "must be provided")
+		v.Check(validPhoneNumber(phone.Number), key+".number", "must be a valid telephone number (example: +38163567893)")
+		v.Check(validator.MaxChars(phone.Label, maxLabelChars), key+".label", fmt.Sprintf("must not be more than %d characters long", maxLabelChars))
+	}
+
+	v.Check(len(contact.Emails) <= maxListEntries, "emails", fmt.Sprintf("must not contain more than %d entries", maxListEntries))
+	for i, email := range contact.Emails {
+		key := fmt.Sprintf("emails[%d]", i)
+		v.Check(email.Address != "", key+".address", "must be provided")
+		v.Check(validator.ValidEmail(email.Address), key+".address", "must be a valid email address")
+		v.Check(validator.MaxChars(email.Label, maxLabelChars), key+".label", fmt.Sprintf("must not be more than %d characters long", maxLabelChars))
+	}
+
+	v.Check(len(contact.Addresses) <= maxListEntries, "addresses", fmt.Sprintf("must not contain more than %d entries", maxListEntries))
+	for i, address := range contact.Addresses {
+		key := fmt.Sprintf("addresses[%d]", i)
+		v.Check(address.Street != "" || address.City != "", key, "must contain a street or a city")
+		v.Check(validator.MaxChars(address.Label, maxLabelChars), key+".label", fmt.Sprintf("must not be more than %d characters long", maxLabelChars))
+		v.Check(validator.MaxChars(address.Street, maxCompanyChars), key+".street", fmt.Sprintf("must not be more than %d characters long", maxCompanyChars))
+		v.Check(validator.MaxChars(address.City, maxNameChars), key+".city", fmt.Sprintf("must not be more than %d characters long", maxNameChars))
+		v.Check(validator.MaxChars(address.PostalCode, 20), key+".postal_code", "must not be more than 20 characters long")
+		v.Check(validator.MaxChars(address.Country, maxNameChars), key+".country", fmt.Sprintf("must not be more than %d characters long", maxNameChars))
+	}
+
+	v.Check(validator.MaxChars(contact.Company, maxCompanyChars), "company", fmt.Sprintf("must not be more than %d characters long", maxCompanyChars))
+	v.Check(validator.MaxChars(contact.JobTitle, maxCompanyChars), "job_title", fmt.Sprintf("must not be more than %d characters long", maxCompanyChars))
+	v.Check(validator.MaxChars(contact.Notes, maxNotesChars), "notes", fmt.Sprintf("must not be more than %d characters long", maxNotesChars))
+
+	v.Check(len(contact.Tags) <= maxTags, "tags", fmt.Sprintf("must not contain more than %d entries", maxTags))
+	for i, tag := range contact.Tags {
+		key := fmt.Sprintf("tags[%d]", i)
+		v.Check(strings.TrimSpace(tag) != "", key, "must not be empty")
+		v.Check(validator.MaxChars(tag, maxLabelChars), key, fmt.Sprintf("must not be more than %d characters long", maxLabelChars))
+	}
+
+	validateCustomValues(v, contact.Custom, fields)
+
+	// birthdays can not be in the future, or so far in the past that they are surely a typo
+	if contact.Birthday != nil {
+		earliest := time.Date(1900, time.January, 1, 0, 0, 0, 0, time.UTC)
+		v.Check(validator.InDateRange(contact.Birthday.Time, earliest, time.Now()), "birthday", "must be between 1900-01-01 and today")
+	}
+}
+
+// Report whether the number can be parsed, either in the international format or
+// in the national format of the DefaultPhoneRegion
+func validPhoneNumber(number string) bool {
+	_, err := phonenumber.Parse(number, DefaultPhoneRegion)
+	return err == nil
+}
+
+// Prepare the contact for the store. Every telephone number is stored in the E.164 format,
+// so the same number typed in different ways is stored, compared and searched for the same.
+// Numbers which can not be parsed are left as they are. The derived fields are cleared,
+// so they are never stored.
+func normalizeContact(contact *Contact) {
+	contact.Carrier, contact.NumberType = "", ""
+
+	normalize := func(number string) string {
+		parsed, err := phonenumber.Parse(number, DefaultPhoneRegion)
+		if err != nil {
+			return number
+		}
+		return parsed.E164()
+	}
+
+	contact.Telephone = normalize(contact.Telephone)
+	for i := range contact.Telephones {
+		contact.Telephones[i].Number = normalize(contact.Telephones[i].Number)
+	}
+
+	// tags are trimmed and kept once, in the case they were first written in
+	var tags []string
+	for _, tag := range contact.Tags {
+		tag = strings.TrimSpace(tag)
+		if tag != "" && !slices.ContainsFunc(tags, func(t string) bool { return strings.EqualFold(t, tag) }) {
+			tags = append(tags, tag)
+		}
+	}
+	contact.Tags = tags
+
+	if len(contact.Custom) == 0 {
+		contact.Custom = nil
+	}
+}
+
+// Fill in the fields derived from the primary telephone number. They are computed every time
+// a contact leaves the model, so an updated carrier table applies to every stored contact.
+func deriveFields(contact *Contact) {
+	contact.Carrier, contact.NumberType = "", ""
+
+	number, err := phonenumber.Parse(contact.Telephone, DefaultPhoneRegion)
+	if err != nil {
+		return
+	}
+
+	contact.Carrier = phonenumber.Carrier(number)
+	contact.NumberType = number.Type.String()
 }
 
 // get a specific record from the contacts
@@ -46,96 +249,324 @@ func (cm *ContactsModel) GetContact(id int64) (*Contact, error) {
 		return nil, ErrRecordNotFound
 	}
 
-	for _, contact := range cm.Contacts {
-		if contact.ID == id {
-			return &contact, nil
-		}
+	contact, err := cm.Store.Get(cm.tenant, id)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil, ErrRecordNotFound
+	deriveFields(contact)
+	return contact, nil
 }
 
-// inserting a new record in the contacts file
-func (cm *ContactsModel) InsertContact(contact *Contact) error {
+// get the contact whose card a CardDAV client created under the given name
+func (cm *ContactsModel) GetContactByCardName(name string) (*Contact, error) {
+	if name == "" {
+		return nil, ErrRecordNotFound
+	}
 
-	for _, existingContact := range cm.Contacts {
-		if areContactsEqual(&existingContact, contact) {
-			return errors.New("same contact already exists")
+	contacts, err := cm.Store.List(cm.tenant)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range contacts {
+		if contacts[i].CardName == name {
+			deriveFields(&contacts[i])
+			return &contacts[i], nil
 		}
 	}
+	return nil, ErrRecordNotFound
+}
+
+// get all the records from the contacts
+func (cm *ContactsModel) ListContacts() ([]Contact, error) {
+	contacts, err := cm.Store.List(cm.tenant)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range contacts {
+		deriveFields(&contacts[i])
+	}
+	return contacts, nil
+}
 
-	// Generate an id for the new contact and assign it to ID field of the contact
-	newContactID := generateID(cm.Contacts)
-	contact.ID = newContactID
-	cm.Contacts = append(cm.Contacts, *contact)
+// ContactFilter holds the values list requests can filter contacts by.
+// Empty fields match every contact, the names and the telephone match case-insensitively
+// anywhere in the field. Carrier has to match the whole carrier name and Tag one of the
+// contact's tags, ignoring case. Group matches the members of the group with that id.
+type ContactFilter struct {
+	FirstName string
+	LastName  string
+	Telephone string
+	Carrier   string
+	Tag       string
+	Group     int64
 
-	// Save all contacts + newly created one to the file
-	cm.SaveAllContacts()
-	return nil
+	// members of the Group, loaded by the model before the filter is applied
+	members []int64
 }
 
-// Delete a specific record in the contacts file
-func (cm *ContactsModel) DeleteContact(id int64) error {
+// Report whether the contact passes the filter. The contact's derived fields have to be filled in.
+func (f ContactFilter) matches(contact *Contact) bool {
+	return containsFold(contact.FirstName, f.FirstName) &&
+		containsFold(contact.LastName, f.LastName) &&
+		containsFold(contact.Telephone, f.Telephone) &&
+		(f.Carrier == "" || strings.EqualFold(contact.Carrier, f.Carrier)) &&
+		(f.Tag == "" || slices.ContainsFunc(contact.Tags, func(tag string) bool { return strings.EqualFold(tag, f.Tag) })) &&
+		(f.Group == 0 || f.inGroup(contact.ID))
+}
 
-	if id < 1 {
-		return ErrRecordNotFound
+// Report whether the contact is a member of the filter's group. The members are sorted by id.
+func (f ContactFilter) inGroup(id int64) bool {
+	_, found := slices.BinarySearch(f.members, id)
+	return found
+}
+
+// Load the members of the group the filter matches, if it has one.
+// A group which does not exist has no members, so the filter matches no contacts.
+func (cm *ContactsModel) loadGroupMembers(match *ContactFilter) error {
+	if match.Group == 0 {
+		return nil
 	}
 
-	// Loop through the slice of Contacts and delete a contact if it finds matching id
-	for ind, contact := range cm.Contacts {
-		if contact.ID == id {
-			cm.Contacts = append(cm.Contacts[:ind], cm.Contacts[ind+1:]...)
-			cm.SaveAllContacts()
+	group, err := cm.Store.GetGroup(cm.tenant, match.Group)
+	if err != nil {
+		if errors.Is(err, ErrRecordNotFound) {
+			match.members = []int64{}
 			return nil
 		}
+		return err
+	}
+
+	match.members = group.ContactIDs
+	return nil
+}
+
+// get one page of the records which pass the filter, sorted as filters describe,
+// together with the pagination metadata
+func (cm *ContactsModel) FilterContacts(match ContactFilter, filters Filters) ([]Contact, Metadata, error) {
+	err := cm.loadGroupMembers(&match)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	contacts, err := cm.ListContacts()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	filtered := contacts[:0]
+	for _, contact := range contacts {
+		if match.matches(&contact) {
+			filtered = append(filtered, contact)
+		}
 	}
 
-	// Return error if record is not found
-	return ErrRecordNotFound
+	sortContacts(filtered, filters.sortColumn(), filters.sortDescending())
+
+	metadata := calculateMetadata(len(filtered), filters.Page, filters.PageSize)
+
+	// With a cursor the page starts right after the contact the cursor points to,
+	// otherwise at the page offset
+	start := min(filters.offset(), len(filtered))
+	if filters.After > 0 {
+		start, _ = slices.BinarySearchFunc(filtered, filters.After+1, func(c Contact, id int64) int {
+			return cmp.Compare(c.ID, id)
+		})
+		metadata.CurrentPage, metadata.FirstPage, metadata.LastPage = 0, 0, 0
+	}
+	end := min(start+filters.limit(), len(filtered))
+
+	if filters.Sort == "id" && end < len(filtered) {
+		metadata.NextAfter = filtered[end-1].ID
+	}
+
+	return filtered[start:end], metadata, nil
 }
 
-// Load a contact list from a file
-func (cm *ContactsModel) GetAllContacts() error {
-	// Create a file if it does not exist, open if exists
-	file, err := os.OpenFile("contacts.json", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+// Send every contact which passes the filter to fn, in id order, stopping at the first error fn returns
+func (cm *ContactsModel) EachContact(match ContactFilter, fn func(contact *Contact) error) error {
+	err := cm.loadGroupMembers(&match)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
 
-	// Load the contacts to the list
-	err = json.NewDecoder(file).Decode(&cm.Contacts)
-	if err != nil && err != io.EOF {
+	contacts, err := cm.ListContacts()
+	if err != nil {
 		return err
 	}
+
+	for i := range contacts {
+		if !match.matches(&contacts[i]) {
+			continue
+		}
+
+		err := fn(&contacts[i])
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-// Save all existing contacts to a JSON file
-func (cm *ContactsModel) SaveAllContacts() {
-	file, err := os.OpenFile("contacts.json", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+// inserting a new record in the contacts store of the tenant, with its telephone numbers normalized to E.164
+func (cm *ContactsModel) InsertContact(contact *Contact) error {
+	contact.Tenant = cm.tenant
+	normalizeContact(contact)
+
+	err := cm.Store.Insert(contact)
 	if err != nil {
-		fmt.Println("Error saving file:", err)
-		return
+		return err
+	}
+
+	deriveFields(contact)
+	cm.indexes.searchIndex(cm.tenant).add(contact)
+	cm.indexes.journal(cm.tenant).record(contact.ID)
+	return nil
+}
+
+// Replace the stored record which has the same id as the contact passed in.
+// The contact's version has to match the stored one, otherwise ErrEditConflict is returned.
+// On success the contact's version is incremented.
+func (cm *ContactsModel) UpdateContact(contact *Contact) error {
+	if contact.ID < 1 {
+		return ErrRecordNotFound
 	}
-	defer file.Close()
 
-	// Write the updated data back to the file
-	file.Truncate(0)
-	file.Seek(0, 0)
-	encoder := json.NewEncoder(file)
-	err = encoder.Encode(cm.Contacts)
+	contact.Tenant = cm.tenant
+	normalizeContact(contact)
+
+	err := cm.Store.Update(contact)
 	if err != nil {
-		fmt.Println("Error encoding JSON:", err)
-		return
+		return err
+	}
+
+	deriveFields(contact)
+	cm.indexes.searchIndex(cm.tenant).add(contact)
+	cm.indexes.journal(cm.tenant).record(contact.ID)
+	return nil
+}
+
+// Insert the contacts without an id and update the others in a single store write.
+// The error of every contact is returned at its index, see ContactStore.SaveContacts.
+func (cm *ContactsModel) saveContacts(contacts []*Contact) ([]error, error) {
+	for _, contact := range contacts {
+		contact.Tenant = cm.tenant
+		normalizeContact(contact)
 	}
+
+	errs, err := cm.Store.SaveContacts(contacts)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, contact := range contacts {
+		if errs[i] == nil {
+			deriveFields(contact)
+			cm.indexes.searchIndex(cm.tenant).add(contact)
+			cm.indexes.journal(cm.tenant).record(contact.ID)
+		}
+	}
+	return errs, nil
+}
+
+// Delete a specific record in the contacts store
+func (cm *ContactsModel) DeleteContact(id int64) error {
+	return cm.DeleteContactVersion(id, AnyVersion)
+}
+
+// Delete a specific record in the contacts store, as long as it is still at the given version
+func (cm *ContactsModel) DeleteContactVersion(id int64, version int32) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	deleted, err := cm.Store.Delete(cm.tenant, id, version)
+	if err != nil {
+		return err
+	}
+
+	// sync clients are told which card is gone by its name, which is lost with the contact
+	cm.indexes.searchIndex(cm.tenant).remove(id)
+	cm.indexes.journal(cm.tenant).recordDeleted(id, deleted.CardName)
+	return nil
+}
+
+// Search the contacts by first name, last name and telephone, tolerating typos and
+// ignoring the script and diacritics. Up to limit results are returned, best matches first.
+func (cm *ContactsModel) SearchContacts(query string, limit int) ([]SearchResult, error) {
+	index := cm.indexes.searchIndex(cm.tenant)
+
+	err := index.build(cm.Store, cm.tenant)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []SearchResult{}
+	for _, hit := range index.search(query) {
+		if len(results) == limit {
+			break
+		}
+
+		// a contact deleted since the index was searched is left out
+		contact, err := cm.GetContact(hit.id)
+		if err != nil {
+			if errors.Is(err, ErrRecordNotFound) {
+				continue
+			}
+			return nil, err
+		}
+
+		results = append(results, SearchResult{Contact: contact, Score: hit.score})
+	}
+
+	return results, nil
+}
+
+// Close the underlying contacts store
+func (cm *ContactsModel) Close() error {
+	return cm.Store.Close()
+}
+
+// Sort contacts by the given field. Contacts with equal values are ordered by id,
+// so every page is stable.
+func sortContacts(contacts []Contact, column string, descending bool) {
+	slices.SortFunc(contacts, func(a, b Contact) int {
+		var result int
+		switch column {
+		case "id":
+			result = cmp.Compare(a.ID, b.ID)
+		case "first_name":
+			result = strings.Compare(strings.ToLower(a.FirstName), strings.ToLower(b.FirstName))
+		case "last_name":
+			result = strings.Compare(strings.ToLower(a.LastName), strings.ToLower(b.LastName))
+		case "telephone":
+			result = strings.Compare(a.Telephone, b.Telephone)
+		}
+
+		if descending {
+			result = -result
+		}
+		if result == 0 {
+			result = cmp.Compare(a.ID, b.ID)
+		}
+		return result
+	})
+}
+
+// Report whether substr is within s, ignoring case
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
 }
 
-// Generate ID based on the maximum value ID in the dataset
-func generateID(contacts []Contact) int64 {
+// Generate an ID for a new contact of the tenant, based on the maximum ID of the tenant's contacts.
+// Every tenant numbers its contacts on its own.
+func generateID(contacts []Contact, tenant string) int64 {
 	id := int64(0)
 	for _, v := range contacts {
-		if v.ID > id {
+		if v.Tenant == tenant && v.ID > id {
 			id = v.ID
 		}
 	}
@@ -2,8 +2,13 @@ package data
 
 import (
 	"fmt"
+	"reflect"
 	"salestrekker_technical_interview.veljkoilic/internal/validator"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 // Testing areContactsEqual method
@@ -53,17 +58,25 @@ func TestAreContactsEqual(t *testing.T) {
 
 // Testing generateID method
 func TestGenerateID(t *testing.T) {
+	contacts := []Contact{
+		Contact{ID: 1, Tenant: DefaultTenant, FirstName: "Veljko", LastName: "Ilic", Telephone: "+38163577442"},
+		Contact{ID: 2, Tenant: DefaultTenant, FirstName: "Marko", LastName: "Markovic", Telephone: "+38163587442"},
+		Contact{ID: 1, Tenant: "sales", FirstName: "Ana", LastName: "Anic", Telephone: "+38163597442"},
+	}
+
 	testCases := []struct {
 		contacts []Contact
+		tenant   string
 		expected int64
 	}{
-		{[]Contact{}, 1},
-		{[]Contact{Contact{ID: 1, FirstName: "Veljko", LastName: "Ilic", Telephone: "+38163577442"},
-			Contact{ID: 2, FirstName: "Marko", LastName: "Markovic", Telephone: "+38163587442"}}, 3},
+		{[]Contact{}, DefaultTenant, 1},
+		{contacts, DefaultTenant, 3},
+		{contacts, "sales", 2},
+		{contacts, "support", 1},
 	}
 
 	for _, tc := range testCases {
-		got := generateID(tc.contacts)
+		got := generateID(tc.contacts, tc.tenant)
 		if got != tc.expected {
 			t.Errorf("want %d; got %d", tc.expected, got)
 		}
@@ -75,10 +88,10 @@ func TestValidateValidContact(t *testing.T) {
 	v := validator.New()
 	contact := &Contact{FirstName: "Veljko", LastName: "Ilic", Telephone: "+38163577442"}
 
-	ValidateContact(v, contact)
+	ValidateContact(v, contact, nil)
 
 	if !v.IsValid() {
-		fmt.Errorf("want valid; got invalid")
+		t.Errorf("want valid; got invalid")
 	}
 }
 
@@ -94,9 +107,9 @@ func TestValidateInvalidContact(t *testing.T) {
 
 	for _, tc := range testCases {
 		v := validator.New()
-		ValidateContact(v, tc.contact)
+		ValidateContact(v, tc.contact, nil)
 		if v.IsValid() {
-			fmt.Errorf("want invalid; got valid")
+			t.Errorf("want invalid; got valid")
 		}
 	}
 }
@@ -109,24 +122,26 @@ func TestGetContactFromFile(t *testing.T) {
 		{ID: 2, FirstName: "Marko", LastName: "Markovic", Telephone: "+38163587442"},
 	}
 
-	cm := ContactsModel{data}
+	forEachStore(t, data, func(t *testing.T, cm ContactsModel) {
 
-	testCases := []struct {
-		id              int64
-		expectedContact *Contact
-		expectedError   error
-	}{
-		{1, &Contact{ID: 2, FirstName: "Marko", LastName: "Markovic", Telephone: "+38163587442"}, nil},
-		{3, nil, ErrRecordNotFound},
-		{-1, nil, ErrRecordNotFound},
-	}
+		testCases := []struct {
+			id              int64
+			expectedContact *Contact
+			expectedError   error
+		}{
+			{2, &Contact{ID: 2, Tenant: DefaultTenant, FirstName: "Marko", LastName: "Markovic", Telephone: "+38163587442", Carrier: "Yettel", NumberType: "mobile", Version: 1}, nil},
+			{3, nil, ErrRecordNotFound},
+			{-1, nil, ErrRecordNotFound},
+		}
 
-	for _, tc := range testCases {
-		gotCont, gotErr := cm.GetContact(tc.id)
-		if gotCont != tc.expectedContact || gotErr != tc.expectedError {
-			fmt.Errorf("want %v error and %v contact; got %v error and %v contact", tc.expectedError, tc.expectedContact, gotErr, gotCont)
+		for _, tc := range testCases {
+			gotCont, gotErr := cm.GetContact(tc.id)
+			if gotErr != tc.expectedError || (gotCont == nil) != (tc.expectedContact == nil) ||
+				(gotCont != nil && !reflect.DeepEqual(*gotCont, *tc.expectedContact)) {
+				t.Errorf("want %v error and %v contact; got %v error and %v contact", tc.expectedError, tc.expectedContact, gotErr, gotCont)
+			}
 		}
-	}
+	})
 }
 
 // Testing insert contact
@@ -137,25 +152,25 @@ func TestInsertContact(t *testing.T) {
 		{ID: 2, FirstName: "Marko", LastName: "Markovic", Telephone: "+38163587442"},
 	}
 
-	contact := &Contact{FirstName: "Ilija", LastName: "Ilinovic", Telephone: "+38164598332"}
-
-	cm := ContactsModel{data}
-	cm.InsertContact(contact)
+	forEachStore(t, data, func(t *testing.T, cm ContactsModel) {
+		contact := &Contact{FirstName: "Ilija", LastName: "Ilinovic", Telephone: "+38164598332"}
+		cm.InsertContact(contact)
 
-	expectedId := int64(3)
-	gotContact, err := cm.GetContact(expectedId)
+		expectedId := int64(3)
+		gotContact, err := cm.GetContact(expectedId)
 
-	if err != nil {
-		fmt.Errorf("did not get expected value")
-	}
+		if err != nil {
+			t.Fatalf("did not get expected value")
+		}
 
-	if contact != gotContact {
-		fmt.Errorf("did not get expected contact")
-	}
+		if !reflect.DeepEqual(*contact, *gotContact) {
+			t.Errorf("did not get expected contact")
+		}
 
-	if gotContact.ID != expectedId {
-		fmt.Errorf("want %d; got %d", expectedId, gotContact.ID)
-	}
+		if gotContact.ID != expectedId {
+			t.Errorf("want %d; got %d", expectedId, gotContact.ID)
+		}
+	})
 }
 
 func TestInsertSameContact(t *testing.T) {
@@ -164,12 +179,50 @@ func TestInsertSameContact(t *testing.T) {
 	}
 	contact := &Contact{ID: 1, FirstName: "Veljko", LastName: "Ilic", Telephone: "+38163577442"}
 
-	cm := ContactsModel{data}
-	err := cm.InsertContact(contact)
+	forEachStore(t, data, func(t *testing.T, cm ContactsModel) {
+		err := cm.InsertContact(contact)
 
-	if err == nil {
-		fmt.Errorf("expected error")
+		if err != ErrDuplicateContact {
+			t.Errorf("want %v; got %v", ErrDuplicateContact, err)
+		}
+	})
+}
+
+// Testing that telephone numbers are stored in E.164, so the same number typed differently is a duplicate
+func TestInsertNormalizesTelephones(t *testing.T) {
+	data := []Contact{
+		{ID: 1, FirstName: "Veljko", LastName: "Ilic", Telephone: "+38163577442"},
 	}
+
+	forEachStore(t, data, func(t *testing.T, cm ContactsModel) {
+		contact := &Contact{
+			FirstName:  "Marko",
+			LastName:   "Markovic",
+			Telephone:  "063 / 587-442",
+			Telephones: []Phone{{Label: "office", Number: "(011) 123-4567"}, {Label: "berlin", Number: "0049 30 1234567"}},
+		}
+
+		err := cm.InsertContact(contact)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stored, err := cm.GetContact(contact.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := []string{"+38163587442", "+381111234567", "+49301234567"}
+		got := []string{stored.Telephone, stored.Telephones[0].Number, stored.Telephones[1].Number}
+		if !slices.Equal(want, got) {
+			t.Errorf("want %v; got %v", want, got)
+		}
+
+		err = cm.InsertContact(&Contact{FirstName: "Veljko", LastName: "Ilic", Telephone: "063 577 442"})
+		if err != ErrDuplicateContact {
+			t.Errorf("want %v; got %v", ErrDuplicateContact, err)
+		}
+	})
 }
 
 // Test deleting contacts
@@ -178,21 +231,385 @@ func TestDeletingContacts(t *testing.T) {
 		{ID: 1, FirstName: "Veljko", LastName: "Ilic", Telephone: "+38163577442"},
 		{ID: 2, FirstName: "Marko", LastName: "Markovic", Telephone: "+38163587442"},
 	}
-	cm := ContactsModel{data}
+	forEachStore(t, data, func(t *testing.T, cm ContactsModel) {
+
+		testCases := []struct {
+			id  int64
+			err error
+		}{
+			{2, nil},
+			{4, ErrRecordNotFound},
+			{-1, ErrRecordNotFound},
+		}
+
+		for _, tc := range testCases {
+			err := cm.DeleteContact(tc.id)
+			if err != tc.err {
+				t.Errorf("want %v; got %v", tc.err, err)
+			}
+		}
+	})
+}
+
+// Testing that the id of a deleted contact is not given to the next one, even when it was the highest id
+func TestDeletedIDsNotReused(t *testing.T) {
+	data := []Contact{
+		{ID: 1, FirstName: "Veljko", LastName: "Ilic", Telephone: "+38163577442"},
+		{ID: 2, FirstName: "Marko", LastName: "Markovic", Telephone: "+38163587442"},
+	}
+	forEachStore(t, data, func(t *testing.T, cm ContactsModel) {
+		contact := &Contact{FirstName: "Ilija", LastName: "Ilinovic", Telephone: "+38164598332"}
+		if err := cm.InsertContact(contact); err != nil {
+			t.Fatal(err)
+		}
+		if err := cm.DeleteContact(contact.ID); err != nil {
+			t.Fatal(err)
+		}
+		if err := cm.DeleteContact(2); err != nil {
+			t.Fatal(err)
+		}
+
+		next := &Contact{FirstName: "Ana", LastName: "Anic", Telephone: "+38163597442"}
+		if err := cm.InsertContact(next); err != nil {
+			t.Fatal(err)
+		}
+		if next.ID != 4 {
+			t.Errorf("want %d; got %d", 4, next.ID)
+		}
+
+		// the sequence is kept per tenant
+		other := &Contact{FirstName: "Ana", LastName: "Anic", Telephone: "+38163597442"}
+		if err := cm.ForTenant("sales").InsertContact(other); err != nil {
+			t.Fatal(err)
+		}
+		if other.ID != 1 {
+			t.Errorf("want %d; got %d", 1, other.ID)
+		}
+	})
+}
+
+// Test inserting contacts from many goroutines at once
+func TestConcurrentInsertContacts(t *testing.T) {
+	forEachStore(t, nil, func(t *testing.T, cm ContactsModel) {
+		const inserts = 50
+
+		var wg sync.WaitGroup
+		for i := 0; i < inserts; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+
+				contact := &Contact{FirstName: "Veljko", LastName: "Ilic", Telephone: fmt.Sprintf("+3816%07d", i)}
+				if err := cm.InsertContact(contact); err != nil {
+					t.Errorf("want nil; got %v", err)
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		contacts, err := cm.ListContacts()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(contacts) != inserts {
+			t.Errorf("want %d contacts; got %d", inserts, len(contacts))
+		}
+
+		seen := make(map[int64]bool)
+		for _, contact := range contacts {
+			if seen[contact.ID] {
+				t.Errorf("duplicate id %d", contact.ID)
+			}
+			seen[contact.ID] = true
+		}
+	})
+}
+
+// Test updating contacts
+func TestUpdateContact(t *testing.T) {
+	data := []Contact{
+		{ID: 1, FirstName: "Veljko", LastName: "Ilic", Telephone: "+38163577442"},
+		{ID: 2, FirstName: "Marko", LastName: "Markovic", Telephone: "+38163587442"},
+	}
+	forEachStore(t, data, func(t *testing.T, cm ContactsModel) {
+		testCases := []struct {
+			contact *Contact
+			err     error
+		}{
+			{&Contact{ID: 2, FirstName: "Marko", LastName: "Markovic", Telephone: "+38164111222", Version: 1}, nil},
+			{&Contact{ID: 2, FirstName: "Veljko", LastName: "Ilic", Telephone: "+38163577442", Version: 2}, ErrDuplicateContact},
+			{&Contact{ID: 2, FirstName: "Marko", LastName: "Markovic", Telephone: "+38164333444", Version: 1}, ErrEditConflict},
+			{&Contact{ID: 4, FirstName: "Ilija", LastName: "Ilinovic", Telephone: "+38164598332", Version: 1}, ErrRecordNotFound},
+			{&Contact{ID: -1, FirstName: "Ilija", LastName: "Ilinovic", Telephone: "+38164598332", Version: 1}, ErrRecordNotFound},
+		}
+
+		for _, tc := range testCases {
+			err := cm.UpdateContact(tc.contact)
+			if err != tc.err {
+				t.Errorf("want %v; got %v", tc.err, err)
+			}
+		}
+
+		// only the first update was saved
+		got, err := cm.GetContact(2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(*got, *testCases[0].contact) {
+			t.Errorf("want %v; got %v", *testCases[0].contact, *got)
+		}
+	})
+}
+
+// Testing that contacts saved together fail on their own and the rest are still stored
+func TestSaveContacts(t *testing.T) {
+	data := []Contact{
+		{ID: 1, FirstName: "Veljko", LastName: "Ilic", Telephone: "+38163577442"},
+		{ID: 2, FirstName: "Marko", LastName: "Markovic", Telephone: "+38163587442"},
+	}
+	forEachStore(t, data, func(t *testing.T, cm ContactsModel) {
+		contacts := []*Contact{
+			{FirstName: "Ana", LastName: "Anic", Telephone: "+38163111222"},
+			{ID: 2, FirstName: "Marko", LastName: "Markovic", Telephone: "+38164111222", Version: 1},
+			{FirstName: "Veljko", LastName: "Ilic", Telephone: "+38163577442"},
+			{ID: 1, FirstName: "Veljko", LastName: "Ilic", Telephone: "+38163999999", Version: 2},
+			{ID: 4, FirstName: "Ilija", LastName: "Ilinovic", Telephone: "+38164598332", Version: 1},
+		}
+		want := []error{nil, nil, ErrDuplicateContact, ErrEditConflict, ErrRecordNotFound}
+
+		errs, err := cm.saveContacts(contacts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(errs, want) {
+			t.Errorf("want %v; got %v", want, errs)
+		}
+
+		if contacts[0].ID != 3 || contacts[0].Version != 1 {
+			t.Errorf("want id 3 at version 1; got id %d at version %d", contacts[0].ID, contacts[0].Version)
+		}
+		if contacts[1].Version != 2 {
+			t.Errorf("want version 2; got %d", contacts[1].Version)
+		}
+
+		got, err := cm.ListContacts()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 3 || got[1].Telephone != "+38164111222" || got[0].Telephone != "+38163577442" {
+			t.Errorf("want the new and the updated contact stored; got %+v", got)
+		}
+	})
+}
+
+// Test deleting contacts at a specific version
+func TestDeletingContactVersions(t *testing.T) {
+	data := []Contact{
+		{ID: 1, FirstName: "Veljko", LastName: "Ilic", Telephone: "+38163577442", Version: 3},
+	}
+	forEachStore(t, data, func(t *testing.T, cm ContactsModel) {
+		testCases := []struct {
+			version int32
+			err     error
+		}{
+			{2, ErrEditConflict},
+			{3, nil},
+			{3, ErrRecordNotFound},
+		}
+
+		for _, tc := range testCases {
+			err := cm.DeleteContactVersion(1, tc.version)
+			if err != tc.err {
+				t.Errorf("want %v; got %v", tc.err, err)
+			}
+		}
+	})
+}
+
+// Testing that the store returns the contact it deleted, as it was stored
+func TestDeleteReturnsContact(t *testing.T) {
+	data := []Contact{
+		{ID: 1, FirstName: "Veljko", LastName: "Ilic", Telephone: "+38163577442", Version: 3},
+	}
+	forEachStore(t, data, func(t *testing.T, cm ContactsModel) {
+		stored, err := cm.Store.Get(DefaultTenant, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		deleted, err := cm.Store.Delete(DefaultTenant, 1, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(deleted, stored) {
+			t.Errorf("want %+v; got %+v", stored, deleted)
+		}
+
+		if deleted, err := cm.Store.Delete(DefaultTenant, 1, AnyVersion); deleted != nil || err != ErrRecordNotFound {
+			t.Errorf("want %v; got %+v, %v", ErrRecordNotFound, deleted, err)
+		}
+	})
+}
+
+// Test filtering, sorting and paginating contacts
+func TestFilterContacts(t *testing.T) {
+	data := []Contact{
+		{ID: 1, FirstName: "Veljko", LastName: "Ilic", Telephone: "+38163577442"},
+		{ID: 2, FirstName: "Marko", LastName: "Markovic", Telephone: "+38163587442"},
+		{ID: 3, FirstName: "Ilija", LastName: "Ilinovic", Telephone: "+38164598332"},
+		{ID: 4, FirstName: "Jovan", LastName: "Ilic", Telephone: "+38165111222"},
+	}
+	safelist := []string{"id", "first_name", "last_name", "telephone", "-id", "-first_name", "-last_name", "-telephone"}
+
+	forEachStore(t, data, func(t *testing.T, cm ContactsModel) {
+		testCases := []struct {
+			match        ContactFilter
+			filters      Filters
+			expectedIDs  []int64
+			expectedMeta Metadata
+		}{
+			{ContactFilter{}, Filters{Page: 1, PageSize: 20, Sort: "id"},
+				[]int64{1, 2, 3, 4}, Metadata{CurrentPage: 1, PageSize: 20, FirstPage: 1, LastPage: 1, TotalRecords: 4}},
+			{ContactFilter{LastName: "ILI"}, Filters{Page: 1, PageSize: 20, Sort: "-first_name"},
+				[]int64{1, 4, 3}, Metadata{CurrentPage: 1, PageSize: 20, FirstPage: 1, LastPage: 1, TotalRecords: 3}},
+			{ContactFilter{LastName: "ilic"}, Filters{Page: 1, PageSize: 20, Sort: "last_name"},
+				[]int64{1, 4}, Metadata{CurrentPage: 1, PageSize: 20, FirstPage: 1, LastPage: 1, TotalRecords: 2}},
+			{ContactFilter{Telephone: "63"}, Filters{Page: 2, PageSize: 1, Sort: "telephone"},
+				[]int64{2}, Metadata{CurrentPage: 2, PageSize: 1, FirstPage: 1, LastPage: 2, TotalRecords: 2}},
+			{ContactFilter{}, Filters{Page: 3, PageSize: 3, Sort: "-id"},
+				[]int64{}, Metadata{CurrentPage: 3, PageSize: 3, FirstPage: 1, LastPage: 2, TotalRecords: 4}},
+			{ContactFilter{FirstName: "Petar"}, Filters{Page: 1, PageSize: 20, Sort: "id"},
+				[]int64{}, Metadata{}},
+			{ContactFilter{Carrier: "MTS"}, Filters{Page: 1, PageSize: 20, Sort: "id"},
+				[]int64{3, 4}, Metadata{CurrentPage: 1, PageSize: 20, FirstPage: 1, LastPage: 1, TotalRecords: 2}},
+			{ContactFilter{Carrier: "mt"}, Filters{Page: 1, PageSize: 20, Sort: "id"},
+				[]int64{}, Metadata{}},
+		}
+
+		for _, tc := range testCases {
+			tc.filters.SortSafelist = safelist
+
+			contacts, metadata, err := cm.FilterContacts(tc.match, tc.filters)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ids := []int64{}
+			for _, contact := range contacts {
+				ids = append(ids, contact.ID)
+			}
+
+			if !slices.Equal(ids, tc.expectedIDs) {
+				t.Errorf("want ids %v; got %v", tc.expectedIDs, ids)
+			}
+			if metadata != tc.expectedMeta {
+				t.Errorf("want %+v; got %+v", tc.expectedMeta, metadata)
+			}
+		}
+	})
+}
+
+// Testing validation of the contact details
+func TestValidateContactDetails(t *testing.T) {
+	birthday, _ := ParseDate("1990-05-17")
+	future := Date{time.Now().AddDate(1, 0, 0)}
+	ancient, _ := ParseDate("1850-01-01")
+
+	valid := func() *Contact {
+		return &Contact{
+			FirstName:  "Veljko",
+			LastName:   "Ilic",
+			Telephone:  "+38163577442",
+			Telephones: []Phone{{Label: "work", Number: "+38164111222"}},
+			Emails:     []Email{{Label: "work", Address: "veljko@example.com"}},
+			Addresses:  []Address{{Label: "home", Street: "Knez Mihailova 1", City: "Beograd", PostalCode: "11000", Country: "Srbija"}},
+			Company:    "Salestrekker",
+			JobTitle:   "Developer",
+			Birthday:   &birthday,
+			Notes:      "Prefers email",
+		}
+	}
 
 	testCases := []struct {
-		id  int64
-		err error
+		change      func(c *Contact)
+		expectedKey string
 	}{
-		{2, nil},
-		{4, ErrRecordNotFound},
-		{-1, ErrRecordNotFound},
+		{func(c *Contact) {}, ""},
+		{func(c *Contact) { c.Emails[0].Address = "veljko.example.com" }, "emails[0].address"},
+		{func(c *Contact) { c.Emails = append(c.Emails, Email{}) }, "emails[1].address"},
+		{func(c *Contact) { c.Telephones[0].Number = "011 123 456" }, ""},
+		{func(c *Contact) { c.Telephones[0].Number = "+49 30 1234567" }, ""},
+		{func(c *Contact) { c.Telephones[0].Number = "011123" }, "telephones[0].number"},
+		{func(c *Contact) { c.Telephone = "+3816" }, "telephone"},
+		{func(c *Contact) { c.Addresses[0] = Address{Label: "home", Country: "Srbija"} }, "addresses[0]"},
+		{func(c *Contact) { c.Birthday = &future }, "birthday"},
+		{func(c *Contact) { c.Birthday = &ancient }, "birthday"},
+		{func(c *Contact) { c.Notes = strings.Repeat("a", 5001) }, "notes"},
+		{func(c *Contact) { c.FirstName = strings.Repeat("Ђ", 101) }, "first_name"},
+		{func(c *Contact) { c.Emails = make([]Email, 11) }, "emails"},
 	}
 
 	for _, tc := range testCases {
-		err := cm.DeleteContact(tc.id)
-		if err != tc.err {
-			fmt.Errorf("want %v; got %v", tc.err, err)
+		contact := valid()
+		tc.change(contact)
+
+		v := validator.New()
+		ValidateContact(v, contact, nil)
+
+		if tc.expectedKey == "" && !v.IsValid() {
+			t.Errorf("want valid; got %v", v.Errors)
+		}
+		if _, ok := v.Errors[tc.expectedKey]; tc.expectedKey != "" && !ok {
+			t.Errorf("want error for %s; got %v", tc.expectedKey, v.Errors)
 		}
 	}
 }
+
+// Testing that every store keeps all the contact details
+func TestContactDetailsRoundTrip(t *testing.T) {
+	birthday, _ := ParseDate("1990-05-17")
+
+	forEachStore(t, nil, func(t *testing.T, cm ContactsModel) {
+		contact := &Contact{
+			FirstName:  "Veljko",
+			LastName:   "Ilic",
+			Telephone:  "+38163577442",
+			Telephones: []Phone{{Label: "work", Number: "+38164111222"}},
+			Emails:     []Email{{Label: "work", Address: "veljko@example.com"}, {Address: "vi@example.org"}},
+			Addresses:  []Address{{Label: "home", Street: "Knez Mihailova 1", City: "Beograd"}},
+			Company:    "Salestrekker",
+			JobTitle:   "Developer",
+			Birthday:   &birthday,
+			Notes:      "Prefers email",
+			Tags:       []string{"vip", "supplier"},
+		}
+
+		if err := cm.InsertContact(contact); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := cm.GetContact(contact.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, contact) {
+			t.Errorf("want %+v; got %+v", contact, got)
+		}
+
+		// clearing the details has to clear them in the store as well
+		contact.Emails = nil
+		contact.Birthday = nil
+		if err := cm.UpdateContact(contact); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err = cm.GetContact(contact.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, contact) {
+			t.Errorf("want %+v; got %+v", contact, got)
+		}
+	})
+}
@@ -0,0 +1,344 @@
+package data
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"salestrekker_technical_interview.veljkoilic/internal/validator"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidCSV = errors.New("invalid CSV")
+)
+
+// Contact fields which have a CSV column, in the order they are exported. Addresses have no column,
+// they are kept as they are when a contact is overwritten by an import. Every custom field of the
+// schema has a column as well, named custom.<field name>.
+var csvColumns = []string{"first_name", "last_name", "telephone", "telephones", "emails", "company", "job_title", "birthday", "notes", "tags"}
+
+// The id is exported so the rows can be matched with the API, but the contacts get new ids on import
+const csvIDColumn = "id"
+
+// Entries of the telephones, emails and tags columns are separated by this character,
+// and a label is written before the telephone number or email address like "work:+38163577442"
+const (
+	csvListSeparator  = ";"
+	csvLabelSeparator = ":"
+)
+
+// Spreadsheet programs read a cell starting with one of these characters as a formula. Such cells
+// are exported with csvFormulaEscape before them and the escape is removed again on import.
+const (
+	csvFormulaStart  = "=+-@\t\r"
+	csvFormulaEscape = "'"
+)
+
+// Report whether the column can be imported, given the custom field schema
+func isCSVColumn(column string, fields []Field) bool {
+	if name, ok := strings.CutPrefix(column, "custom."); ok {
+		return slices.ContainsFunc(fields, func(f Field) bool { return f.Name == name })
+	}
+	return slices.Contains(csvColumns, column)
+}
+
+// Validate the column mapping of an import. The keys are the headers of the CSV file,
+// the values are the columns they hold.
+func ValidateCSVMapping(v *validator.Validator, mapping map[string]string, fields []Field) {
+	for header, column := range mapping {
+		key := fmt.Sprintf("map[%s]", header)
+		v.Check(isCSVColumn(column, fields), key, "must be a contact field or custom.<field name> of a custom field")
+	}
+}
+
+// Write the contacts passing the filter as CSV, with a header row of the column names
+func (cm *ContactsModel) ExportCSV(w io.Writer, match ContactFilter, fields []Field) error {
+	cw := csv.NewWriter(w)
+
+	header := append([]string{csvIDColumn}, csvColumns...)
+	for _, field := range fields {
+		header = append(header, "custom."+field.Name)
+	}
+
+	err := cw.Write(header)
+	if err != nil {
+		return err
+	}
+
+	err = cm.EachContact(match, func(contact *Contact) error {
+		record := []string{strconv.FormatInt(contact.ID, 10)}
+		for _, column := range csvColumns {
+			record = append(record, escapeCSVFormula(formatCSVColumn(contact, column)))
+		}
+		for _, field := range fields {
+			record = append(record, escapeCSVFormula(formatCustomValue(contact.Custom[field.Name])))
+		}
+		return cw.Write(record)
+	})
+	if err != nil {
+		return err
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// Format the value of a contact field as a CSV cell
+func formatCSVColumn(contact *Contact, column string) string {
+	switch column {
+	case "first_name":
+		return contact.FirstName
+	case "last_name":
+		return contact.LastName
+	case "telephone":
+		return contact.Telephone
+	case "telephones":
+		entries := make([]string, len(contact.Telephones))
+		for i, phone := range contact.Telephones {
+			entries[i] = formatLabelled(phone.Label, phone.Number)
+		}
+		return strings.Join(entries, csvListSeparator)
+	case "emails":
+		entries := make([]string, len(contact.Emails))
+		for i, email := range contact.Emails {
+			entries[i] = formatLabelled(email.Label, email.Address)
+		}
+		return strings.Join(entries, csvListSeparator)
+	case "company":
+		return contact.Company
+	case "job_title":
+		return contact.JobTitle
+	case "birthday":
+		if contact.Birthday == nil {
+			return ""
+		}
+		return contact.Birthday.String()
+	case "notes":
+		return contact.Notes
+	case "tags":
+		return strings.Join(contact.Tags, csvListSeparator)
+	}
+	return ""
+}
+
+// Prefix a cell which a spreadsheet program would read as a formula with csvFormulaEscape
+func escapeCSVFormula(value string) string {
+	if value != "" && strings.ContainsRune(csvFormulaStart, rune(value[0])) {
+		return csvFormulaEscape + value
+	}
+	return value
+}
+
+// Remove the csvFormulaEscape which escapeCSVFormula put before a cell
+func unescapeCSVFormula(value string) string {
+	if rest, ok := strings.CutPrefix(value, csvFormulaEscape); ok && rest != "" && strings.ContainsRune(csvFormulaStart, rune(rest[0])) {
+		return rest
+	}
+	return value
+}
+
+func formatLabelled(label, value string) string {
+	if label == "" {
+		return value
+	}
+	return label + csvLabelSeparator + value
+}
+
+// Format a custom value the way parseCustomValue reads it back
+func formatCustomValue(value any) string {
+	switch value := value.(type) {
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(value)
+	}
+	return ""
+}
+
+// Import the contacts in the CSV read from r. The first row is the header, every header is
+// either a key of mapping or the name of the column it holds. Each row is validated with
+// ValidateContact on its own, so a bad row is reported in the summary and the rest are still imported.
+// A row which is the same contact as a stored one, or one imported before it, is handled as
+// duplicates says. Overwriting changes only the fields which have a column in the file.
+// ErrInvalidCSV is returned when the header can not be used.
+func (cm *ContactsModel) ImportCSV(r io.Reader, mapping map[string]string, duplicates string, fields []Field) (*ImportSummary, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%w: the header row is missing", ErrInvalidCSV)
+		}
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCSV, err)
+	}
+
+	summary := &ImportSummary{Rows: []ImportRow{}}
+
+	// columns[i] is the contact field held in the i-th column, or "" when the column is ignored
+	columns := make([]string, len(header))
+	for i, name := range header {
+		// spreadsheet programs often start the file with a byte order mark
+		if i == 0 {
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+		name = strings.TrimSpace(name)
+
+		column, ok := mapping[name]
+		if !ok {
+			column = strings.ReplaceAll(strings.ToLower(name), " ", "_")
+		}
+
+		// the exported ids are not imported, as the contacts get new ones
+		if column == csvIDColumn {
+			continue
+		}
+		if !isCSVColumn(column, fields) {
+			summary.IgnoredColumns = append(summary.IgnoredColumns, name)
+			continue
+		}
+		if slices.Contains(columns, column) {
+			return nil, fmt.Errorf("%w: more than one column holds %s", ErrInvalidCSV, column)
+		}
+		columns[i] = column
+	}
+
+	imp, err := cm.newImporter(summary, duplicates, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			imp.add(ImportRow{Line: parseErr.StartLine, Status: ImportFailed, Errors: map[string]string{"row": parseErr.Err.Error()}})
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		line, _ := cr.FieldPos(0)
+
+		apply := func(v *validator.Validator, contact *Contact) {
+			for i, column := range columns {
+				if column != "" {
+					setCSVColumn(v, contact, column, record[i], fields)
+				}
+			}
+		}
+
+		imp.importContact(line, apply)
+	}
+
+	return imp.save()
+}
+
+// Set the contact field held in the column to the value of the cell. Cells which can not be
+// read as the field's type are reported to v.
+func setCSVColumn(v *validator.Validator, contact *Contact, column, value string, fields []Field) {
+	value = strings.TrimSpace(unescapeCSVFormula(value))
+
+	switch column {
+	case "first_name":
+		contact.FirstName = value
+	case "last_name":
+		contact.LastName = value
+	case "telephone":
+		contact.Telephone = value
+	case "telephones":
+		contact.Telephones = nil
+		for _, entry := range splitCSVList(value) {
+			label, number := cutLabel(entry)
+			contact.Telephones = append(contact.Telephones, Phone{Label: label, Number: number})
+		}
+	case "emails":
+		contact.Emails = nil
+		for _, entry := range splitCSVList(value) {
+			label, address := cutLabel(entry)
+			contact.Emails = append(contact.Emails, Email{Label: label, Address: address})
+		}
+	case "company":
+		contact.Company = value
+	case "job_title":
+		contact.JobTitle = value
+	case "birthday":
+		contact.Birthday = nil
+		if value != "" {
+			birthday, err := ParseDate(value)
+			if err != nil {
+				v.AddError(column, "must be a date in the YYYY-MM-DD format")
+				return
+			}
+			contact.Birthday = &birthday
+		}
+	case "notes":
+		contact.Notes = value
+	case "tags":
+		contact.Tags = splitCSVList(value)
+	default:
+		name := strings.TrimPrefix(column, "custom.")
+		i := slices.IndexFunc(fields, func(f Field) bool { return f.Name == name })
+		if i == -1 {
+			return
+		}
+
+		if value == "" {
+			delete(contact.Custom, name)
+			return
+		}
+
+		parsed, ok := parseCustomValue(&fields[i], value)
+		if !ok {
+			v.AddError(column, fmt.Sprintf("must be a valid %s", fields[i].Type))
+			return
+		}
+		if contact.Custom == nil {
+			contact.Custom = make(map[string]any)
+		}
+		contact.Custom[name] = parsed
+	}
+}
+
+// Read the cell as a value of the field's type. Dates and enum values are kept as strings
+// and checked by ValidateContact like values sent as JSON.
+func parseCustomValue(field *Field, value string) (any, bool) {
+	switch field.Type {
+	case FieldNumber:
+		number, err := strconv.ParseFloat(value, 64)
+		return number, err == nil
+	case FieldBool:
+		b, err := strconv.ParseBool(value)
+		return b, err == nil
+	}
+	return value, true
+}
+
+// Split a list cell into its trimmed, non-empty entries
+func splitCSVList(value string) []string {
+	var entries []string
+	for _, entry := range strings.Split(value, csvListSeparator) {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// Split a list entry into its label and value. Entries without a label are all value.
+func cutLabel(entry string) (string, string) {
+	label, value, ok := strings.Cut(entry, csvLabelSeparator)
+	if !ok {
+		return "", entry
+	}
+	return strings.TrimSpace(label), strings.TrimSpace(value)
+}
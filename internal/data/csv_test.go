@@ -0,0 +1,173 @@
+package data
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Testing that exported contacts are imported back the same
+func TestCSVRoundTrip(t *testing.T) {
+	birthday, err := ParseDate("1990-05-17")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := []Field{
+		{Name: "employees", Type: FieldNumber, Version: 1},
+		{Name: "active", Type: FieldBool, Version: 1},
+	}
+	contact := Contact{
+		FirstName:  "Veljko",
+		LastName:   "Ilic",
+		Telephone:  "+38163577442",
+		Telephones: []Phone{{Label: "work", Number: "+381112345678"}, {Number: "+38164111222"}},
+		Emails:     []Email{{Label: "home", Address: "veljko@example.com"}},
+		Company:    "Salestrekker, d.o.o.",
+		JobTitle:   "=HYPERLINK(\"http://example.com\")",
+		Birthday:   &birthday,
+		Notes:      "Met at the \"conference\"\nin Belgrade",
+		Tags:       []string{"vip", "supplier"},
+		Custom:     map[string]any{"employees": 12.5, "active": true},
+	}
+
+	source := NewModel(NewMemoryStore(nil))
+	if err := source.InsertContact(&contact); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := source.ExportCSV(&buf, ContactFilter{}, fields); err != nil {
+		t.Fatal(err)
+	}
+
+	target := NewModel(NewMemoryStore(nil))
+	summary, err := target.ImportCSV(&buf, nil, ImportSkip, fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Created != 1 || summary.IgnoredColumns != nil {
+		t.Fatalf("want 1 created row and no ignored columns; got %+v", summary)
+	}
+
+	got, err := target.GetContact(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(*got, contact) {
+		t.Errorf("want %+v; got %+v", contact, *got)
+	}
+}
+
+// Testing that cells a spreadsheet program would read as a formula are escaped
+func TestEscapeCSVFormula(t *testing.T) {
+	testCases := []struct {
+		value string
+		want  string
+	}{
+		{"", ""},
+		{"Veljko", "Veljko"},
+		{"=1+2", "'=1+2"},
+		{"+38163577442", "'+38163577442"},
+		{"-5", "'-5"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\tcmd", "'\tcmd"},
+		{"\rcmd", "'\rcmd"},
+		{"'quoted", "'quoted"},
+		{"a=b", "a=b"},
+	}
+
+	for _, tc := range testCases {
+		got := escapeCSVFormula(tc.value)
+		if got != tc.want {
+			t.Errorf("%q: want %q; got %q", tc.value, tc.want, got)
+		}
+		if back := unescapeCSVFormula(got); back != tc.value {
+			t.Errorf("%q: want %q back; got %q", tc.value, tc.value, back)
+		}
+	}
+}
+
+// Testing the outcome reported for every row of an import
+func TestImportCSV(t *testing.T) {
+	data := []Contact{
+		{ID: 1, FirstName: "Veljko", LastName: "Ilic", Telephone: "+38163577442", Version: 1},
+	}
+
+	input := "\ufeffGiven Name,Last_Name,Mobile,Company,Extra\n" +
+		"Veljko,Ilic,063577442,New,x\n" +
+		"Marko,Markovic,+38163587442,,x\n" +
+		"Marko,Markovic,+38163587442,Again,x\n" +
+		"Ana,,+38163111222,,x\n" +
+		"\"Multi\nline\",Anic,+38163333444,,x\n" +
+		"Short,row\n"
+
+	testCases := []struct {
+		duplicates string
+		want       []ImportRow
+		wantFirst  string
+	}{
+		{ImportSkip, []ImportRow{
+			{Line: 2, Status: ImportSkipped, ID: 1},
+			{Line: 3, Status: ImportCreated, ID: 2},
+			{Line: 4, Status: ImportSkipped, ID: 2},
+			{Line: 5, Status: ImportFailed, Errors: map[string]string{"last_name": "must be provided"}},
+			{Line: 6, Status: ImportCreated, ID: 3},
+			{Line: 8, Status: ImportFailed, Errors: map[string]string{"row": "wrong number of fields"}},
+		}, ""},
+		{ImportOverwrite, []ImportRow{
+			{Line: 2, Status: ImportUpdated, ID: 1},
+			{Line: 3, Status: ImportCreated, ID: 2},
+			{Line: 4, Status: ImportUpdated, ID: 2},
+			{Line: 5, Status: ImportFailed, Errors: map[string]string{"last_name": "must be provided"}},
+			{Line: 6, Status: ImportCreated, ID: 3},
+			{Line: 8, Status: ImportFailed, Errors: map[string]string{"row": "wrong number of fields"}},
+		}, "New"},
+		{ImportFail, []ImportRow{
+			{Line: 2, Status: ImportFailed, ID: 1, Errors: map[string]string{"row": "same contact already exists with id 1"}},
+			{Line: 3, Status: ImportCreated, ID: 2},
+			{Line: 4, Status: ImportFailed, ID: 2, Errors: map[string]string{"row": "same contact already exists with id 2"}},
+			{Line: 5, Status: ImportFailed, Errors: map[string]string{"last_name": "must be provided"}},
+			{Line: 6, Status: ImportCreated, ID: 3},
+			{Line: 8, Status: ImportFailed, Errors: map[string]string{"row": "wrong number of fields"}},
+		}, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.duplicates, func(t *testing.T) {
+			forEachStore(t, data, func(t *testing.T, cm ContactsModel) {
+				mapping := map[string]string{"Given Name": "first_name", "Mobile": "telephone"}
+
+				summary, err := cm.ImportCSV(strings.NewReader(input), mapping, tc.duplicates, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if !reflect.DeepEqual(summary.Rows, tc.want) {
+					t.Errorf("want %+v; got %+v", tc.want, summary.Rows)
+				}
+				if !reflect.DeepEqual(summary.IgnoredColumns, []string{"Extra"}) {
+					t.Errorf("want [Extra]; got %v", summary.IgnoredColumns)
+				}
+
+				got, err := cm.GetContact(1)
+				if err != nil || got.Company != tc.wantFirst {
+					t.Errorf("want company %q; got %+v, %v", tc.wantFirst, got, err)
+				}
+			})
+		})
+	}
+}
+
+// Testing that a header which can not be used fails the whole import
+func TestImportCSVInvalidHeader(t *testing.T) {
+	cm := NewModel(NewMemoryStore(nil))
+
+	for _, input := range []string{"", "telephone,Phone\n", "first_name,\"last\n"} {
+		mapping := map[string]string{"Phone": "telephone"}
+		if _, err := cm.ImportCSV(strings.NewReader(input), mapping, ImportSkip, nil); !errors.Is(err, ErrInvalidCSV) {
+			t.Errorf("want %v for %q; got %v", ErrInvalidCSV, input, err)
+		}
+	}
+}
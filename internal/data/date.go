@@ -0,0 +1,44 @@
+package data
+
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+// Layout dates are written in, in JSON and in the database
+const dateLayout = "2006-01-02"
+
+var ErrInvalidDateFormat = errors.New("invalid date format, dates must look like 2006-01-02")
+
+// Date is a calendar date without a time of day, encoded as "YYYY-MM-DD" in JSON
+type Date struct {
+	time.Time
+}
+
+// Parse a date in the YYYY-MM-DD format
+func ParseDate(s string) (Date, error) {
+	t, err := time.Parse(dateLayout, s)
+	if err != nil {
+		return Date{}, ErrInvalidDateFormat
+	}
+	return Date{t}, nil
+}
+
+func (d Date) String() string {
+	return d.Format(dateLayout)
+}
+
+func (d Date) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(d.String())), nil
+}
+
+func (d *Date) UnmarshalJSON(jsonValue []byte) error {
+	unquoted, err := strconv.Unquote(string(jsonValue))
+	if err != nil {
+		return ErrInvalidDateFormat
+	}
+
+	*d, err = ParseDate(unquoted)
+	return err
+}
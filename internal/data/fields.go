@@ -0,0 +1,226 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"salestrekker_technical_interview.veljkoilic/internal/validator"
+	"slices"
+	"sort"
+)
+
+var (
+	ErrDuplicateField = errors.New("field with the same name already exists")
+)
+
+// FieldInUseError is returned when a new or changed field would make the values of stored contacts invalid.
+// Contacts left with values the schema does not allow would fail every later update, so they have to be changed first.
+type FieldInUseError struct {
+	// number of the contacts whose value would become invalid
+	Contacts int
+}
+
+func (e *FieldInUseError) Error() string {
+	return fmt.Sprintf("the change would make the value of %d contacts invalid", e.Contacts)
+}
+
+// Types a custom field can have
+const (
+	FieldString = "string"
+	FieldNumber = "number"
+	FieldDate   = "date"
+	FieldEnum   = "enum"
+	FieldBool   = "bool"
+)
+
+var fieldTypes = []string{FieldString, FieldNumber, FieldDate, FieldEnum, FieldBool}
+
+// Limits on the custom field schema and values
+const (
+	maxFields          = 50
+	maxEnumValues      = 100
+	maxCustomChars     = 500
+	maxFieldNameLength = 50
+)
+
+// Field names are used as keys of the custom map and in the CSV headers, so they are kept simple
+var fieldNameRX = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// Field is a custom field in the schema every contact's custom values are checked against.
+// Name is the key of the value in Contact.Custom, EnumValues lists the values allowed in an enum field.
+// Version starts at 1 and is incremented every time the field changes.
+type Field struct {
+	Name       string   `json:"name"`
+	Type       string   `json:"type"`
+	Required   bool     `json:"required"`
+	EnumValues []string `json:"enum_values,omitempty"`
+	Version    int32    `json:"version"`
+}
+
+// Return a deep copy of the field
+func (f *Field) clone() Field {
+	clone := *f
+	clone.EnumValues = slices.Clone(f.EnumValues)
+	return clone
+}
+
+// FieldStore is implemented by every storage backend next to ContactStore. The schema is kept with
+// the contacts, so deleting a field removes its values from every contact in the same operation.
+type FieldStore interface {
+	// GetField returns a copy of the field with the given name, or ErrRecordNotFound
+	GetField(name string) (*Field, error)
+	// ListFields returns copies of all fields, in the order they were created
+	ListFields() ([]Field, error)
+	// InsertField stores a new field, or returns ErrDuplicateField if its name is taken. A *FieldInUseError
+	// is returned when the field is required and stored contacts, of any tenant, have no value for it.
+	InsertField(field *Field) error
+	// UpdateField replaces the stored field which has the same name and version as the one passed in,
+	// and increments the field's version. ErrEditConflict is returned when the versions differ, and
+	// a *FieldInUseError when the change would make the value of stored contacts invalid, see invalidates.
+	// The contacts are checked within the same change, so none can be written in between.
+	UpdateField(field *Field) error
+	// DeleteField removes the field with the given name, together with its values in every contact.
+	// Contacts which had a value are moved to their next version.
+	DeleteField(name string) error
+}
+
+// FieldsModel is what the handlers use to manage the custom field schema
+type FieldsModel struct {
+	Store FieldStore
+}
+
+func NewFieldsModel(store FieldStore) FieldsModel {
+	return FieldsModel{Store: store}
+}
+
+// Validate the definition of a custom field. existing holds the number of fields already in the schema,
+// or -1 when an existing field is being changed.
+func ValidateField(v *validator.Validator, field *Field, existing int) {
+	v.Check(field.Name != "", "name", "must be provided")
+	v.Check(len(field.Name) <= maxFieldNameLength, "name", fmt.Sprintf("must not be more than %d characters long", maxFieldNameLength))
+	v.Check(fieldNameRX.MatchString(field.Name), "name", "must start with a lowercase letter and contain only lowercase letters, digits and underscores")
+	v.Check(validator.PermittedValue(field.Type, fieldTypes...), "type", "must be one of string, number, date, enum or bool")
+	v.Check(existing < maxFields, "name", fmt.Sprintf("can not be added, the schema already has %d fields", maxFields))
+
+	if field.Type == FieldEnum {
+		v.Check(len(field.EnumValues) > 0, "enum_values", "must contain at least one value")
+		v.Check(len(field.EnumValues) <= maxEnumValues, "enum_values", fmt.Sprintf("must not contain more than %d values", maxEnumValues))
+		v.Check(validator.Unique(field.EnumValues), "enum_values", "must not contain duplicate values")
+		for i, value := range field.EnumValues {
+			key := fmt.Sprintf("enum_values[%d]", i)
+			v.Check(value != "", key, "must not be empty")
+			v.Check(validator.MaxChars(value, maxCustomChars), key, fmt.Sprintf("must not be more than %d characters long", maxCustomChars))
+		}
+	} else {
+		v.Check(len(field.EnumValues) == 0, "enum_values", "can only be set on enum fields")
+	}
+}
+
+// Check the custom values of a contact against the schema. Every value has to belong to a field
+// of the schema and have its type, and every required field has to have a value.
+func validateCustomValues(v *validator.Validator, custom map[string]any, fields []Field) {
+	schema := make(map[string]*Field, len(fields))
+	for i := range fields {
+		schema[fields[i].Name] = &fields[i]
+	}
+
+	// go through the names in order, so the same values always yield the same errors
+	names := slices.Collect(maps.Keys(custom))
+	sort.Strings(names)
+
+	for _, name := range names {
+		key := "custom." + name
+		value := custom[name]
+
+		field, ok := schema[name]
+		if !ok {
+			v.AddError(key, "is not a known custom field")
+			continue
+		}
+
+		switch field.Type {
+		case FieldString:
+			s, ok := value.(string)
+			v.Check(ok, key, "must be a string")
+			v.Check(validator.MaxChars(s, maxCustomChars), key, fmt.Sprintf("must not be more than %d characters long", maxCustomChars))
+			v.Check(!field.Required || s != "", key, "must be provided")
+		case FieldNumber:
+			_, ok := value.(float64)
+			v.Check(ok, key, "must be a number")
+		case FieldDate:
+			s, ok := value.(string)
+			_, err := ParseDate(s)
+			v.Check(ok && err == nil, key, "must be a date in the YYYY-MM-DD format")
+		case FieldEnum:
+			s, ok := value.(string)
+			v.Check(ok && validator.PermittedValue(s, field.EnumValues...), key, "must be one of the field's enum values")
+		case FieldBool:
+			_, ok := value.(bool)
+			v.Check(ok, key, "must be true or false")
+		}
+	}
+
+	for _, field := range fields {
+		if field.Required {
+			_, ok := custom[field.Name]
+			v.Check(ok, "custom."+field.Name, "must be provided")
+		}
+	}
+}
+
+// Return copies of the fields which do not require a value. vCard has no properties for custom values,
+// so cards written over CardDAV or imported from a vCard file can not provide them: the values such
+// contacts already have are still checked against the schema, but a missing one is not refused.
+func OptionalFields(fields []Field) []Field {
+	optional := make([]Field, len(fields))
+	for i := range fields {
+		optional[i] = fields[i].clone()
+		optional[i].Required = false
+	}
+	return optional
+}
+
+// Report whether the change of the field from previous to field makes the contact's value invalid: the contact
+// has no value when the field becomes required, or a value which is not one of the enum values any more.
+// previous is nil for a new field. Contacts whose value was not valid before are not counted as invalidated.
+func invalidates(contact *Contact, previous, field *Field) bool {
+	return (previous == nil || validCustomValue(contact, previous)) && !validCustomValue(contact, field)
+}
+
+// Report whether the contact's value of the field, or its lack of one, is allowed by the field
+func validCustomValue(contact *Contact, field *Field) bool {
+	custom := map[string]any{}
+	if value, ok := contact.Custom[field.Name]; ok {
+		custom[field.Name] = value
+	}
+
+	v := validator.New()
+	validateCustomValues(v, custom, []Field{*field})
+	return v.IsValid()
+}
+
+// get a specific field of the schema
+func (fm *FieldsModel) GetField(name string) (*Field, error) {
+	return fm.Store.GetField(name)
+}
+
+// get the whole schema, in the order the fields were created
+func (fm *FieldsModel) ListFields() ([]Field, error) {
+	return fm.Store.ListFields()
+}
+
+// Add a field to the schema
+func (fm *FieldsModel) InsertField(field *Field) error {
+	return fm.Store.InsertField(field)
+}
+
+// Change whether the field is required and which values an enum field allows
+func (fm *FieldsModel) UpdateField(field *Field) error {
+	return fm.Store.UpdateField(field)
+}
+
+// Remove a field from the schema, together with its values in every contact
+func (fm *FieldsModel) DeleteField(name string) error {
+	return fm.Store.DeleteField(name)
+}
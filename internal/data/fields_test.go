@@ -0,0 +1,269 @@
+package data
+
+import (
+	"errors"
+	"reflect"
+	"salestrekker_technical_interview.veljkoilic/internal/validator"
+	"testing"
+)
+
+// Testing the validation of field definitions
+func TestValidateField(t *testing.T) {
+	testCases := []struct {
+		name     string
+		field    Field
+		existing int
+		wantKey  string
+	}{
+		{"valid string", Field{Name: "industry", Type: FieldString}, 0, ""},
+		{"valid enum", Field{Name: "tier", Type: FieldEnum, EnumValues: []string{"gold", "silver"}}, 0, ""},
+		{"changing full schema", Field{Name: "tier", Type: FieldBool}, -1, ""},
+		{"missing name", Field{Type: FieldString}, 0, "name"},
+		{"bad name", Field{Name: "Lead Source", Type: FieldString}, 0, "name"},
+		{"full schema", Field{Name: "industry", Type: FieldString}, maxFields, "name"},
+		{"unknown type", Field{Name: "industry", Type: "text"}, 0, "type"},
+		{"enum without values", Field{Name: "tier", Type: FieldEnum}, 0, "enum_values"},
+		{"duplicate enum values", Field{Name: "tier", Type: FieldEnum, EnumValues: []string{"gold", "gold"}}, 0, "enum_values"},
+		{"empty enum value", Field{Name: "tier", Type: FieldEnum, EnumValues: []string{"gold", ""}}, 0, "enum_values[1]"},
+		{"values on string", Field{Name: "industry", Type: FieldString, EnumValues: []string{"it"}}, 0, "enum_values"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateField(v, &tc.field, tc.existing)
+
+			if tc.wantKey == "" && !v.IsValid() {
+				t.Errorf("want no errors; got %v", v.Errors)
+			}
+			if _, ok := v.Errors[tc.wantKey]; tc.wantKey != "" && !ok {
+				t.Errorf("want error for %q; got %v", tc.wantKey, v.Errors)
+			}
+		})
+	}
+}
+
+// Testing custom values of a contact against a schema
+func TestValidateCustomValues(t *testing.T) {
+	fields := []Field{
+		{Name: "industry", Type: FieldString, Required: true},
+		{Name: "employees", Type: FieldNumber},
+		{Name: "signed", Type: FieldDate},
+		{Name: "tier", Type: FieldEnum, EnumValues: []string{"gold", "silver"}},
+		{Name: "active", Type: FieldBool},
+	}
+
+	testCases := []struct {
+		name    string
+		custom  map[string]any
+		wantKey string
+	}{
+		{"valid", map[string]any{"industry": "IT", "employees": 12.0, "signed": "2024-02-29", "tier": "gold", "active": true}, ""},
+		{"missing required", map[string]any{"employees": 12.0}, "custom.industry"},
+		{"empty required", map[string]any{"industry": ""}, "custom.industry"},
+		{"unknown field", map[string]any{"industry": "IT", "color": "red"}, "custom.color"},
+		{"string as number", map[string]any{"industry": "IT", "employees": "12"}, "custom.employees"},
+		{"bad date", map[string]any{"industry": "IT", "signed": "2023-02-29"}, "custom.signed"},
+		{"unknown enum value", map[string]any{"industry": "IT", "tier": "bronze"}, "custom.tier"},
+		{"string as bool", map[string]any{"industry": "IT", "active": "yes"}, "custom.active"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			v := validator.New()
+			validateCustomValues(v, tc.custom, fields)
+
+			if tc.wantKey == "" && !v.IsValid() {
+				t.Errorf("want no errors; got %v", v.Errors)
+			}
+			if _, ok := v.Errors[tc.wantKey]; tc.wantKey != "" && !ok {
+				t.Errorf("want error for %q; got %v", tc.wantKey, v.Errors)
+			}
+		})
+	}
+}
+
+// Testing the schema operations, and that deleting a field removes its values from the contacts
+func TestFields(t *testing.T) {
+	data := []Contact{
+		{ID: 1, FirstName: "Veljko", LastName: "Ilic", Telephone: "+38163577442", Version: 1},
+		{ID: 2, FirstName: "Marko", LastName: "Markovic", Telephone: "+38163587442", Version: 1},
+	}
+
+	forEachStore(t, data, func(t *testing.T, cm ContactsModel) {
+		fm := NewFieldsModel(cm.Store)
+
+		tier := &Field{Name: "tier", Type: FieldEnum, EnumValues: []string{"gold", "silver"}}
+		if err := fm.InsertField(tier); err != nil {
+			t.Fatal(err)
+		}
+		if err := fm.InsertField(&Field{Name: "industry", Type: FieldString}); err != nil {
+			t.Fatal(err)
+		}
+		if err := fm.InsertField(&Field{Name: "tier", Type: FieldBool}); err != ErrDuplicateField {
+			t.Errorf("want %v; got %v", ErrDuplicateField, err)
+		}
+
+		// the contacts have no tier, so it can not become required, see TestFieldInUse
+		tier.EnumValues = append(tier.EnumValues, "bronze")
+		if err := fm.UpdateField(tier); err != nil || tier.Version != 2 {
+			t.Errorf("want version 2; got %d, %v", tier.Version, err)
+		}
+
+		stale := *tier
+		stale.Version = 1
+		if err := fm.UpdateField(&stale); err != ErrEditConflict {
+			t.Errorf("want %v; got %v", ErrEditConflict, err)
+		}
+
+		want := Field{Name: "tier", Type: FieldEnum, EnumValues: []string{"gold", "silver", "bronze"}, Version: 2}
+		if got, err := fm.GetField("tier"); err != nil || !reflect.DeepEqual(*got, want) {
+			t.Errorf("want %+v; got %+v, %v", want, got, err)
+		}
+
+		contact, err := cm.GetContact(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		contact.Custom = map[string]any{"tier": "gold", "industry": "IT"}
+		if err := cm.UpdateContact(contact); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := fm.DeleteField("tier"); err != nil {
+			t.Fatal(err)
+		}
+		if err := fm.DeleteField("tier"); err != ErrRecordNotFound {
+			t.Errorf("want %v; got %v", ErrRecordNotFound, err)
+		}
+
+		got, err := cm.GetContact(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got.Custom, map[string]any{"industry": "IT"}) || got.Version != 3 {
+			t.Errorf("want only industry at version 3; got %v at version %d", got.Custom, got.Version)
+		}
+
+		// contacts without a value of the field are left at their version
+		if got, err := cm.GetContact(2); err != nil || got.Version != 1 {
+			t.Errorf("want version 1; got %+v, %v", got, err)
+		}
+
+		fields, err := fm.ListFields()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(fields) != 1 || fields[0].Name != "industry" {
+			t.Errorf("want only industry; got %+v", fields)
+		}
+	})
+}
+
+func TestInvalidates(t *testing.T) {
+	tier := Field{Name: "tier", Type: FieldEnum, EnumValues: []string{"gold", "silver"}}
+	gold := &Contact{Custom: map[string]any{"tier": "gold"}}
+	missing := &Contact{}
+
+	testCases := []struct {
+		name     string
+		contact  *Contact
+		previous *Field
+		change   func(f *Field)
+		expected bool
+	}{
+		{"unchanged", gold, &tier, func(f *Field) {}, false},
+		{"value added", gold, &tier, func(f *Field) { f.EnumValues = []string{"gold", "silver", "bronze"} }, false},
+		{"value removed", gold, &tier, func(f *Field) { f.EnumValues = []string{"silver"} }, true},
+		{"made required", missing, &tier, func(f *Field) { f.Required = true }, true},
+		{"new field", missing, nil, func(f *Field) {}, false},
+		{"new required field", missing, nil, func(f *Field) { f.Required = true }, true},
+		{"already missing", missing, &Field{Name: "tier", Type: FieldEnum, Required: true, EnumValues: []string{"gold", "silver"}},
+			func(f *Field) { f.Required = true; f.EnumValues = []string{"gold", "silver", "bronze"} }, false},
+	}
+
+	for _, tc := range testCases {
+		field := tier.clone()
+		tc.change(&field)
+
+		if got := invalidates(tc.contact, tc.previous, &field); got != tc.expected {
+			t.Errorf("%s: want %v; got %v", tc.name, tc.expected, got)
+		}
+	}
+}
+
+// Testing that the stores refuse new and changed fields which would make the values of stored contacts invalid
+func TestFieldInUse(t *testing.T) {
+	contacts := []Contact{
+		{ID: 1, FirstName: "Veljko", LastName: "Ilic", Telephone: "+38163577442"},
+		{ID: 2, FirstName: "Marko", LastName: "Markovic", Telephone: "+38163587442"},
+		{ID: 1, Tenant: "sales", FirstName: "Ana", LastName: "Anic", Telephone: "+38163597442"},
+	}
+
+	forEachStore(t, contacts, func(t *testing.T, cm ContactsModel) {
+		fm := NewFieldsModel(cm.Store)
+
+		// none of the contacts has a value for a new field
+		var inUse *FieldInUseError
+		err := fm.InsertField(&Field{Name: "region", Type: FieldString, Required: true})
+		if !errors.As(err, &inUse) || inUse.Contacts != 3 {
+			t.Errorf("want 3 contacts in use; got %v", err)
+		}
+		if fields, err := fm.ListFields(); err != nil || len(fields) != 0 {
+			t.Errorf("want no fields; got %v, %v", fields, err)
+		}
+
+		if err := fm.InsertField(&Field{Name: "tier", Type: FieldEnum, EnumValues: []string{"gold", "silver"}}); err != nil {
+			t.Fatal(err)
+		}
+
+		// the values are set through the model, as not every store is seeded with them
+		values := []struct {
+			cm   *ContactsModel
+			tier string
+		}{{&cm, "gold"}, {cm.ForTenant("sales"), "silver"}}
+		for _, value := range values {
+			contact, err := value.cm.GetContact(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			contact.Custom = map[string]any{"tier": value.tier}
+			if err := value.cm.UpdateContact(contact); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		testCases := []struct {
+			name     string
+			change   func(f *Field)
+			expected int
+		}{
+			{"value removed", func(f *Field) { f.EnumValues = []string{"silver"} }, 1},
+			{"made required", func(f *Field) { f.Required = true }, 1},
+			{"both", func(f *Field) { f.Required = true; f.EnumValues = []string{"gold"} }, 2},
+			{"value added", func(f *Field) { f.EnumValues = []string{"gold", "silver", "bronze"} }, 0},
+		}
+
+		for _, tc := range testCases {
+			field, err := fm.GetField("tier")
+			if err != nil {
+				t.Fatal(err)
+			}
+			tc.change(field)
+
+			err = fm.UpdateField(field)
+			switch {
+			case tc.expected == 0 && err != nil:
+				t.Errorf("%s: want no error; got %v", tc.name, err)
+			case tc.expected > 0 && (!errors.As(err, &inUse) || inUse.Contacts != tc.expected):
+				t.Errorf("%s: want %d contacts in use; got %v", tc.name, tc.expected, err)
+			}
+		}
+
+		// only the change which invalidated nothing was stored
+		field, err := fm.GetField("tier")
+		if err != nil || field.Version != 2 || len(field.EnumValues) != 3 || field.Required {
+			t.Errorf("want the enum value added at version 2; got %+v, %v", field, err)
+		}
+	})
+}
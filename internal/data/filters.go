@@ -0,0 +1,90 @@
+package data
+
+import (
+	"math"
+	"salestrekker_technical_interview.veljkoilic/internal/validator"
+	"strings"
+)
+
+// Filters holds the sorting and pagination parameters of a list request.
+// When After is set, the page holds the records with ids greater than After
+// instead of the records at the Page offset.
+type Filters struct {
+	Page         int
+	PageSize     int
+	Sort         string
+	SortSafelist []string
+	After        int64
+}
+
+func ValidateFilters(v *validator.Validator, f Filters) {
+	// check that the page and page_size parameters contain sensible values
+	v.Check(f.Page > 0, "page", "must be greater than zero")
+	v.Check(f.Page <= 10_000_000, "page", "must be a maximum of 10 million")
+	v.Check(f.PageSize > 0, "page_size", "must be greater than zero")
+	v.Check(f.PageSize <= 100, "page_size", "must be a maximum of 100")
+
+	// check that the sort parameter matches a value in the safelist
+	v.Check(validator.PermittedValue(f.Sort, f.SortSafelist...), "sort", "invalid sort value")
+
+	// cursors are keyed on the id ordering, so they can not be combined with other sorts or page offsets
+	if f.After > 0 {
+		v.Check(f.Sort == "id", "sort", "must be id when a cursor is used")
+		v.Check(f.Page == 1, "page", "can not be used together with a cursor")
+	}
+}
+
+// Return the field name to sort by, without the "-" prefix.
+// Panics if the sort value is not in the safelist, which ValidateFilters should have prevented.
+func (f Filters) sortColumn() string {
+	for _, safeValue := range f.SortSafelist {
+		if f.Sort == safeValue {
+			return strings.TrimPrefix(f.Sort, "-")
+		}
+	}
+
+	panic("unsafe sort parameter: " + f.Sort)
+}
+
+// Report whether the results are sorted in descending order
+func (f Filters) sortDescending() bool {
+	return strings.HasPrefix(f.Sort, "-")
+}
+
+func (f Filters) limit() int {
+	return f.PageSize
+}
+
+func (f Filters) offset() int {
+	return (f.Page - 1) * f.PageSize
+}
+
+// Metadata describes the page of records sent in a list response
+type Metadata struct {
+	CurrentPage  int    `json:"current_page,omitempty"`
+	PageSize     int    `json:"page_size,omitempty"`
+	FirstPage    int    `json:"first_page,omitempty"`
+	LastPage     int    `json:"last_page,omitempty"`
+	TotalRecords int    `json:"total_records,omitempty"`
+	NextCursor   string `json:"next_cursor,omitempty"`
+
+	// Id the next page starts after, when the records are ordered by id and more of them follow.
+	// It is turned into NextCursor by the handler.
+	NextAfter int64 `json:"-"`
+}
+
+// Calculate the pagination metadata from the total number of records, the current page and the page size.
+// If there are no records an empty Metadata is returned.
+func calculateMetadata(totalRecords, page, pageSize int) Metadata {
+	if totalRecords == 0 {
+		return Metadata{}
+	}
+
+	return Metadata{
+		CurrentPage:  page,
+		PageSize:     pageSize,
+		FirstPage:    1,
+		LastPage:     int(math.Ceil(float64(totalRecords) / float64(pageSize))),
+		TotalRecords: totalRecords,
+	}
+}
@@ -0,0 +1,169 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"salestrekker_technical_interview.veljkoilic/internal/validator"
+	"slices"
+	"strings"
+)
+
+var (
+	ErrDuplicateGroup = errors.New("group with the same name already exists")
+)
+
+// Group is a named set of contacts of a tenant, like "Suppliers" or "Belgrade office".
+// ContactIDs holds the ids of the members in ascending order, the members are contacts of the same tenant.
+// Version starts at 1 and is incremented every time the group or its members change.
+type Group struct {
+	ID          int64   `json:"id"`
+	Tenant      string  `json:"tenant"`
+	Name        string  `json:"name"`
+	Description string  `json:"description,omitempty"`
+	ContactIDs  []int64 `json:"contact_ids"`
+	Version     int32   `json:"version"`
+}
+
+// Return a deep copy of the group. The copy always has a non-nil member list.
+func (g *Group) clone() Group {
+	clone := *g
+	clone.ContactIDs = append([]int64{}, g.ContactIDs...)
+	return clone
+}
+
+// Report whether the contact is a member of the group
+func (g *Group) hasMember(contactID int64) bool {
+	_, found := slices.BinarySearch(g.ContactIDs, contactID)
+	return found
+}
+
+// Return a copy of the group without the contact among its members, at the next version
+func (g *Group) withoutMember(contactID int64) Group {
+	clone := g.clone()
+	clone.ContactIDs = slices.DeleteFunc(clone.ContactIDs, func(id int64) bool {
+		return id == contactID
+	})
+	clone.Version++
+	return clone
+}
+
+// GroupStore is implemented by every storage backend next to ContactStore. Groups are kept in the same
+// backend as the contacts, so a deleted contact is removed from its groups in the same operation.
+// Group names are unique within a tenant, the ids are unique across the tenants.
+type GroupStore interface {
+	// GetGroup returns a copy of the tenant's group with the given id, or ErrRecordNotFound
+	GetGroup(tenant string, id int64) (*Group, error)
+	// ListGroups returns copies of all the tenant's groups, ordered by id
+	ListGroups(tenant string) ([]Group, error)
+	// InsertGroup assigns a new id to the group and stores it in its tenant without any members
+	InsertGroup(group *Group) error
+	// UpdateGroup replaces the name and description of the stored group which has the same tenant, id and version
+	// as the one passed in, and increments the group's version. The members are left as they are.
+	UpdateGroup(group *Group) error
+	// DeleteGroup removes the tenant's group with the given id. Unless version is AnyVersion,
+	// ErrEditConflict is returned when the stored group is at a different version.
+	DeleteGroup(tenant string, id int64, version int32) error
+	// AddGroupMembers adds the tenant's contacts to the tenant's group in a single change, or returns
+	// ErrRecordNotFound and changes nothing if the group or any of the contacts does not exist.
+	// Contacts which are already members are left as they are.
+	AddGroupMembers(tenant string, groupID int64, contactIDs []int64) error
+	// RemoveGroupMember removes the contact from the tenant's group, or returns ErrRecordNotFound
+	// if the group does not exist or the contact is not its member
+	RemoveGroupMember(tenant string, groupID, contactID int64) error
+}
+
+// GroupsModel is what the handlers use to work with the groups of a tenant and their members
+type GroupsModel struct {
+	Store  GroupStore
+	tenant string
+}
+
+// Create a model of the groups of DefaultTenant. Models of the other tenants are made with ForTenant.
+func NewGroupsModel(store GroupStore) GroupsModel {
+	return GroupsModel{Store: store, tenant: DefaultTenant}
+}
+
+// Return a model of the groups of the tenant
+func (gm *GroupsModel) ForTenant(tenant string) *GroupsModel {
+	return &GroupsModel{Store: gm.Store, tenant: tenant}
+}
+
+func ValidateGroup(v *validator.Validator, group *Group) {
+	v.Check(strings.TrimSpace(group.Name) != "", "name", "must be provided")
+	v.Check(validator.MaxChars(group.Name, maxNameChars), "name", fmt.Sprintf("must not be more than %d characters long", maxNameChars))
+	v.Check(validator.MaxChars(group.Description, maxNotesChars), "description", fmt.Sprintf("must not be more than %d characters long", maxNotesChars))
+}
+
+// get a specific group
+func (gm *GroupsModel) GetGroup(id int64) (*Group, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	return gm.Store.GetGroup(gm.tenant, id)
+}
+
+// get all the groups, ordered by id
+func (gm *GroupsModel) ListGroups() ([]Group, error) {
+	return gm.Store.ListGroups(gm.tenant)
+}
+
+// Insert a new group without any members
+func (gm *GroupsModel) InsertGroup(group *Group) error {
+	group.Tenant = gm.tenant
+	group.Name = strings.TrimSpace(group.Name)
+	return gm.Store.InsertGroup(group)
+}
+
+// Replace the name and description of the stored group which has the same id and version as the group passed in
+func (gm *GroupsModel) UpdateGroup(group *Group) error {
+	if group.ID < 1 {
+		return ErrRecordNotFound
+	}
+
+	group.Tenant = gm.tenant
+	group.Name = strings.TrimSpace(group.Name)
+	return gm.Store.UpdateGroup(group)
+}
+
+// Delete a group, as long as it is still at the given version. The contacts in it are not touched.
+func (gm *GroupsModel) DeleteGroup(id int64, version int32) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	return gm.Store.DeleteGroup(gm.tenant, id, version)
+}
+
+// Add the contact to the group
+func (gm *GroupsModel) AddMember(groupID, contactID int64) error {
+	return gm.AddMembers(groupID, []int64{contactID})
+}
+
+// Add the contacts to the group, all of them or, when any of them does not exist, none
+func (gm *GroupsModel) AddMembers(groupID int64, contactIDs []int64) error {
+	if groupID < 1 || slices.ContainsFunc(contactIDs, func(id int64) bool { return id < 1 }) {
+		return ErrRecordNotFound
+	}
+
+	return gm.Store.AddGroupMembers(gm.tenant, groupID, contactIDs)
+}
+
+// Remove the contact from the group
+func (gm *GroupsModel) RemoveMember(groupID, contactID int64) error {
+	if groupID < 1 || contactID < 1 {
+		return ErrRecordNotFound
+	}
+
+	return gm.Store.RemoveGroupMember(gm.tenant, groupID, contactID)
+}
+
+// Generate a group id based on the maximum id of the stored groups. Stores which remember the ids they handed
+// out use it as the lowest id the next group may get.
+func generateGroupID(groups []Group) int64 {
+	id := int64(0)
+	for _, group := range groups {
+		id = max(id, group.ID)
+	}
+	return id + 1
+}
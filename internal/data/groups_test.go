@@ -0,0 +1,272 @@
+package data
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+// Testing creating, renaming and deleting groups
+func TestGroups(t *testing.T) {
+	forEachStore(t, nil, func(t *testing.T, cm ContactsModel) {
+		gm := NewGroupsModel(cm.Store)
+
+		suppliers := &Group{Name: "Suppliers", Description: "Everyone we buy from"}
+		if err := gm.InsertGroup(suppliers); err != nil {
+			t.Fatal(err)
+		}
+		office := &Group{Name: " Belgrade office "}
+		if err := gm.InsertGroup(office); err != nil {
+			t.Fatal(err)
+		}
+
+		want := Group{ID: 2, Tenant: DefaultTenant, Name: "Belgrade office", ContactIDs: []int64{}, Version: 1}
+		if got, err := gm.GetGroup(2); err != nil || !reflect.DeepEqual(*got, want) {
+			t.Errorf("want %+v; got %+v, %v", want, got, err)
+		}
+
+		if err := gm.InsertGroup(&Group{Name: "Suppliers"}); err != ErrDuplicateGroup {
+			t.Errorf("want %v; got %v", ErrDuplicateGroup, err)
+		}
+
+		office.Name = "Suppliers"
+		if err := gm.UpdateGroup(office); err != ErrDuplicateGroup {
+			t.Errorf("want %v; got %v", ErrDuplicateGroup, err)
+		}
+
+		office.Name = "Novi Sad office"
+		if err := gm.UpdateGroup(office); err != nil || office.Version != 2 {
+			t.Errorf("want version 2; got %d, %v", office.Version, err)
+		}
+
+		stale := *office
+		stale.Version = 1
+		if err := gm.UpdateGroup(&stale); err != ErrEditConflict {
+			t.Errorf("want %v; got %v", ErrEditConflict, err)
+		}
+
+		if err := gm.DeleteGroup(office.ID, 1); err != ErrEditConflict {
+			t.Errorf("want %v; got %v", ErrEditConflict, err)
+		}
+		if err := gm.DeleteGroup(office.ID, 2); err != nil {
+			t.Fatal(err)
+		}
+		if err := gm.DeleteGroup(office.ID, AnyVersion); err != ErrRecordNotFound {
+			t.Errorf("want %v; got %v", ErrRecordNotFound, err)
+		}
+
+		groups, err := gm.ListGroups()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(groups) != 1 || groups[0].Name != "Suppliers" {
+			t.Errorf("want only Suppliers; got %+v", groups)
+		}
+	})
+}
+
+// Testing adding and removing members, and that deleted contacts leave their groups
+func TestGroupMembers(t *testing.T) {
+	data := []Contact{
+		{ID: 1, FirstName: "Veljko", LastName: "Ilic", Telephone: "+38163577442"},
+		{ID: 2, FirstName: "Marko", LastName: "Markovic", Telephone: "+38163587442"},
+		{ID: 3, FirstName: "Ilija", LastName: "Ilinovic", Telephone: "+38164598332"},
+	}
+
+	forEachStore(t, data, func(t *testing.T, cm ContactsModel) {
+		gm := NewGroupsModel(cm.Store)
+
+		group := &Group{Name: "Suppliers"}
+		if err := gm.InsertGroup(group); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, id := range []int64{3, 1, 3} {
+			if err := gm.AddMember(group.ID, id); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		testCases := []struct {
+			groupID, contactID int64
+		}{
+			{group.ID, 4},
+			{group.ID + 1, 1},
+		}
+		for _, tc := range testCases {
+			if err := gm.AddMember(tc.groupID, tc.contactID); err != ErrRecordNotFound {
+				t.Errorf("want %v; got %v", ErrRecordNotFound, err)
+			}
+		}
+
+		// adding a contact which already was a member does not change the version
+		got, err := gm.GetGroup(group.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got.ContactIDs, []int64{1, 3}) || got.Version != 3 {
+			t.Errorf("want members [1 3] at version 3; got %v at version %d", got.ContactIDs, got.Version)
+		}
+
+		if err := gm.RemoveMember(group.ID, 2); err != ErrRecordNotFound {
+			t.Errorf("want %v; got %v", ErrRecordNotFound, err)
+		}
+
+		if err := cm.DeleteContact(3); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err = gm.GetGroup(group.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got.ContactIDs, []int64{1}) || got.Version != 4 {
+			t.Errorf("want members [1] at version 4; got %v at version %d", got.ContactIDs, got.Version)
+		}
+
+		if err := gm.RemoveMember(group.ID, 1); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err = gm.GetGroup(group.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got.ContactIDs) != 0 || got.ContactIDs == nil {
+			t.Errorf("want empty members; got %#v", got.ContactIDs)
+		}
+	})
+}
+
+// Testing that a list of contacts is added to a group all at once, or not at all when one of them does not exist
+func TestAddMembers(t *testing.T) {
+	data := []Contact{
+		{ID: 1, FirstName: "Veljko", LastName: "Ilic", Telephone: "+38163577442"},
+		{ID: 2, FirstName: "Marko", LastName: "Markovic", Telephone: "+38163587442"},
+		{ID: 3, FirstName: "Ilija", LastName: "Ilinovic", Telephone: "+38164598332"},
+	}
+
+	forEachStore(t, data, func(t *testing.T, cm ContactsModel) {
+		gm := NewGroupsModel(cm.Store)
+
+		group := &Group{Name: "Suppliers"}
+		if err := gm.InsertGroup(group); err != nil {
+			t.Fatal(err)
+		}
+		if err := gm.AddMember(group.ID, 3); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := gm.AddMembers(group.ID, []int64{1, 4}); err != ErrRecordNotFound {
+			t.Errorf("want %v; got %v", ErrRecordNotFound, err)
+		}
+
+		// the members already in the group are kept, the new ones are added in a single version
+		if err := gm.AddMembers(group.ID, []int64{3, 2, 1}); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := gm.GetGroup(group.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got.ContactIDs, []int64{1, 2, 3}) || got.Version != 3 {
+			t.Errorf("want members [1 2 3] at version 3; got %v at version %d", got.ContactIDs, got.Version)
+		}
+	})
+}
+
+// Testing that the id of a deleted group is not given to the next one
+func TestDeletedGroupIDsNotReused(t *testing.T) {
+	forEachStore(t, nil, func(t *testing.T, cm ContactsModel) {
+		gm := NewGroupsModel(cm.Store)
+
+		first, second := &Group{Name: "Suppliers"}, &Group{Name: "Customers"}
+		for _, group := range []*Group{first, second} {
+			if err := gm.InsertGroup(group); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := gm.DeleteGroup(second.ID, AnyVersion); err != nil {
+			t.Fatal(err)
+		}
+
+		next := &Group{Name: "Partners"}
+		if err := gm.InsertGroup(next); err != nil {
+			t.Fatal(err)
+		}
+		if next.ID != second.ID+1 {
+			t.Errorf("want %d; got %d", second.ID+1, next.ID)
+		}
+	})
+}
+
+// Testing filtering contacts by tag and by group
+func TestFilterContactsByTagAndGroup(t *testing.T) {
+	data := []Contact{
+		{ID: 1, FirstName: "Veljko", LastName: "Ilic", Telephone: "+38163577442"},
+		{ID: 2, FirstName: "Marko", LastName: "Markovic", Telephone: "+38163587442"},
+		{ID: 3, FirstName: "Ilija", LastName: "Ilinovic", Telephone: "+38164598332"},
+	}
+
+	forEachStore(t, data, func(t *testing.T, cm ContactsModel) {
+		gm := NewGroupsModel(cm.Store)
+
+		for id, tags := range map[int64][]string{1: {"VIP", " supplier", "vip"}, 3: {"supplier"}} {
+			contact, err := cm.GetContact(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			contact.Tags = tags
+			if err := cm.UpdateContact(contact); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		contact, err := cm.GetContact(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"VIP", "supplier"}; !slices.Equal(contact.Tags, want) {
+			t.Errorf("want tags %v; got %v", want, contact.Tags)
+		}
+
+		group := &Group{Name: "Belgrade office"}
+		if err := gm.InsertGroup(group); err != nil {
+			t.Fatal(err)
+		}
+		for _, id := range []int64{2, 3} {
+			if err := gm.AddMember(group.ID, id); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		testCases := []struct {
+			match       ContactFilter
+			expectedIDs []int64
+		}{
+			{ContactFilter{Tag: "supplier"}, []int64{1, 3}},
+			{ContactFilter{Tag: "vip"}, []int64{1}},
+			{ContactFilter{Tag: "supp"}, []int64{}},
+			{ContactFilter{Group: group.ID}, []int64{2, 3}},
+			{ContactFilter{Group: group.ID, Tag: "SUPPLIER"}, []int64{3}},
+			{ContactFilter{Group: group.ID + 1}, []int64{}},
+		}
+
+		filters := Filters{Page: 1, PageSize: 20, Sort: "id", SortSafelist: []string{"id"}}
+		for _, tc := range testCases {
+			contacts, _, err := cm.FilterContacts(tc.match, filters)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ids := []int64{}
+			for _, contact := range contacts {
+				ids = append(ids, contact.ID)
+			}
+			if !slices.Equal(ids, tc.expectedIDs) {
+				t.Errorf("%+v: want ids %v; got %v", tc.match, tc.expectedIDs, ids)
+			}
+		}
+	})
+}
@@ -0,0 +1,232 @@
+package data
+
+import (
+	"fmt"
+	"salestrekker_technical_interview.veljkoilic/internal/validator"
+	"slices"
+)
+
+// Ways of handling an imported row which is the same contact as one already stored
+const (
+	ImportSkip      = "skip"
+	ImportOverwrite = "overwrite"
+	ImportFail      = "fail"
+)
+
+var ImportModes = []string{ImportSkip, ImportOverwrite, ImportFail}
+
+// Outcome of importing a single row
+const (
+	ImportCreated = "created"
+	ImportUpdated = "updated"
+	ImportSkipped = "skipped"
+	ImportFailed  = "failed"
+)
+
+// ImportRow is the outcome of importing the CSV row or the vCard which starts at Line. For a card which
+// can not be read, Line is the line the syntax error is at. ID is the contact the row was stored as,
+// or the stored contact it duplicates.
+type ImportRow struct {
+	Line   int               `json:"line"`
+	Status string            `json:"status"`
+	ID     int64             `json:"id,omitempty"`
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// ImportSummary counts the outcomes of every row of an import. Columns of a CSV file which are
+// not mapped to any contact field are listed in IgnoredColumns.
+type ImportSummary struct {
+	Created        int         `json:"created"`
+	Updated        int         `json:"updated"`
+	Skipped        int         `json:"skipped"`
+	Failed         int         `json:"failed"`
+	IgnoredColumns []string    `json:"ignored_columns,omitempty"`
+	Rows           []ImportRow `json:"rows"`
+}
+
+// Count the outcome of a row
+func (s *ImportSummary) count(status string) {
+	switch status {
+	case ImportCreated:
+		s.Created++
+	case ImportUpdated:
+		s.Updated++
+	case ImportSkipped:
+		s.Skipped++
+	case ImportFailed:
+		s.Failed++
+	}
+}
+
+// importer checks the rows of an import against the stored contacts and the rows imported before them,
+// and collects the contacts which have to be created or overwritten. save stores all of them with a single
+// SaveContacts call, so a store which writes a file does it once per import instead of once per row.
+type importer struct {
+	cm         *ContactsModel
+	duplicates string
+	fields     []Field
+	summary    *ImportSummary
+
+	// the stored contacts and the ones created by earlier rows, which every row is compared with
+	existing []*Contact
+	// contacts to save, the new ones have no id yet
+	changes []*Contact
+	// index in changes of every contact of existing which is going to be saved
+	changed map[*Contact]int
+	// rows of the summary whose outcome is only known once the contacts are saved
+	pending []pendingRow
+}
+
+// A row of the summary and the index in changes of the contact it depends on
+type pendingRow struct {
+	row    int
+	change int
+}
+
+// Start an import which reports the outcome of every row in summary
+func (cm *ContactsModel) newImporter(summary *ImportSummary, duplicates string, fields []Field) (*importer, error) {
+	stored, err := cm.ListContacts()
+	if err != nil {
+		return nil, err
+	}
+
+	existing := make([]*Contact, len(stored))
+	for i := range stored {
+		existing[i] = &stored[i]
+	}
+
+	return &importer{
+		cm:         cm,
+		duplicates: duplicates,
+		fields:     fields,
+		summary:    summary,
+		existing:   existing,
+		changed:    map[*Contact]int{},
+	}, nil
+}
+
+// Record the outcome of a row which does not store anything
+func (imp *importer) add(row ImportRow) {
+	imp.summary.Rows = append(imp.summary.Rows, row)
+}
+
+// Record a row which creates or overwrites the contact, or is the same contact as it.
+// The row gets the contact's id once the contact is saved, and fails when the contact can not be.
+func (imp *importer) queue(row ImportRow, contact *Contact) {
+	index, ok := imp.changed[contact]
+	if !ok {
+		index = len(imp.changes)
+		imp.changes = append(imp.changes, contact)
+		imp.changed[contact] = index
+	}
+	imp.pending = append(imp.pending, pendingRow{row: len(imp.summary.Rows), change: index})
+	imp.add(row)
+}
+
+// Record a row which is the same contact as stored, without storing anything for it
+func (imp *importer) addDuplicate(row ImportRow, stored *Contact) {
+	if _, ok := imp.changed[stored]; ok {
+		imp.queue(row, stored)
+		return
+	}
+
+	row.ID = stored.ID
+	if row.Status == ImportFailed && row.Errors == nil {
+		row.Errors = sameContactErrors(stored.ID)
+	}
+	imp.add(row)
+}
+
+func sameContactErrors(id int64) map[string]string {
+	return map[string]string{"row": fmt.Sprintf("same contact already exists with id %d", id)}
+}
+
+// Import the row which starts at line. apply sets the fields the row holds on a contact, and reports
+// the values it can not read to v. The row is created as a new contact, unless it is the same contact
+// as one of existing, in which case it is handled as duplicates says.
+func (imp *importer) importContact(line int, apply func(v *validator.Validator, contact *Contact)) {
+	v := validator.New()
+
+	contact := &Contact{}
+	if apply(v, contact); !v.IsValid() {
+		imp.add(ImportRow{Line: line, Status: ImportFailed, Errors: v.Errors})
+		return
+	}
+
+	// the duplicate check compares the numbers in the form they are stored in
+	normalizeContact(contact)
+
+	index := slices.IndexFunc(imp.existing, func(c *Contact) bool { return areContactsEqual(c, contact) })
+	if index != -1 {
+		stored := imp.existing[index]
+
+		switch imp.duplicates {
+		case ImportSkip:
+			imp.addDuplicate(ImportRow{Line: line, Status: ImportSkipped}, stored)
+			return
+		case ImportFail:
+			imp.addDuplicate(ImportRow{Line: line, Status: ImportFailed}, stored)
+			return
+		}
+
+		// copy the imported fields over the stored contact, the rest of its fields stay as they are
+		updated := stored.clone()
+		apply(v, &updated)
+
+		if ValidateContact(v, &updated, imp.fields); !v.IsValid() {
+			imp.addDuplicate(ImportRow{Line: line, Status: ImportFailed, Errors: v.Errors}, stored)
+			return
+		}
+
+		// a contact created or overwritten by an earlier row is saved once, with the fields of both rows
+		if _, ok := imp.changed[stored]; ok {
+			*stored = updated
+		} else {
+			stored = &updated
+			imp.existing[index] = stored
+		}
+		imp.queue(ImportRow{Line: line, Status: ImportUpdated}, stored)
+		return
+	}
+
+	if ValidateContact(v, contact, imp.fields); !v.IsValid() {
+		imp.add(ImportRow{Line: line, Status: ImportFailed, Errors: v.Errors})
+		return
+	}
+
+	imp.existing = append(imp.existing, contact)
+	imp.queue(ImportRow{Line: line, Status: ImportCreated}, contact)
+}
+
+// Save the contacts of the import, fill in the outcome of the rows which depend on them and count the outcomes
+func (imp *importer) save() (*ImportSummary, error) {
+	if len(imp.changes) > 0 {
+		errs, err := imp.cm.saveContacts(imp.changes)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, pending := range imp.pending {
+			row := &imp.summary.Rows[pending.row]
+			contact := imp.changes[pending.change]
+
+			switch err := errs[pending.change]; {
+			case err != nil && contact.ID == 0:
+				row.Status, row.Errors = ImportFailed, map[string]string{"row": err.Error()}
+			case err != nil:
+				row.Status, row.ID = ImportFailed, contact.ID
+				row.Errors = map[string]string{"row": "the contact was changed while it was being imported"}
+			default:
+				row.ID = contact.ID
+				if row.Status == ImportFailed && row.Errors == nil {
+					row.Errors = sameContactErrors(contact.ID)
+				}
+			}
+		}
+	}
+
+	for _, row := range imp.summary.Rows {
+		imp.summary.count(row.Status)
+	}
+	return imp.summary, nil
+}
@@ -0,0 +1,661 @@
+package data
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Number of backup generations kept next to the contacts file when none is configured
+const DefaultBackups = 3
+
+// JSONFileStore keeps contacts, groups, custom fields and users in memory and rewrites the whole JSON file after every change.
+// The write lock is held until the file is saved, so saves never interleave.
+//
+// Every save writes a temporary file, syncs it to disk and renames it over the contacts file,
+// so a crash leaves either the old or the new file in place, never a half written one.
+// Before the rename the previous file is kept as <path>.bak.1, older generations are shifted
+// to <path>.bak.2 ... <path>.bak.N.
+//
+// Tokens change with every login, so they are kept in <path>.tokens, which is written the same way
+// but without backups. Logging in never rewrites the contacts file nor pushes a backup generation out.
+type JSONFileStore struct {
+	*MemoryStore
+	path    string
+	backups int
+
+	// Set to the file the contacts were loaded from, when the contacts file itself was corrupt
+	RecoveredFrom string
+
+	// Called after every save of the contacts file with how long the save took and the error it failed with, if any.
+	// It is called with the write lock held, so it must not use the store. Set it before the store is used.
+	ObserveSave func(duration time.Duration, err error)
+}
+
+// Create a JSONFileStore backed by the file at path and load the contacts already stored in it.
+// backups is the number of backup generations kept; if less than 1, DefaultBackups is used.
+func NewJSONFileStore(path string, backups int) (*JSONFileStore, error) {
+	if backups < 1 {
+		backups = DefaultBackups
+	}
+
+	store := &JSONFileStore{
+		MemoryStore: NewMemoryStore(nil),
+		path:        path,
+		backups:     backups,
+	}
+
+	err := store.GetAllContacts()
+	if err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+func (s *JSONFileStore) Insert(contact *Contact) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := s.snapshot()
+
+	err := s.insert(contact)
+	if err != nil {
+		return err
+	}
+
+	// Save all contacts + newly created one to the file
+	return s.persist(previous)
+}
+
+func (s *JSONFileStore) Update(contact *Contact) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := s.snapshot()
+
+	err := s.update(contact)
+	if err != nil {
+		return err
+	}
+
+	return s.persist(previous)
+}
+
+func (s *JSONFileStore) SaveContacts(contacts []*Contact) ([]error, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := s.snapshot()
+
+	errs, changed := s.saveContacts(contacts)
+	if !changed {
+		return errs, nil
+	}
+
+	err := s.persist(previous)
+	if err != nil {
+		return nil, err
+	}
+	return errs, nil
+}
+
+func (s *JSONFileStore) Delete(tenant string, id int64, version int32) (*Contact, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := s.snapshot()
+
+	deleted, err := s.delete(tenant, id, version)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.persist(previous)
+	if err != nil {
+		return nil, err
+	}
+	return deleted, nil
+}
+
+func (s *JSONFileStore) InsertGroup(group *Group) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := s.snapshot()
+
+	err := s.insertGroup(group)
+	if err != nil {
+		return err
+	}
+
+	return s.persist(previous)
+}
+
+func (s *JSONFileStore) UpdateGroup(group *Group) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := s.snapshot()
+
+	err := s.updateGroup(group)
+	if err != nil {
+		return err
+	}
+
+	return s.persist(previous)
+}
+
+func (s *JSONFileStore) DeleteGroup(tenant string, id int64, version int32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := s.snapshot()
+
+	err := s.deleteGroup(tenant, id, version)
+	if err != nil {
+		return err
+	}
+
+	return s.persist(previous)
+}
+
+func (s *JSONFileStore) AddGroupMembers(tenant string, groupID int64, contactIDs []int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := s.snapshot()
+
+	changed, err := s.addGroupMembers(tenant, groupID, contactIDs)
+	if err != nil || !changed {
+		return err
+	}
+
+	return s.persist(previous)
+}
+
+func (s *JSONFileStore) RemoveGroupMember(tenant string, groupID, contactID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := s.snapshot()
+
+	err := s.removeGroupMember(tenant, groupID, contactID)
+	if err != nil {
+		return err
+	}
+
+	return s.persist(previous)
+}
+
+func (s *JSONFileStore) InsertField(field *Field) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := s.snapshot()
+
+	err := s.insertField(field)
+	if err != nil {
+		return err
+	}
+
+	return s.persist(previous)
+}
+
+func (s *JSONFileStore) UpdateField(field *Field) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := s.snapshot()
+
+	err := s.updateField(field)
+	if err != nil {
+		return err
+	}
+
+	return s.persist(previous)
+}
+
+func (s *JSONFileStore) DeleteField(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := s.snapshot()
+
+	err := s.deleteField(name)
+	if err != nil {
+		return err
+	}
+
+	return s.persist(previous)
+}
+
+func (s *JSONFileStore) InsertUser(user *User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := s.snapshot()
+
+	err := s.insertUser(user)
+	if err != nil {
+		return err
+	}
+
+	return s.persist(previous)
+}
+
+func (s *JSONFileStore) UpdateUser(user *User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := s.snapshot()
+
+	err := s.updateUser(user)
+	if err != nil {
+		return err
+	}
+
+	return s.persist(previous)
+}
+
+func (s *JSONFileStore) InsertToken(token *Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := s.tokens
+
+	s.insertToken(token)
+
+	return s.persistTokens(previous)
+}
+
+func (s *JSONFileStore) DeleteTokensForUser(scope string, userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := s.tokens
+
+	s.deleteTokensForUser(scope, userID)
+
+	return s.persistTokens(previous)
+}
+
+// Close waits for a save in progress to finish. Every change is saved before the method making it
+// returns, so once no save is running there is nothing left to write.
+func (s *JSONFileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return nil
+}
+
+// Copy of everything stored as it was before a change, so the change can be undone
+func (s *JSONFileStore) snapshot() storeFile {
+	return storeFile{
+		Contacts:    append([]Contact{}, s.contacts...),
+		Groups:      append([]Group{}, s.groups...),
+		Fields:      append([]Field{}, s.fields...),
+		Users:       append([]User{}, s.users...),
+		Tokens:      append([]Token{}, s.tokens...),
+		NextIDs:     s.nextIDs,
+		NextGroupID: s.nextGroupID,
+	}
+}
+
+// Save everything, and if that fails roll the in-memory state back to previous,
+// so memory never holds changes which are not on the disk
+func (s *JSONFileStore) persist(previous storeFile) error {
+	err := s.SaveAllContacts()
+	if err != nil {
+		s.load(previous)
+		return err
+	}
+	return nil
+}
+
+// Save the tokens, and if that fails roll them back to previous
+func (s *JSONFileStore) persistTokens(previous []Token) error {
+	err := s.saveTokens()
+	if err != nil {
+		s.tokens = previous
+		return err
+	}
+	return nil
+}
+
+func (s *JSONFileStore) load(contents storeFile) {
+	s.contacts, s.groups, s.fields = contents.Contacts, contents.Groups, contents.Fields
+	s.users, s.tokens = contents.Users, contents.Tokens
+	s.nextIDs, s.nextGroupID = contents.NextIDs, contents.NextGroupID
+}
+
+// Load the contacts, groups, custom fields and users from the file, and the tokens from the tokens file.
+// If the contacts file is corrupt, the backup generations are tried from newest to oldest and the first valid one is loaded.
+func (s *JSONFileStore) GetAllContacts() error {
+	err := s.loadContacts()
+	if err != nil {
+		return err
+	}
+	return s.loadTokens()
+}
+
+func (s *JSONFileStore) loadContacts() error {
+	contents, err := readContactsFile(s.path)
+	switch {
+	case err == nil:
+		s.load(contents)
+		return nil
+	// No file yet, start with an empty contact list
+	case errors.Is(err, fs.ErrNotExist):
+		s.load(storeFile{Contacts: []Contact{}, Groups: []Group{}, Fields: []Field{}, Users: []User{}, Tokens: []Token{}, NextIDs: map[string]int64{}})
+		return nil
+	}
+
+	for generation := 1; generation <= s.backups; generation++ {
+		backup := s.backupPath(generation)
+
+		contents, backupErr := readContactsFile(backup)
+		if backupErr != nil {
+			continue
+		}
+
+		s.load(contents)
+		s.RecoveredFrom = backup
+		return nil
+	}
+
+	return fmt.Errorf("loading %s: %w", s.path, err)
+}
+
+// Tokens only save the users from logging in again, so a tokens file which can not be read is
+// dropped rather than failing the store. Contacts files written before the tokens had a file of
+// their own hold the tokens, they are moved to the tokens file.
+func (s *JSONFileStore) loadTokens() error {
+	js, err := os.ReadFile(s.tokensPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		if len(s.tokens) == 0 {
+			return nil
+		}
+		return s.saveTokens()
+	}
+
+	var records []tokenRecord
+	if err == nil {
+		err = json.Unmarshal(js, &records)
+	}
+
+	s.tokens = []Token{}
+	if err != nil {
+		return nil
+	}
+	for _, record := range records {
+		s.tokens = append(s.tokens, Token{Hash: record.Hash, UserID: record.UserID, Expiry: record.Expiry, Scope: record.Scope})
+	}
+	return nil
+}
+
+// Save all existing contacts, groups, custom fields and users to a JSON file
+func (s *JSONFileStore) SaveAllContacts() error {
+	start := time.Now()
+	err := s.save()
+	if s.ObserveSave != nil {
+		s.ObserveSave(time.Since(start), err)
+	}
+	return err
+}
+
+func (s *JSONFileStore) save() error {
+	return writeFileAtomic(s.path, s.snapshot(), func() error {
+		err := s.rotateBackups()
+		if err != nil {
+			return fmt.Errorf("rotating contact backups: %w", err)
+		}
+		return nil
+	})
+}
+
+func (s *JSONFileStore) saveTokens() error {
+	records := []tokenRecord{}
+	for _, token := range s.tokens {
+		records = append(records, tokenRecord{Hash: token.Hash, UserID: token.UserID, Expiry: token.Expiry, Scope: token.Scope})
+	}
+	return writeFileAtomic(s.tokensPath(), records, nil)
+}
+
+// Write v as JSON to a temporary file in the directory of path, sync it and rename it over the file at path.
+// beforeRename, when set, is called once the temporary file is on the disk, just before the rename.
+func writeFileAtomic(path string, v any, beforeRename func() error) error {
+	dir, name := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+
+	// Write to a temporary file in the same directory, so it can be renamed over the file
+	tmp, err := os.CreateTemp(dir, name+".tmp*")
+	if err != nil {
+		return fmt.Errorf("saving %s: %w", name, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	err = tmp.Chmod(0644)
+	if err == nil {
+		err = json.NewEncoder(tmp).Encode(v)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("saving %s: %w", name, err)
+	}
+
+	if beforeRename != nil {
+		err = beforeRename()
+		if err != nil {
+			return err
+		}
+	}
+
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		return fmt.Errorf("saving %s: %w", name, err)
+	}
+
+	// Make the rename itself durable. Not every platform allows syncing a directory,
+	// and the data is already safe in the renamed file, so this is best effort.
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+
+	return nil
+}
+
+// Shift every backup one generation back, dropping the oldest one, and keep the
+// current contacts file as the newest backup
+func (s *JSONFileStore) rotateBackups() error {
+	err := os.Remove(s.backupPath(s.backups))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	for generation := s.backups - 1; generation >= 1; generation-- {
+		err := os.Rename(s.backupPath(generation), s.backupPath(generation+1))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	// Hard link the current file instead of renaming it, so the contacts file never goes missing
+	err = os.Link(s.path, s.backupPath(1))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return copyFile(s.path, s.backupPath(1))
+	}
+
+	return nil
+}
+
+func (s *JSONFileStore) backupPath(generation int) string {
+	return fmt.Sprintf("%s.bak.%d", s.path, generation)
+}
+
+func (s *JSONFileStore) tokensPath() string {
+	return s.path + ".tokens"
+}
+
+// Layout of the contacts file. Files written before groups were introduced hold
+// just the array of contacts, readContactsFile accepts both. Tokens are read from
+// files written before they moved to the tokens file, but never written.
+type storeFile struct {
+	Contacts []Contact `json:"contacts"`
+	Groups   []Group   `json:"groups"`
+	Fields   []Field   `json:"fields"`
+	Users    []User    `json:"-"`
+	Tokens   []Token   `json:"-"`
+	// Files written before the ids were counted do not have it, their ids start past the highest one stored
+	NextIDs     map[string]int64 `json:"next_id"`
+	NextGroupID int64            `json:"next_group_id"`
+}
+
+// Users and tokens are written as records, which keep the hashes and versions the JSON of User and Token leaves out
+type userRecord struct {
+	User
+	PasswordHash []byte `json:"password_hash"`
+	Version      int32  `json:"version"`
+}
+
+type tokenRecord struct {
+	Hash   []byte    `json:"hash"`
+	UserID int64     `json:"user_id"`
+	Expiry time.Time `json:"expiry"`
+	Scope  string    `json:"scope"`
+}
+
+// storeFileAlias has the fields of storeFile without its JSON methods
+type storeFileAlias storeFile
+
+type storeFileJSON struct {
+	storeFileAlias
+	Users  []userRecord  `json:"users"`
+	Tokens []tokenRecord `json:"tokens,omitempty"`
+}
+
+func (f storeFile) MarshalJSON() ([]byte, error) {
+	contents := storeFileJSON{storeFileAlias: storeFileAlias(f), Users: []userRecord{}}
+
+	for _, user := range f.Users {
+		contents.Users = append(contents.Users, userRecord{User: user, PasswordHash: user.Password.hash, Version: user.Version})
+	}
+
+	return json.Marshal(contents)
+}
+
+func (f *storeFile) UnmarshalJSON(js []byte) error {
+	var contents storeFileJSON
+
+	err := json.Unmarshal(js, &contents)
+	if err != nil {
+		return err
+	}
+
+	*f = storeFile(contents.storeFileAlias)
+	for _, record := range contents.Users {
+		user := record.User
+		user.Password.hash = record.PasswordHash
+		user.Version = record.Version
+		// users stored before there were permissions get the role new users start with
+		if user.Permissions == nil {
+			user.Permissions, _ = RolePermissions(DefaultRole)
+		}
+		f.Users = append(f.Users, user)
+	}
+	for _, record := range contents.Tokens {
+		f.Tokens = append(f.Tokens, Token{Hash: record.Hash, UserID: record.UserID, Expiry: record.Expiry, Scope: record.Scope})
+	}
+	return nil
+}
+
+// Read and decode a contacts file. An empty file holds no contacts.
+func readContactsFile(path string) (storeFile, error) {
+	var contents storeFile
+
+	js, err := os.ReadFile(path)
+	if err != nil {
+		return contents, err
+	}
+
+	js = bytes.TrimSpace(js)
+	switch {
+	case len(js) == 0:
+	case js[0] == '[':
+		err = json.Unmarshal(js, &contents.Contacts)
+	default:
+		err = json.Unmarshal(js, &contents)
+	}
+	if err != nil {
+		return storeFile{}, err
+	}
+
+	if contents.Contacts == nil {
+		contents.Contacts = []Contact{}
+	}
+	if contents.Groups == nil {
+		contents.Groups = []Group{}
+	}
+	if contents.Fields == nil {
+		contents.Fields = []Field{}
+	}
+	if contents.Users == nil {
+		contents.Users = []User{}
+	}
+	if contents.Tokens == nil {
+		contents.Tokens = []Token{}
+	}
+	if contents.NextIDs == nil {
+		contents.NextIDs = map[string]int64{}
+	}
+	setMissingVersions(contents.Contacts)
+	setMissingTenants(contents.Contacts)
+	for i := range contents.Groups {
+		if contents.Groups[i].Tenant == "" {
+			contents.Groups[i].Tenant = DefaultTenant
+		}
+	}
+	for i := range contents.Users {
+		if contents.Users[i].Tenant == "" {
+			contents.Users[i].Tenant = DefaultTenant
+		}
+	}
+	return contents, nil
+}
+
+// Copy the file at src to dst, syncing dst to disk
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+	if err == nil {
+		err = out.Sync()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,376 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Testing that contacts written by one JSONFileStore are loaded by the next one
+func TestJSONFileStorePersistsContacts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "contacts.json")
+
+	store, err := NewJSONFileStore(path, DefaultBackups)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contacts := []*Contact{
+		{Tenant: DefaultTenant, FirstName: "Veljko", LastName: "Ilic", Telephone: "+38163577442"},
+		{Tenant: DefaultTenant, FirstName: "Marko", LastName: "Markovic", Telephone: "+38163587442"},
+	}
+	for _, contact := range contacts {
+		if err := store.Insert(contact); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := store.Delete(DefaultTenant, contacts[0].ID, AnyVersion); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := NewJSONFileStore(path, DefaultBackups)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := reopened.List(DefaultTenant)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != 1 || !reflect.DeepEqual(got[0], *contacts[1]) {
+		t.Errorf("want [%v]; got %v", *contacts[1], got)
+	}
+}
+
+// Testing that the next contact and group ids are kept in the file, so a reopened store does not reuse deleted ids
+func TestJSONFileStorePersistsNextIDs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "contacts.json")
+
+	store, err := NewJSONFileStore(path, DefaultBackups)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contact := &Contact{Tenant: DefaultTenant, FirstName: "Veljko", LastName: "Ilic", Telephone: "+38163577442"}
+	if err := store.Insert(contact); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Delete(DefaultTenant, contact.ID, AnyVersion); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := NewJSONFileStore(path, DefaultBackups)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next := &Contact{Tenant: DefaultTenant, FirstName: "Marko", LastName: "Markovic", Telephone: "+38163587442"}
+	if err := reopened.Insert(next); err != nil {
+		t.Fatal(err)
+	}
+	if next.ID != 2 {
+		t.Errorf("want %d; got %d", 2, next.ID)
+	}
+
+	// group ids are kept the same way
+	group := &Group{Tenant: DefaultTenant, Name: "Suppliers"}
+	if err := reopened.InsertGroup(group); err != nil {
+		t.Fatal(err)
+	}
+	if err := reopened.DeleteGroup(DefaultTenant, group.ID, AnyVersion); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err = NewJSONFileStore(path, DefaultBackups)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nextGroup := &Group{Tenant: DefaultTenant, Name: "Customers"}
+	if err := reopened.InsertGroup(nextGroup); err != nil {
+		t.Fatal(err)
+	}
+	if nextGroup.ID != 2 {
+		t.Errorf("want %d; got %d", 2, nextGroup.ID)
+	}
+}
+
+// Testing that a corrupt contacts file is recovered from the newest valid backup generation
+func TestJSONFileStoreRecoversFromBackup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "contacts.json")
+
+	store, err := NewJSONFileStore(path, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := &Contact{Tenant: DefaultTenant, FirstName: "Veljko", LastName: "Ilic", Telephone: "+38163577442"}
+	second := &Contact{Tenant: DefaultTenant, FirstName: "Marko", LastName: "Markovic", Telephone: "+38163587442"}
+	third := &Contact{Tenant: DefaultTenant, FirstName: "Ilija", LastName: "Ilinovic", Telephone: "+38164598332"}
+	for _, contact := range []*Contact{first, second, third} {
+		if err := store.Insert(contact); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only 2 generations are kept, the file holding just the first contact has to be gone
+	if _, err := os.Stat(path + ".bak.3"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("want no third backup generation; got %v", err)
+	}
+
+	// Simulate a crash which left garbage in the contacts file and in the newest backup
+	if err := os.WriteFile(path, []byte(`[{"id": 1, "first_na`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path+".bak.1", []byte(`not json`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := NewJSONFileStore(path, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reopened.RecoveredFrom != path+".bak.2" {
+		t.Errorf("want recovery from %s; got %q", path+".bak.2", reopened.RecoveredFrom)
+	}
+
+	got, err := reopened.List(DefaultTenant)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != 1 || !reflect.DeepEqual(got[0], *first) {
+		t.Errorf("want [%v]; got %v", *first, got)
+	}
+}
+
+// Testing that a failed save is reported and the change is not kept in memory
+func TestJSONFileStoreSaveFailure(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "contacts")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := NewJSONFileStore(filepath.Join(dir, "contacts.json"), DefaultBackups)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Removing the directory makes every following save fail
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	err = store.Insert(&Contact{Tenant: DefaultTenant, FirstName: "Veljko", LastName: "Ilic", Telephone: "+38163577442"})
+	if err == nil {
+		t.Fatal("want error; got nil")
+	}
+
+	got, err := store.List(DefaultTenant)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != 0 {
+		t.Errorf("want no contacts; got %v", got)
+	}
+}
+
+// Testing that every save, failed or not, is reported to ObserveSave
+func TestJSONFileStoreObserveSave(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "contacts")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := NewJSONFileStore(filepath.Join(dir, "contacts.json"), DefaultBackups)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var errs []error
+	store.ObserveSave = func(duration time.Duration, err error) {
+		if duration <= 0 {
+			t.Errorf("want a positive duration; got %v", duration)
+		}
+		errs = append(errs, err)
+	}
+
+	if err := store.Insert(&Contact{Tenant: DefaultTenant, FirstName: "Veljko", LastName: "Ilic", Telephone: "+38163577442"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	saveErr := store.Insert(&Contact{Tenant: DefaultTenant, FirstName: "Marko", LastName: "Markovic", Telephone: "+38163587442"})
+
+	if len(errs) != 2 || errs[0] != nil || errs[1] == nil || errs[1].Error() != saveErr.Error() {
+		t.Errorf("want a successful and a failed save; got %v", errs)
+	}
+}
+
+// Testing that an import writes the file once, however many rows it stores
+func TestJSONFileStoreImportSavesOnce(t *testing.T) {
+	store, err := NewJSONFileStore(filepath.Join(t.TempDir(), "contacts.json"), DefaultBackups)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saves := 0
+	store.ObserveSave = func(duration time.Duration, err error) {
+		saves++
+	}
+
+	input := "first_name,last_name,telephone\n" +
+		"Veljko,Ilic,+38163577442\n" +
+		"Marko,Markovic,+38163587442\n" +
+		"Ana,Anic,+38163111222\n"
+
+	cm := NewModel(store)
+	summary, err := cm.ImportCSV(strings.NewReader(input), nil, ImportSkip, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Created != 3 {
+		t.Errorf("want 3 created rows; got %+v", summary)
+	}
+	if saves != 1 {
+		t.Errorf("want 1 save; got %d", saves)
+	}
+}
+
+// Testing that files written before contacts had versions and details still load
+func TestJSONFileStoreLoadsOldFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "contacts.json")
+
+	old := `[{"id":1,"first_name":"Veljko","last_name":"Ilic","telephone":"+38163577442"}]` + "\n"
+	if err := os.WriteFile(path, []byte(old), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := NewJSONFileStore(path, DefaultBackups)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := store.Get(DefaultTenant, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &Contact{ID: 1, Tenant: DefaultTenant, FirstName: "Veljko", LastName: "Ilic", Telephone: "+38163577442", Version: 1}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %+v; got %+v", want, got)
+	}
+}
+
+// Testing that tokens are saved in a file of their own, so logging in leaves the contacts file and its backups alone
+func TestJSONFileStoreKeepsTokensApart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "contacts.json")
+
+	store, err := NewJSONFileStore(path, DefaultBackups)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saves := 0
+	store.ObserveSave = func(duration time.Duration, err error) {
+		saves++
+	}
+
+	user := &User{Name: "Ana Anic", Email: "ana@example.com", Tenant: DefaultTenant}
+	if err := store.InsertUser(user); err != nil {
+		t.Fatal(err)
+	}
+	token := &Token{Hash: []byte("hash"), UserID: user.ID, Expiry: time.Now().Add(time.Hour), Scope: TokenAuthentication}
+	if err := store.InsertToken(token); err != nil {
+		t.Fatal(err)
+	}
+
+	if saves != 1 {
+		t.Errorf("want only the user saved to the contacts file; got %d saves", saves)
+	}
+	if _, err := os.Stat(path + ".bak.1"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("want no backup generation; got %v", err)
+	}
+	if js, err := os.ReadFile(path); err != nil || strings.Contains(string(js), "tokens") {
+		t.Errorf("want no tokens in the contacts file; got %q, %v", js, err)
+	}
+
+	reopened, err := NewJSONFileStore(path, DefaultBackups)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := reopened.GetUserForToken(TokenAuthentication, token.Hash, time.Now()); err != nil || got.ID != user.ID {
+		t.Errorf("want user %d; got %+v, %v", user.ID, got, err)
+	}
+
+	// a contacts file written while the tokens were kept in it
+	if err := os.Remove(path + ".tokens"); err != nil {
+		t.Fatal(err)
+	}
+	old := fmt.Sprintf(`{"contacts": [], "users": [{"id": %d, "email": "ana@example.com", "activated": true}],
+		"tokens": [{"hash": "aGFzaA==", "user_id": %d, "expiry": %q, "scope": %q}]}`,
+		user.ID, user.ID, token.Expiry.Format(time.RFC3339), TokenAuthentication)
+	if err := os.WriteFile(path, []byte(old), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	migrated, err := NewJSONFileStore(path, DefaultBackups)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path + ".tokens"); err != nil {
+		t.Errorf("want the tokens moved to their own file; got %v", err)
+	}
+	if got, err := migrated.GetUserForToken(TokenAuthentication, token.Hash, time.Now()); err != nil || got.ID != user.ID {
+		t.Errorf("want user %d; got %+v, %v", user.ID, got, err)
+	}
+}
+
+// Testing that groups and their members are saved in the same file as the contacts
+func TestJSONFileStorePersistsGroups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "contacts.json")
+
+	store, err := NewJSONFileStore(path, DefaultBackups)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contact := &Contact{Tenant: DefaultTenant, FirstName: "Veljko", LastName: "Ilic", Telephone: "+38163577442"}
+	if err := store.Insert(contact); err != nil {
+		t.Fatal(err)
+	}
+	group := &Group{Tenant: DefaultTenant, Name: "Suppliers"}
+	if err := store.InsertGroup(group); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddGroupMembers(DefaultTenant, group.ID, []int64{contact.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := NewJSONFileStore(path, DefaultBackups)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := reopened.GetGroup(DefaultTenant, group.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &Group{ID: 1, Tenant: DefaultTenant, Name: "Suppliers", ContactIDs: []int64{1}, Version: 2}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %+v; got %+v", want, got)
+	}
+}
@@ -0,0 +1,238 @@
+package data
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"salestrekker_technical_interview.veljkoilic/internal/validator"
+	"slices"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInvalidAPIKey = errors.New("invalid api key")
+)
+
+// Every API key starts with the prefix, so keys are easy to recognise in configs and logs
+const APIKeyPrefix = "ck_"
+
+const maxKeyNameLength = 100
+
+// APIKey is a key a client authenticates with. Only the SHA-256 hash of the key itself is kept,
+// the key is shown once, when it is minted. ID identifies the key when listing and revoking keys.
+// The permissions of a key are called its scopes in the keys file. Requests sent with the key go to
+// the contacts of its tenant.
+type APIKey struct {
+	ID          string      `json:"id"`
+	Name        string      `json:"name"`
+	Hash        string      `json:"hash"`
+	Tenant      string      `json:"tenant"`
+	Permissions Permissions `json:"scopes"`
+	CreatedAt   time.Time   `json:"created_at"`
+}
+
+func ValidateAPIKey(v *validator.Validator, key *APIKey) {
+	v.Check(key.Name != "", "name", "must be provided")
+	v.Check(validator.MaxChars(key.Name, maxKeyNameLength), "name", fmt.Sprintf("must not be more than %d characters long", maxKeyNameLength))
+	ValidateTenant(v, "tenant", key.Tenant)
+
+	v.Check(len(key.Permissions) > 0, "scopes", "must contain at least one permission")
+	ValidatePermissions(v, "scopes", key.Permissions)
+}
+
+// Return the hex encoded SHA-256 hash a key is stored as. Keys are random and long,
+// so a fast hash is enough to keep them from being read back from the keys file.
+func hashAPIKey(plaintext string) string {
+	hash := sha256.Sum256([]byte(plaintext))
+	return hex.EncodeToString(hash[:])
+}
+
+// KeyFile keeps the API keys in a JSON file of their own, apart from the contacts, so keys can be
+// minted and revoked from the command line while the server runs. The server notices the file
+// changed the next time it authenticates a request and loads it again.
+type KeyFile struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+	// keys by their hash
+	keys map[string]APIKey
+}
+
+func NewKeyFile(path string) *KeyFile {
+	return &KeyFile{path: path, keys: map[string]APIKey{}}
+}
+
+// Return the key with the given plaintext, or ErrInvalidAPIKey
+func (f *KeyFile) Authenticate(plaintext string) (*APIKey, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	err := f.reload()
+	if err != nil {
+		return nil, err
+	}
+
+	key, ok := f.keys[hashAPIKey(plaintext)]
+	if !ok {
+		return nil, ErrInvalidAPIKey
+	}
+	return &key, nil
+}
+
+// Load the file again if it changed since it was last loaded. A missing file holds no keys.
+func (f *KeyFile) reload() error {
+	info, err := os.Stat(f.path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		f.keys, f.modTime, f.size = map[string]APIKey{}, time.Time{}, 0
+		return nil
+	case err != nil:
+		return err
+	case info.ModTime().Equal(f.modTime) && info.Size() == f.size:
+		return nil
+	}
+
+	keys, err := f.read()
+	if err != nil {
+		return err
+	}
+
+	f.keys = make(map[string]APIKey, len(keys))
+	for _, key := range keys {
+		f.keys[key.Hash] = key
+	}
+	f.modTime, f.size = info.ModTime(), info.Size()
+	return nil
+}
+
+// Read every key in the file, ordered as they were minted
+func (f *KeyFile) read() ([]APIKey, error) {
+	js, err := os.ReadFile(f.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return []APIKey{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	keys := []APIKey{}
+	if len(js) > 0 {
+		err = json.Unmarshal(js, &keys)
+		if err != nil {
+			return nil, fmt.Errorf("loading %s: %w", f.path, err)
+		}
+	}
+
+	// keys minted before there were tenants go to the default tenant
+	for i := range keys {
+		if keys[i].Tenant == "" {
+			keys[i].Tenant = DefaultTenant
+		}
+	}
+	return keys, nil
+}
+
+// Replace the file with one holding the keys. The file is only readable by its owner.
+func (f *KeyFile) write(keys []APIKey) error {
+	dir, name := filepath.Split(f.path)
+	if dir == "" {
+		dir = "."
+	}
+
+	tmp, err := os.CreateTemp(dir, name+".tmp*")
+	if err != nil {
+		return fmt.Errorf("saving keys: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	err = tmp.Chmod(0600)
+	if err == nil {
+		enc := json.NewEncoder(tmp)
+		enc.SetIndent("", "\t")
+		err = enc.Encode(keys)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("saving keys: %w", err)
+	}
+
+	err = os.Rename(tmp.Name(), f.path)
+	if err != nil {
+		return fmt.Errorf("saving keys: %w", err)
+	}
+	return nil
+}
+
+// Return every key, ordered as they were minted
+func (f *KeyFile) List() ([]APIKey, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.read()
+}
+
+// Mint a new key with the name and permissions set in key, and store it. The plaintext key is returned,
+// it can not be recovered later.
+func (f *KeyFile) Mint(key *APIKey) (string, error) {
+	secret := make([]byte, 20)
+	id := make([]byte, 4)
+	_, err := rand.Read(secret)
+	if err == nil {
+		_, err = rand.Read(id)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	plaintext := APIKeyPrefix + base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(secret)
+	key.ID = hex.EncodeToString(id)
+	key.Hash = hashAPIKey(plaintext)
+	key.CreatedAt = time.Now().UTC().Truncate(time.Second)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	keys, err := f.read()
+	if err != nil {
+		return "", err
+	}
+
+	err = f.write(append(keys, *key))
+	if err != nil {
+		return "", err
+	}
+	return plaintext, nil
+}
+
+// Remove the key with the given id, so it can no longer be used. ErrRecordNotFound is returned
+// when there is no such key.
+func (f *KeyFile) Revoke(id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	keys, err := f.read()
+	if err != nil {
+		return err
+	}
+
+	i := slices.IndexFunc(keys, func(key APIKey) bool { return key.ID == id })
+	if i == -1 {
+		return ErrRecordNotFound
+	}
+
+	return f.write(slices.Delete(keys, i, i+1))
+}
@@ -0,0 +1,97 @@
+package data
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"salestrekker_technical_interview.veljkoilic/internal/validator"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateAPIKey(t *testing.T) {
+	testCases := []struct {
+		name     string
+		key      APIKey
+		expected []string
+	}{
+		{"valid", APIKey{Name: "ci", Tenant: DefaultTenant, Permissions: Permissions{PermissionContactsRead, PermissionContactsWrite}}, nil},
+		{"no name", APIKey{Tenant: DefaultTenant, Permissions: Permissions{PermissionAdmin}}, []string{"name"}},
+		{"no permissions", APIKey{Name: "ci", Tenant: DefaultTenant}, []string{"scopes"}},
+		{"unknown permission", APIKey{Name: "ci", Tenant: DefaultTenant, Permissions: Permissions{"contacts:purge"}}, []string{"scopes"}},
+		{"duplicate permission", APIKey{Name: "ci", Tenant: DefaultTenant, Permissions: Permissions{PermissionAdmin, PermissionAdmin}}, []string{"scopes"}},
+		{"no tenant", APIKey{Name: "ci", Permissions: Permissions{PermissionAdmin}}, []string{"tenant"}},
+		{"bad tenant", APIKey{Name: "ci", Tenant: "Sales Team", Permissions: Permissions{PermissionAdmin}}, []string{"tenant"}},
+	}
+
+	for _, tc := range testCases {
+		v := validator.New()
+		ValidateAPIKey(v, &tc.key)
+
+		if len(v.Errors) != len(tc.expected) {
+			t.Errorf("%s: want errors for %v; got %v", tc.name, tc.expected, v.Errors)
+		}
+		for _, key := range tc.expected {
+			if _, ok := v.Errors[key]; !ok {
+				t.Errorf("%s: want an error for %s; got %v", tc.name, key, v.Errors)
+			}
+		}
+	}
+}
+
+// Testing minting, authenticating and revoking keys, and that a running server
+// notices keys changed in the file by another process
+func TestKeyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	server := NewKeyFile(path)
+
+	if _, err := server.Authenticate(APIKeyPrefix + "missing"); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Fatalf("want %v without a keys file; got %v", ErrInvalidAPIKey, err)
+	}
+
+	cli := NewKeyFile(path)
+	key := &APIKey{Name: "ci", Permissions: Permissions{PermissionContactsRead}}
+	plaintext, err := cli.Mint(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(plaintext, APIKeyPrefix) || key.ID == "" {
+		t.Errorf("want a key starting with %s and an id; got %q, %q", APIKeyPrefix, plaintext, key.ID)
+	}
+
+	js, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(js), plaintext) {
+		t.Errorf("want only the hash of the key stored; got %s", js)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("want the keys file readable by its owner only; got %v, %v", info.Mode(), err)
+	}
+
+	got, err := server.Authenticate(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != key.ID || got.Name != "ci" {
+		t.Errorf("want key %s; got %+v", key.ID, got)
+	}
+	if _, err := server.Authenticate(plaintext + "x"); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("want %v; got %v", ErrInvalidAPIKey, err)
+	}
+
+	// make sure the revoked file has a different modification time on filesystems with a coarse clock
+	time.Sleep(10 * time.Millisecond)
+
+	if err := cli.Revoke(key.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.Revoke(key.ID); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("want %v; got %v", ErrRecordNotFound, err)
+	}
+	if _, err := server.Authenticate(plaintext); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("want the revoked key refused; got %v", err)
+	}
+}
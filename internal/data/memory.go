@@ -0,0 +1,651 @@
+package data
+
+import (
+	"bytes"
+	"cmp"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps contacts, groups, the custom field schema and the users in slices and never persists them.
+// It is mostly useful for tests and for running the API without touching the disk.
+// It is safe for concurrent use, reads return copies of the stored contacts and groups.
+//
+// Stored values are never modified in place, changes replace them with new copies.
+// This lets JSONFileStore take cheap snapshots it can roll back to.
+type MemoryStore struct {
+	mu       sync.RWMutex
+	contacts []Contact
+	groups   []Group
+	fields   []Field
+	users    []User
+	tokens   []Token
+	// one past the highest contact id handed out in every tenant, so ids of deleted contacts are not taken again
+	nextIDs map[string]int64
+	// the same for the group ids, which are unique across the tenants
+	nextGroupID int64
+}
+
+// Returns a new MemoryStore holding a copy of the contacts passed in, without any groups or custom fields.
+// Contacts without a tenant are put in DefaultTenant.
+func NewMemoryStore(contacts []Contact) *MemoryStore {
+	store := &MemoryStore{contacts: []Contact{}, groups: []Group{}, fields: []Field{}, users: []User{}, tokens: []Token{}, nextIDs: map[string]int64{}}
+	for i := range contacts {
+		store.contacts = append(store.contacts, contacts[i].clone())
+	}
+	setMissingVersions(store.contacts)
+	setMissingTenants(store.contacts)
+	return store
+}
+
+func (s *MemoryStore) Get(tenant string, id int64) (*Contact, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	index := s.contactIndex(tenant, id)
+	if index == -1 {
+		return nil, ErrRecordNotFound
+	}
+
+	contact := s.contacts[index].clone()
+	return &contact, nil
+}
+
+func (s *MemoryStore) List(tenant string) ([]Contact, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	contacts := []Contact{}
+	for i := range s.contacts {
+		if s.contacts[i].Tenant == tenant {
+			contacts = append(contacts, s.contacts[i].clone())
+		}
+	}
+	slices.SortFunc(contacts, func(a, b Contact) int { return cmp.Compare(a.ID, b.ID) })
+	return contacts, nil
+}
+
+func (s *MemoryStore) Count() (map[string]int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts := map[string]int{}
+	for i := range s.contacts {
+		counts[s.contacts[i].Tenant]++
+	}
+	return counts, nil
+}
+
+func (s *MemoryStore) Insert(contact *Contact) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.insert(contact)
+}
+
+func (s *MemoryStore) Update(contact *Contact) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.update(contact)
+}
+
+func (s *MemoryStore) SaveContacts(contacts []*Contact) ([]error, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	errs, _ := s.saveContacts(contacts)
+	return errs, nil
+}
+
+func (s *MemoryStore) Delete(tenant string, id int64, version int32) (*Contact, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.delete(tenant, id, version)
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+func (s *MemoryStore) GetGroup(tenant string, id int64) (*Group, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	index := s.groupIndex(tenant, id)
+	if index == -1 {
+		return nil, ErrRecordNotFound
+	}
+
+	group := s.groups[index].clone()
+	return &group, nil
+}
+
+func (s *MemoryStore) ListGroups(tenant string) ([]Group, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	groups := []Group{}
+	for i := range s.groups {
+		if s.groups[i].Tenant == tenant {
+			groups = append(groups, s.groups[i].clone())
+		}
+	}
+	return groups, nil
+}
+
+func (s *MemoryStore) InsertGroup(group *Group) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.insertGroup(group)
+}
+
+func (s *MemoryStore) UpdateGroup(group *Group) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.updateGroup(group)
+}
+
+func (s *MemoryStore) DeleteGroup(tenant string, id int64, version int32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.deleteGroup(tenant, id, version)
+}
+
+func (s *MemoryStore) AddGroupMembers(tenant string, groupID int64, contactIDs []int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.addGroupMembers(tenant, groupID, contactIDs)
+	return err
+}
+
+func (s *MemoryStore) RemoveGroupMember(tenant string, groupID, contactID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.removeGroupMember(tenant, groupID, contactID)
+}
+
+func (s *MemoryStore) GetField(name string) (*Field, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	index := s.fieldIndex(name)
+	if index == -1 {
+		return nil, ErrRecordNotFound
+	}
+
+	field := s.fields[index].clone()
+	return &field, nil
+}
+
+func (s *MemoryStore) ListFields() ([]Field, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	fields := make([]Field, len(s.fields))
+	for i := range s.fields {
+		fields[i] = s.fields[i].clone()
+	}
+	return fields, nil
+}
+
+func (s *MemoryStore) InsertField(field *Field) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.insertField(field)
+}
+
+func (s *MemoryStore) UpdateField(field *Field) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.updateField(field)
+}
+
+func (s *MemoryStore) DeleteField(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.deleteField(name)
+}
+
+func (s *MemoryStore) InsertUser(user *User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.insertUser(user)
+}
+
+func (s *MemoryStore) GetUser(id int64) (*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	index := s.userIndex(id)
+	if index == -1 {
+		return nil, ErrRecordNotFound
+	}
+
+	user := s.users[index].clone()
+	return &user, nil
+}
+
+func (s *MemoryStore) GetUserByEmail(email string) (*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	index := slices.IndexFunc(s.users, func(u User) bool {
+		return u.Email == email
+	})
+	if index == -1 {
+		return nil, ErrRecordNotFound
+	}
+
+	user := s.users[index].clone()
+	return &user, nil
+}
+
+func (s *MemoryStore) ListUsers() ([]User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := make([]User, len(s.users))
+	for i := range s.users {
+		users[i] = s.users[i].clone()
+	}
+	return users, nil
+}
+
+func (s *MemoryStore) UpdateUser(user *User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.updateUser(user)
+}
+
+func (s *MemoryStore) InsertToken(token *Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.insertToken(token)
+	return nil
+}
+
+func (s *MemoryStore) GetUserForToken(scope string, hash []byte, now time.Time) (*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, token := range s.tokens {
+		if token.Scope != scope || !bytes.Equal(token.Hash, hash) || !token.Expiry.After(now) {
+			continue
+		}
+
+		index := s.userIndex(token.UserID)
+		if index == -1 {
+			break
+		}
+		user := s.users[index].clone()
+		return &user, nil
+	}
+
+	return nil, ErrRecordNotFound
+}
+
+func (s *MemoryStore) DeleteTokensForUser(scope string, userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deleteTokensForUser(scope, userID)
+	return nil
+}
+
+// The methods below expect the caller to hold the write lock
+
+// Index of the tenant's contact with the given id in s.contacts, or -1 if there is no such contact
+func (s *MemoryStore) contactIndex(tenant string, id int64) int {
+	return slices.IndexFunc(s.contacts, func(c Contact) bool {
+		return c.Tenant == tenant && c.ID == id
+	})
+}
+
+func (s *MemoryStore) insert(contact *Contact) error {
+	for _, existingContact := range s.contacts {
+		if existingContact.Tenant == contact.Tenant && (areContactsEqual(&existingContact, contact) || sameCardName(&existingContact, contact)) {
+			return ErrDuplicateContact
+		}
+	}
+
+	// Generate an id for the new contact and assign it to ID field of the contact. Contacts the store
+	// was created with count as handed out, so the id is past theirs as well.
+	contact.ID = max(s.nextIDs[contact.Tenant], generateID(s.contacts, contact.Tenant))
+	nextIDs := maps.Clone(s.nextIDs)
+	nextIDs[contact.Tenant] = contact.ID + 1
+	s.nextIDs = nextIDs
+	contact.Version = 1
+	s.contacts = append(s.contacts, contact.clone())
+	return nil
+}
+
+func (s *MemoryStore) update(contact *Contact) error {
+	index := -1
+	for ind, existingContact := range s.contacts {
+		if existingContact.Tenant != contact.Tenant {
+			continue
+		}
+		if existingContact.ID == contact.ID {
+			index = ind
+			continue
+		}
+		if areContactsEqual(&existingContact, contact) || sameCardName(&existingContact, contact) {
+			return ErrDuplicateContact
+		}
+	}
+
+	if index == -1 {
+		return ErrRecordNotFound
+	}
+
+	if s.contacts[index].Version != contact.Version {
+		return ErrEditConflict
+	}
+
+	contact.Version++
+	s.contacts[index] = contact.clone()
+	return nil
+}
+
+// Insert or update every contact, and report whether any of them was stored
+func (s *MemoryStore) saveContacts(contacts []*Contact) ([]error, bool) {
+	errs := make([]error, len(contacts))
+	changed := false
+	for i, contact := range contacts {
+		if contact.ID == 0 {
+			errs[i] = s.insert(contact)
+		} else {
+			errs[i] = s.update(contact)
+		}
+		changed = changed || errs[i] == nil
+	}
+	return errs, changed
+}
+
+// Report whether both contacts have the same card name. The name of every card has to be unique.
+func sameCardName(a, b *Contact) bool {
+	return a.CardName != "" && a.CardName == b.CardName
+}
+
+func (s *MemoryStore) delete(tenant string, id int64, version int32) (*Contact, error) {
+	index := s.contactIndex(tenant, id)
+	if index == -1 {
+		return nil, ErrRecordNotFound
+	}
+
+	if version != AnyVersion && s.contacts[index].Version != version {
+		return nil, ErrEditConflict
+	}
+
+	deleted := s.contacts[index].clone()
+	s.contacts = slices.Concat(s.contacts[:index], s.contacts[index+1:])
+
+	// the contact is gone, so it can not stay a member of any of the tenant's groups
+	for i := range s.groups {
+		if s.groups[i].Tenant == tenant && s.groups[i].hasMember(id) {
+			s.groups[i] = s.groups[i].withoutMember(id)
+		}
+	}
+	return &deleted, nil
+}
+
+// Index of the tenant's group with the given id in s.groups, or -1 if there is no such group
+func (s *MemoryStore) groupIndex(tenant string, id int64) int {
+	return slices.IndexFunc(s.groups, func(g Group) bool {
+		return g.Tenant == tenant && g.ID == id
+	})
+}
+
+func (s *MemoryStore) insertGroup(group *Group) error {
+	for _, existing := range s.groups {
+		if existing.Tenant == group.Tenant && existing.Name == group.Name {
+			return ErrDuplicateGroup
+		}
+	}
+
+	group.ID = max(s.nextGroupID, generateGroupID(s.groups))
+	s.nextGroupID = group.ID + 1
+	group.ContactIDs = []int64{}
+	group.Version = 1
+	s.groups = append(s.groups, group.clone())
+	return nil
+}
+
+func (s *MemoryStore) updateGroup(group *Group) error {
+	index := -1
+	for i, existing := range s.groups {
+		if existing.Tenant != group.Tenant {
+			continue
+		}
+		if existing.ID == group.ID {
+			index = i
+			continue
+		}
+		if existing.Name == group.Name {
+			return ErrDuplicateGroup
+		}
+	}
+
+	if index == -1 {
+		return ErrRecordNotFound
+	}
+
+	if s.groups[index].Version != group.Version {
+		return ErrEditConflict
+	}
+
+	group.ContactIDs = slices.Clone(s.groups[index].ContactIDs)
+	group.Version++
+	s.groups[index] = group.clone()
+	return nil
+}
+
+func (s *MemoryStore) deleteGroup(tenant string, id int64, version int32) error {
+	index := s.groupIndex(tenant, id)
+	if index == -1 {
+		return ErrRecordNotFound
+	}
+
+	if version != AnyVersion && s.groups[index].Version != version {
+		return ErrEditConflict
+	}
+
+	s.groups = slices.Concat(s.groups[:index], s.groups[index+1:])
+	return nil
+}
+
+// Add the contacts to the group, reporting whether the group has changed. Nothing is added unless
+// the group and all the contacts exist.
+func (s *MemoryStore) addGroupMembers(tenant string, groupID int64, contactIDs []int64) (bool, error) {
+	index := s.groupIndex(tenant, groupID)
+	if index == -1 {
+		return false, ErrRecordNotFound
+	}
+
+	for _, contactID := range contactIDs {
+		if s.contactIndex(tenant, contactID) == -1 {
+			return false, ErrRecordNotFound
+		}
+	}
+
+	group := s.groups[index].clone()
+	for _, contactID := range contactIDs {
+		position, found := slices.BinarySearch(group.ContactIDs, contactID)
+		if !found {
+			group.ContactIDs = slices.Insert(group.ContactIDs, position, contactID)
+		}
+	}
+
+	if len(group.ContactIDs) == len(s.groups[index].ContactIDs) {
+		return false, nil
+	}
+
+	group.Version++
+	s.groups[index] = group
+	return true, nil
+}
+
+func (s *MemoryStore) removeGroupMember(tenant string, groupID, contactID int64) error {
+	index := s.groupIndex(tenant, groupID)
+	if index == -1 || !s.groups[index].hasMember(contactID) {
+		return ErrRecordNotFound
+	}
+
+	s.groups[index] = s.groups[index].withoutMember(contactID)
+	return nil
+}
+
+// Index of the field with the given name in s.fields, or -1 if there is no such field
+func (s *MemoryStore) fieldIndex(name string) int {
+	return slices.IndexFunc(s.fields, func(f Field) bool {
+		return f.Name == name
+	})
+}
+
+func (s *MemoryStore) insertField(field *Field) error {
+	if s.fieldIndex(field.Name) != -1 {
+		return ErrDuplicateField
+	}
+
+	if invalidated := s.countInvalidated(nil, field); invalidated > 0 {
+		return &FieldInUseError{Contacts: invalidated}
+	}
+
+	field.Version = 1
+	s.fields = append(s.fields, field.clone())
+	return nil
+}
+
+func (s *MemoryStore) updateField(field *Field) error {
+	index := s.fieldIndex(field.Name)
+	if index == -1 {
+		return ErrRecordNotFound
+	}
+
+	if s.fields[index].Version != field.Version {
+		return ErrEditConflict
+	}
+
+	if invalidated := s.countInvalidated(&s.fields[index], field); invalidated > 0 {
+		return &FieldInUseError{Contacts: invalidated}
+	}
+
+	field.Version++
+	s.fields[index] = field.clone()
+	return nil
+}
+
+// Number of the stored contacts, of every tenant, whose value the change of the field from previous invalidates
+func (s *MemoryStore) countInvalidated(previous, field *Field) int {
+	invalidated := 0
+	for i := range s.contacts {
+		if invalidates(&s.contacts[i], previous, field) {
+			invalidated++
+		}
+	}
+	return invalidated
+}
+
+func (s *MemoryStore) deleteField(name string) error {
+	index := s.fieldIndex(name)
+	if index == -1 {
+		return ErrRecordNotFound
+	}
+
+	s.fields = slices.Concat(s.fields[:index], s.fields[index+1:])
+
+	// the values of the field go away with it
+	for i := range s.contacts {
+		if _, ok := s.contacts[i].Custom[name]; ok {
+			contact := s.contacts[i].clone()
+			delete(contact.Custom, name)
+			if len(contact.Custom) == 0 {
+				contact.Custom = nil
+			}
+			contact.Version++
+			s.contacts[i] = contact
+		}
+	}
+	return nil
+}
+
+// Index of the user with the given id in s.users, or -1 if there is no such user
+func (s *MemoryStore) userIndex(id int64) int {
+	return slices.IndexFunc(s.users, func(u User) bool {
+		return u.ID == id
+	})
+}
+
+func (s *MemoryStore) insertUser(user *User) error {
+	for _, existing := range s.users {
+		if existing.Email == user.Email {
+			return ErrDuplicateEmail
+		}
+	}
+
+	user.ID = 1
+	for _, existing := range s.users {
+		user.ID = max(user.ID, existing.ID+1)
+	}
+	user.Version = 1
+
+	// the plaintext password is not stored
+	s.users = append(s.users, user.clone())
+	return nil
+}
+
+func (s *MemoryStore) updateUser(user *User) error {
+	index := -1
+	for i, existing := range s.users {
+		if existing.ID == user.ID {
+			index = i
+		} else if existing.Email == user.Email {
+			return ErrDuplicateEmail
+		}
+	}
+
+	if index == -1 {
+		return ErrRecordNotFound
+	}
+
+	if s.users[index].Version != user.Version {
+		return ErrEditConflict
+	}
+
+	user.Version++
+	s.users[index] = user.clone()
+	return nil
+}
+
+// Store the token, dropping the tokens which have expired
+func (s *MemoryStore) insertToken(token *Token) {
+	now := time.Now()
+	s.tokens = slices.DeleteFunc(slices.Clone(s.tokens), func(t Token) bool {
+		return !t.Expiry.After(now)
+	})
+
+	stored := *token
+	stored.Plaintext = ""
+	s.tokens = append(s.tokens, stored)
+}
+
+func (s *MemoryStore) deleteTokensForUser(scope string, userID int64) {
+	s.tokens = slices.DeleteFunc(slices.Clone(s.tokens), func(t Token) bool {
+		return t.Scope == scope && t.UserID == userID
+	})
+}
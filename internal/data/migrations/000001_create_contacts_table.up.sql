@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS contacts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    first_name TEXT NOT NULL,
+    last_name TEXT NOT NULL,
+    telephone TEXT NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS contacts_identity_idx ON contacts (first_name, last_name, telephone);
@@ -0,0 +1,8 @@
+-- Labelled telephones, emails and addresses are kept as JSON arrays
+ALTER TABLE contacts ADD COLUMN telephones TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE contacts ADD COLUMN emails TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE contacts ADD COLUMN addresses TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE contacts ADD COLUMN company TEXT NOT NULL DEFAULT '';
+ALTER TABLE contacts ADD COLUMN job_title TEXT NOT NULL DEFAULT '';
+ALTER TABLE contacts ADD COLUMN birthday TEXT;
+ALTER TABLE contacts ADD COLUMN notes TEXT NOT NULL DEFAULT '';
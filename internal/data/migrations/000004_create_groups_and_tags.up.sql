@@ -0,0 +1,20 @@
+-- Free-form tags are kept as a JSON array, like the other lists of a contact
+ALTER TABLE contacts ADD COLUMN tags TEXT NOT NULL DEFAULT '[]';
+
+CREATE TABLE contact_groups (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    version INTEGER NOT NULL DEFAULT 1
+);
+
+CREATE UNIQUE INDEX contact_groups_name_idx ON contact_groups (name);
+
+-- Rows are removed by the store together with the group or the contact they point to
+CREATE TABLE group_members (
+    group_id INTEGER NOT NULL,
+    contact_id INTEGER NOT NULL,
+    PRIMARY KEY (group_id, contact_id)
+);
+
+CREATE INDEX group_members_contact_idx ON group_members (contact_id);
@@ -0,0 +1,10 @@
+-- Custom values are kept as a JSON object keyed by the field name
+ALTER TABLE contacts ADD COLUMN custom TEXT NOT NULL DEFAULT '{}';
+
+CREATE TABLE custom_fields (
+    name TEXT PRIMARY KEY,
+    type TEXT NOT NULL,
+    required INTEGER NOT NULL DEFAULT 0,
+    enum_values TEXT NOT NULL DEFAULT '[]',
+    version INTEGER NOT NULL DEFAULT 1
+);
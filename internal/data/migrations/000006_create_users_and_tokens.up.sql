@@ -0,0 +1,22 @@
+-- Times are kept as Unix seconds
+CREATE TABLE users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    email TEXT NOT NULL,
+    password_hash BLOB NOT NULL,
+    activated INTEGER NOT NULL DEFAULT 0,
+    version INTEGER NOT NULL DEFAULT 1
+);
+
+CREATE UNIQUE INDEX users_email_idx ON users (email);
+
+-- Only the SHA-256 hash of a token is stored. Rows are removed by the store once they expire.
+CREATE TABLE tokens (
+    hash BLOB PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    expiry INTEGER NOT NULL,
+    scope TEXT NOT NULL
+);
+
+CREATE INDEX tokens_user_idx ON tokens (user_id);
@@ -0,0 +1,5 @@
+-- Permissions are kept as a JSON array of permission codes. Users registered before
+-- there were permissions get the viewer role, the one new users start with.
+ALTER TABLE users ADD COLUMN permissions TEXT NOT NULL DEFAULT '[]';
+
+UPDATE users SET permissions = '["contacts:read"]';
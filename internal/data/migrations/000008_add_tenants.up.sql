@@ -0,0 +1,39 @@
+-- Contacts are numbered per tenant, so the table is rebuilt with the tenant in its primary key.
+-- Everything stored before there were tenants belongs to the default tenant.
+CREATE TABLE tenant_contacts (
+    tenant TEXT NOT NULL,
+    id INTEGER NOT NULL,
+    first_name TEXT NOT NULL,
+    last_name TEXT NOT NULL,
+    telephone TEXT NOT NULL,
+    version INTEGER NOT NULL DEFAULT 1,
+    telephones TEXT NOT NULL DEFAULT '[]',
+    emails TEXT NOT NULL DEFAULT '[]',
+    addresses TEXT NOT NULL DEFAULT '[]',
+    company TEXT NOT NULL DEFAULT '',
+    job_title TEXT NOT NULL DEFAULT '',
+    birthday TEXT,
+    notes TEXT NOT NULL DEFAULT '',
+    tags TEXT NOT NULL DEFAULT '[]',
+    custom TEXT NOT NULL DEFAULT '{}',
+    PRIMARY KEY (tenant, id)
+);
+
+INSERT INTO tenant_contacts (tenant, id, first_name, last_name, telephone, version, telephones, emails, addresses,
+    company, job_title, birthday, notes, tags, custom)
+SELECT 'default', id, first_name, last_name, telephone, version, telephones, emails, addresses,
+    company, job_title, birthday, notes, tags, custom
+FROM contacts;
+
+DROP TABLE contacts;
+ALTER TABLE tenant_contacts RENAME TO contacts;
+
+CREATE UNIQUE INDEX contacts_identity_idx ON contacts (tenant, first_name, last_name, telephone);
+
+-- Group ids stay unique across the tenants, the names only within a tenant
+ALTER TABLE contact_groups ADD COLUMN tenant TEXT NOT NULL DEFAULT 'default';
+
+DROP INDEX contact_groups_name_idx;
+CREATE UNIQUE INDEX contact_groups_name_idx ON contact_groups (tenant, name);
+
+ALTER TABLE users ADD COLUMN tenant TEXT NOT NULL DEFAULT 'default';
@@ -0,0 +1,5 @@
+-- Cards created over CardDAV keep the name the client gave them, which is unique within the tenant.
+-- Contacts without one are served under their id.
+ALTER TABLE contacts ADD COLUMN card_name TEXT NOT NULL DEFAULT '';
+
+CREATE UNIQUE INDEX contacts_card_name_idx ON contacts (tenant, card_name) WHERE card_name <> '';
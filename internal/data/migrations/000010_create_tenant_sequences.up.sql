@@ -0,0 +1,9 @@
+-- The next contact id of every tenant. Ids are never handed out twice, even after the contact
+-- holding the highest one was deleted, so a stale ETag or CardDAV href can not reach another contact.
+CREATE TABLE tenant_sequences (
+    tenant TEXT PRIMARY KEY,
+    next_id INTEGER NOT NULL
+);
+
+INSERT INTO tenant_sequences (tenant, next_id)
+SELECT tenant, MAX(id) + 1 FROM contacts GROUP BY tenant;
@@ -0,0 +1,84 @@
+package data
+
+import (
+	"fmt"
+	"salestrekker_technical_interview.veljkoilic/internal/validator"
+	"slices"
+)
+
+// Permission codes users and API keys are given. admin includes the contacts permissions and allows
+// managing the users of the admin's own tenant. superuser includes every other permission and is the only
+// one which reaches across the tenants: the contacts of other tenants, every user, moving users between
+// tenants and the custom field schema, which all tenants share.
+// metrics:read only allows scraping the metrics, for the monitoring system's key.
+const (
+	PermissionContactsRead   = "contacts:read"
+	PermissionContactsWrite  = "contacts:write"
+	PermissionContactsDelete = "contacts:delete"
+	PermissionContactsExport = "contacts:export"
+	PermissionMetricsRead    = "metrics:read"
+	PermissionAdmin          = "admin"
+	PermissionSuperuser      = "superuser"
+)
+
+var PermissionCodes = []string{
+	PermissionContactsRead,
+	PermissionContactsWrite,
+	PermissionContactsDelete,
+	PermissionContactsExport,
+	PermissionMetricsRead,
+	PermissionAdmin,
+	PermissionSuperuser,
+}
+
+// Permissions are the permission codes a user or an API key was given
+type Permissions []string
+
+// The permissions admin includes. The metrics count the contacts of every tenant, so they are not among them.
+var adminPermissions = []string{PermissionContactsRead, PermissionContactsWrite, PermissionContactsDelete, PermissionContactsExport}
+
+// Report whether the permissions include the code, directly or through admin or superuser
+func (p Permissions) Include(code string) bool {
+	switch {
+	case slices.Contains(p, code), slices.Contains(p, PermissionSuperuser):
+		return true
+	case slices.Contains(p, PermissionAdmin):
+		return slices.Contains(adminPermissions, code)
+	}
+	return false
+}
+
+// Role is a named set of permissions, to give someone the permissions their job needs in one go
+type Role struct {
+	Name        string      `json:"name"`
+	Permissions Permissions `json:"permissions"`
+}
+
+// The roles users and keys can be given. Registered users start as viewers.
+var Roles = []Role{
+	{Name: "viewer", Permissions: Permissions{PermissionContactsRead}},
+	{Name: "editor", Permissions: Permissions{PermissionContactsRead, PermissionContactsWrite, PermissionContactsExport}},
+	{Name: "manager", Permissions: Permissions{PermissionContactsRead, PermissionContactsWrite, PermissionContactsDelete, PermissionContactsExport}},
+	{Name: "monitoring", Permissions: Permissions{PermissionMetricsRead}},
+	{Name: "admin", Permissions: Permissions{PermissionAdmin}},
+	{Name: "superuser", Permissions: Permissions{PermissionSuperuser}},
+}
+
+const DefaultRole = "viewer"
+
+// Return the permissions of the role with the given name
+func RolePermissions(name string) (Permissions, bool) {
+	i := slices.IndexFunc(Roles, func(r Role) bool { return r.Name == name })
+	if i == -1 {
+		return nil, false
+	}
+	return slices.Clone(Roles[i].Permissions), true
+}
+
+// Check that the permissions are known codes, each listed once. key names the permissions in the errors.
+func ValidatePermissions(v *validator.Validator, key string, permissions Permissions) {
+	v.Check(validator.Unique(permissions), key, "must not contain duplicate values")
+	for _, code := range permissions {
+		v.Check(validator.PermittedValue(code, PermissionCodes...), key, fmt.Sprintf("%q is not a permission, must be one of %v", code, PermissionCodes))
+	}
+}
@@ -0,0 +1,56 @@
+package data
+
+import (
+	"salestrekker_technical_interview.veljkoilic/internal/validator"
+	"slices"
+	"testing"
+)
+
+func TestPermissionsInclude(t *testing.T) {
+	testCases := []struct {
+		name        string
+		permissions Permissions
+		code        string
+		expected    bool
+	}{
+		{"granted", Permissions{PermissionContactsRead}, PermissionContactsRead, true},
+		{"not granted", Permissions{PermissionContactsRead}, PermissionContactsDelete, false},
+		{"write does not delete", Permissions{PermissionContactsWrite}, PermissionContactsDelete, false},
+		{"admin", Permissions{PermissionAdmin}, PermissionContactsDelete, true},
+		{"admin is not a superuser", Permissions{PermissionAdmin}, PermissionSuperuser, false},
+		{"admin does not scrape the metrics", Permissions{PermissionAdmin}, PermissionMetricsRead, false},
+		{"superuser", Permissions{PermissionSuperuser}, PermissionAdmin, true},
+		{"superuser scrapes the metrics", Permissions{PermissionSuperuser}, PermissionMetricsRead, true},
+		{"none", nil, PermissionContactsRead, false},
+	}
+
+	for _, tc := range testCases {
+		if got := tc.permissions.Include(tc.code); got != tc.expected {
+			t.Errorf("%s: want %v; got %v", tc.name, tc.expected, got)
+		}
+	}
+}
+
+func TestRolePermissions(t *testing.T) {
+	viewer, ok := RolePermissions(DefaultRole)
+	if !ok || !slices.Equal(viewer, Permissions{PermissionContactsRead}) {
+		t.Errorf("want viewers to only read; got %v, %v", viewer, ok)
+	}
+
+	// the roles are handed out as copies
+	viewer[0] = PermissionAdmin
+	if again, _ := RolePermissions(DefaultRole); again[0] != PermissionContactsRead {
+		t.Errorf("want the role unchanged; got %v", again)
+	}
+
+	if _, ok := RolePermissions("intern"); ok {
+		t.Errorf("want an unknown role refused")
+	}
+
+	for _, role := range Roles {
+		v := validator.New()
+		if ValidatePermissions(v, "permissions", role.Permissions); !v.IsValid() {
+			t.Errorf("%s: want valid permissions; got %v", role.Name, v.Errors)
+		}
+	}
+}
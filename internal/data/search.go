@@ -0,0 +1,291 @@
+package data
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Serbian Cyrillic letters and Latin letters with diacritics, folded to plain ASCII Latin.
+// Both scripts fold to the same tokens, so "Јовановић", "Jovanović" and "Jovanovic" are equal.
+var foldReplacer = strings.NewReplacer(
+	"а", "a", "б", "b", "в", "v", "г", "g", "д", "d", "ђ", "dj", "е", "e", "ж", "z", "з", "z", "и", "i",
+	"ј", "j", "к", "k", "л", "l", "љ", "lj", "м", "m", "н", "n", "њ", "nj", "о", "o", "п", "p", "р", "r",
+	"с", "s", "т", "t", "ћ", "c", "у", "u", "ф", "f", "х", "h", "ц", "c", "ч", "c", "џ", "dz", "ш", "s",
+	"č", "c", "ć", "c", "š", "s", "ž", "z", "đ", "dj",
+)
+
+// Split text into lowercase ASCII search tokens
+func searchTokens(text string) []string {
+	folded := foldReplacer.Replace(strings.ToLower(text))
+
+	return strings.FieldsFunc(folded, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Tokens a contact can be found by. The telephone is indexed by its digits only,
+// so "+381 63 577-442" and "38163577442" are the same token.
+func contactTokens(contact *Contact) []string {
+	tokens := searchTokens(contact.FirstName + " " + contact.LastName)
+
+	digits := strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, contact.Telephone)
+	if digits != "" {
+		tokens = append(tokens, digits)
+	}
+
+	return tokens
+}
+
+// Trigrams of a token, padded so the start and the end of the token count as well
+func trigrams(token string) []string {
+	padded := []rune("$" + token + "$")
+	if len(padded) < 3 {
+		return nil
+	}
+
+	grams := make([]string, 0, len(padded)-2)
+	for i := 0; i+3 <= len(padded); i++ {
+		grams = append(grams, string(padded[i:i+3]))
+	}
+	return grams
+}
+
+// SearchResult is a contact found by a search, together with its relevance
+// between 0 and 1, 1 being an exact match of every query token
+type SearchResult struct {
+	Contact *Contact `json:"contact"`
+	Score   float64  `json:"score"`
+}
+
+// searchIndex is an inverted index from trigrams to contact ids. It is kept up to date by ContactsModel
+// and built from the store the first time it is searched. Only the tokens are indexed, the contacts
+// found are read from the store, so the results are never older than the stored contacts.
+type searchIndex struct {
+	mu     sync.RWMutex
+	built  bool
+	tokens map[int64][]string
+	grams  map[string]map[int64]struct{}
+}
+
+// Id of a contact found by the index, with its relevance
+type searchHit struct {
+	id    int64
+	score float64
+}
+
+func newSearchIndex() *searchIndex {
+	return &searchIndex{}
+}
+
+// Build the index from all the contacts of the tenant in the store, unless it is already built
+func (idx *searchIndex) build(store ContactStore, tenant string) error {
+	idx.mu.RLock()
+	built := idx.built
+	idx.mu.RUnlock()
+	if built {
+		return nil
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if idx.built {
+		return nil
+	}
+
+	contacts, err := store.List(tenant)
+	if err != nil {
+		return err
+	}
+
+	idx.tokens = make(map[int64][]string, len(contacts))
+	idx.grams = make(map[string]map[int64]struct{})
+	for i := range contacts {
+		idx.addLocked(&contacts[i])
+	}
+
+	idx.built = true
+	return nil
+}
+
+// Add the contact to the index, replacing the previous version of it.
+// Until the index is built there is nothing to do, building it picks up the stored contact.
+func (idx *searchIndex) add(contact *Contact) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if !idx.built {
+		return
+	}
+
+	idx.removeLocked(contact.ID)
+	idx.addLocked(contact)
+}
+
+func (idx *searchIndex) remove(id int64) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if !idx.built {
+		return
+	}
+
+	idx.removeLocked(id)
+}
+
+func (idx *searchIndex) addLocked(contact *Contact) {
+	tokens := contactTokens(contact)
+	idx.tokens[contact.ID] = tokens
+
+	for _, token := range tokens {
+		for _, gram := range trigrams(token) {
+			ids, ok := idx.grams[gram]
+			if !ok {
+				ids = make(map[int64]struct{})
+				idx.grams[gram] = ids
+			}
+			ids[contact.ID] = struct{}{}
+		}
+	}
+}
+
+func (idx *searchIndex) removeLocked(id int64) {
+	for _, token := range idx.tokens[id] {
+		for _, gram := range trigrams(token) {
+			delete(idx.grams[gram], id)
+			if len(idx.grams[gram]) == 0 {
+				delete(idx.grams, gram)
+			}
+		}
+	}
+
+	delete(idx.tokens, id)
+}
+
+// Return the ids of the contacts matching every token of the query, best matches first
+func (idx *searchIndex) search(query string) []searchHit {
+	queryTokens := searchTokens(query)
+	if len(queryTokens) == 0 {
+		return nil
+	}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	hits := []searchHit{}
+	for id := range idx.candidates(queryTokens) {
+		score := 0.0
+		for _, queryToken := range queryTokens {
+			best := 0.0
+			for _, token := range idx.tokens[id] {
+				best = max(best, tokenSimilarity(queryToken, token))
+			}
+
+			// every query token has to match something in the contact
+			if best == 0 {
+				score = 0
+				break
+			}
+			score += best
+		}
+
+		if score > 0 {
+			hits = append(hits, searchHit{id: id, score: score / float64(len(queryTokens))})
+		}
+	}
+
+	slices.SortFunc(hits, func(a, b searchHit) int {
+		if a.score != b.score {
+			return cmp.Compare(b.score, a.score)
+		}
+		return cmp.Compare(a.id, b.id)
+	})
+
+	return hits
+}
+
+// Ids of the contacts sharing at least one trigram with the query tokens.
+// Tokens too short to have a trigram of their own can match anything, so all contacts are candidates then.
+func (idx *searchIndex) candidates(queryTokens []string) map[int64]struct{} {
+	for _, token := range queryTokens {
+		if len([]rune(token)) < 2 {
+			all := make(map[int64]struct{}, len(idx.tokens))
+			for id := range idx.tokens {
+				all[id] = struct{}{}
+			}
+			return all
+		}
+	}
+
+	candidates := make(map[int64]struct{})
+	for _, token := range queryTokens {
+		for _, gram := range trigrams(token) {
+			for id := range idx.grams[gram] {
+				candidates[id] = struct{}{}
+			}
+		}
+	}
+	return candidates
+}
+
+// How well a query token matches a contact token, from 0 (no match) to 1 (equal).
+// Prefixes and substrings rank right below exact matches, then come tokens
+// within a few typos of each other.
+func tokenSimilarity(query, token string) float64 {
+	switch {
+	case query == token:
+		return 1
+	case strings.HasPrefix(token, query):
+		return 0.9
+	case strings.Contains(token, query):
+		return 0.8
+	}
+
+	q, t := []rune(query), []rune(token)
+
+	// allow one typo in short tokens and two in longer ones
+	allowed := 1
+	if len(q) > 6 {
+		allowed = 2
+	}
+	if len(q) < 4 {
+		return 0
+	}
+
+	distance := levenshtein(q, t)
+	if distance > allowed {
+		return 0
+	}
+
+	return 0.7 * (1 - float64(distance)/float64(max(len(q), len(t))))
+}
+
+// Number of single rune insertions, deletions and substitutions needed to turn a into b
+func levenshtein(a, b []rune) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+
+	return previous[len(b)]
+}
@@ -0,0 +1,113 @@
+package data
+
+import (
+	"slices"
+	"testing"
+)
+
+// Testing that Cyrillic and Latin script with or without diacritics fold to the same tokens
+func TestSearchTokens(t *testing.T) {
+	testCases := []struct {
+		text     string
+		expected []string
+	}{
+		{"Jovanović", []string{"jovanovic"}},
+		{"Јовановић", []string{"jovanovic"}},
+		{"Đorđe Šćepanović", []string{"djordje", "scepanovic"}},
+		{"Ђорђе Шћепановић", []string{"djordje", "scepanovic"}},
+		{"Džajić, Љубиша", []string{"dzajic", "ljubisa"}},
+		{"Џајић Ljubiša", []string{"dzajic", "ljubisa"}},
+	}
+
+	for _, tc := range testCases {
+		got := searchTokens(tc.text)
+		if !slices.Equal(got, tc.expected) {
+			t.Errorf("%s: want %v; got %v", tc.text, tc.expected, got)
+		}
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	testCases := []struct {
+		a, b     string
+		expected int
+	}{
+		{"jovanovic", "jovanovic", 0},
+		{"jovanvic", "jovanovic", 1},
+		{"markovic", "makrovic", 2},
+		{"", "ilic", 4},
+	}
+
+	for _, tc := range testCases {
+		got := levenshtein([]rune(tc.a), []rune(tc.b))
+		if got != tc.expected {
+			t.Errorf("%s/%s: want %d; got %d", tc.a, tc.b, tc.expected, got)
+		}
+	}
+}
+
+// Testing searching contacts, and that the index follows inserts, updates and deletes
+func TestSearchContacts(t *testing.T) {
+	data := []Contact{
+		{ID: 1, FirstName: "Veljko", LastName: "Ilić", Telephone: "+38163577442"},
+		{ID: 2, FirstName: "Marko", LastName: "Jovanović", Telephone: "+38163587442"},
+		{ID: 3, FirstName: "Јован", LastName: "Марковић", Telephone: "+38164598332"},
+	}
+
+	forEachStore(t, data, func(t *testing.T, cm ContactsModel) {
+		search := func(query string) []int64 {
+			results, err := cm.SearchContacts(query, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ids := []int64{}
+			for _, result := range results {
+				ids = append(ids, result.Contact.ID)
+			}
+			return ids
+		}
+
+		testCases := []struct {
+			query    string
+			expected []int64
+		}{
+			{"Jovanvic", []int64{2}},
+			{"јовановић", []int64{2}},
+			{"ilic", []int64{1}},
+			{"Marko", []int64{2, 3}},
+			{"jovan marković", []int64{3}},
+			{"577442", []int64{1}},
+			{"Petrović", []int64{}},
+		}
+
+		for _, tc := range testCases {
+			if got := search(tc.query); !slices.Equal(got, tc.expected) {
+				t.Errorf("%s: want %v; got %v", tc.query, tc.expected, got)
+			}
+		}
+
+		contact := &Contact{FirstName: "Petar", LastName: "Petrović", Telephone: "+38165111222"}
+		if err := cm.InsertContact(contact); err != nil {
+			t.Fatal(err)
+		}
+		if got := search("petrovic"); !slices.Equal(got, []int64{contact.ID}) {
+			t.Errorf("after insert: want [%d]; got %v", contact.ID, got)
+		}
+
+		contact.LastName = "Perić"
+		if err := cm.UpdateContact(contact); err != nil {
+			t.Fatal(err)
+		}
+		if got := search("petrovic"); len(got) != 0 {
+			t.Errorf("after update: want []; got %v", got)
+		}
+
+		if err := cm.DeleteContact(contact.ID); err != nil {
+			t.Fatal(err)
+		}
+		if got := search("peric"); len(got) != 0 {
+			t.Errorf("after delete: want []; got %v", got)
+		}
+	})
+}
@@ -0,0 +1,1356 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	// pure Go SQLite driver, registered under the "sqlite" name, so the binary builds without cgo
+	_ "modernc.org/sqlite"
+)
+
+//go:embed migrations/*.up.sql
+var migrationsFS embed.FS
+
+// Timeout used for every query sent to the database
+const queryTimeout = 3 * time.Second
+
+// Timeout used for the transaction SaveContacts stores all its contacts in
+const batchTimeout = 30 * time.Second
+
+// SQLiteStore keeps contacts, and everything else the API stores, in an SQLite database
+type SQLiteStore struct {
+	DB *sql.DB
+}
+
+// Open the SQLite database described by dsn and bring its schema up to date
+func NewSQLiteStore(dsn string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite only allows one writer at a time, and every connection to ":memory:"
+	// opens a different database, so keep a single connection in the pool
+	db.SetMaxOpenConns(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err = db.PingContext(ctx)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	err = migrate(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &SQLiteStore{DB: db}, nil
+}
+
+// Columns selected for every contact, in the order scanContact expects them
+const contactColumns = `tenant, id, first_name, last_name, telephone, telephones, emails, addresses,
+		company, job_title, birthday, notes, tags, custom, card_name, version`
+
+func (s *SQLiteStore) Get(tenant string, id int64) (*Contact, error) {
+	query := `
+		SELECT ` + contactColumns + `
+		FROM contacts
+		WHERE tenant = ? AND id = ?`
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	contact, err := scanContact(s.DB.QueryRowContext(ctx, query, tenant, id))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return contact, nil
+}
+
+func (s *SQLiteStore) List(tenant string) ([]Contact, error) {
+	query := `
+		SELECT ` + contactColumns + `
+		FROM contacts
+		WHERE tenant = ?
+		ORDER BY id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	rows, err := s.DB.QueryContext(ctx, query, tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	contacts := []Contact{}
+	for rows.Next() {
+		contact, err := scanContact(rows)
+		if err != nil {
+			return nil, err
+		}
+		contacts = append(contacts, *contact)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return contacts, nil
+}
+
+func (s *SQLiteStore) Count() (map[string]int, error) {
+	query := `
+		SELECT tenant, COUNT(*)
+		FROM contacts
+		GROUP BY tenant`
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	rows, err := s.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[string]int{}
+	for rows.Next() {
+		var tenant string
+		var count int
+		if err := rows.Scan(&tenant, &count); err != nil {
+			return nil, err
+		}
+		counts[tenant] = count
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+func (s *SQLiteStore) Insert(contact *Contact) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	id, version, err := insertContact(ctx, tx, contact)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	contact.ID, contact.Version = id, version
+	return nil
+}
+
+func (s *SQLiteStore) Update(contact *Contact) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	version, err := updateContact(ctx, tx, contact)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	contact.Version = version
+	return nil
+}
+
+func (s *SQLiteStore) SaveContacts(contacts []*Contact) ([]error, error) {
+	// an import saves all its rows at once, so it gets more time than a single query
+	ctx, cancel := context.WithTimeout(context.Background(), batchTimeout)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	errs := make([]error, len(contacts))
+	ids := make([]int64, len(contacts))
+	versions := make([]int32, len(contacts))
+	for i, contact := range contacts {
+		if contact.ID == 0 {
+			ids[i], versions[i], err = insertContact(ctx, tx, contact)
+		} else {
+			ids[i] = contact.ID
+			versions[i], err = updateContact(ctx, tx, contact)
+		}
+
+		switch {
+		case errors.Is(err, ErrDuplicateContact), errors.Is(err, ErrRecordNotFound), errors.Is(err, ErrEditConflict):
+			errs[i] = err
+		case err != nil:
+			return nil, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, contact := range contacts {
+		if errs[i] == nil {
+			contact.ID, contact.Version = ids[i], versions[i]
+		}
+	}
+	return errs, nil
+}
+
+// Store a new contact in tx and return the id and the version it was given
+func insertContact(ctx context.Context, tx *sql.Tx, contact *Contact) (int64, int32, error) {
+	// every tenant numbers its contacts on its own, from tenant_sequences so the id of a deleted contact
+	// is never taken again. Contacts stored without going through Insert still move the sequence past their ids.
+	query := `
+		INSERT INTO contacts (tenant, id, first_name, last_name, telephone, telephones, emails, addresses,
+			company, job_title, birthday, notes, tags, custom, card_name)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING version`
+
+	args, err := contactArgs(contact)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var id int64
+	err = tx.QueryRowContext(ctx, `
+		SELECT MAX(
+			COALESCE((SELECT next_id FROM tenant_sequences WHERE tenant = ?), 1),
+			COALESCE((SELECT MAX(id) FROM contacts WHERE tenant = ?), 0) + 1)`,
+		contact.Tenant, contact.Tenant).Scan(&id)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var version int32
+	err = tx.QueryRowContext(ctx, query, append([]any{contact.Tenant, id}, args...)...).Scan(&version)
+	if err != nil {
+		switch {
+		case isUniqueViolation(err):
+			return 0, 0, ErrDuplicateContact
+		default:
+			return 0, 0, err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO tenant_sequences (tenant, next_id) VALUES (?, ?)
+		ON CONFLICT (tenant) DO UPDATE SET next_id = excluded.next_id`, contact.Tenant, id+1)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return id, version, nil
+}
+
+// Replace the stored contact in tx and return the version it moved to
+func updateContact(ctx context.Context, tx *sql.Tx, contact *Contact) (int32, error) {
+	query := `
+		UPDATE contacts
+		SET first_name = ?, last_name = ?, telephone = ?, telephones = ?, emails = ?, addresses = ?,
+			company = ?, job_title = ?, birthday = ?, notes = ?, tags = ?, custom = ?, card_name = ?,
+			version = version + 1
+		WHERE tenant = ? AND id = ? AND version = ?
+		RETURNING version`
+
+	args, err := contactArgs(contact)
+	if err != nil {
+		return 0, err
+	}
+	args = append(args, contact.Tenant, contact.ID, contact.Version)
+
+	var version int32
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&version)
+	if err != nil {
+		switch {
+		case isUniqueViolation(err):
+			return 0, ErrDuplicateContact
+		case errors.Is(err, sql.ErrNoRows):
+			// the contact is either gone or it has been changed in the meantime
+			var exists bool
+			err = tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM contacts WHERE tenant = ? AND id = ?)`,
+				contact.Tenant, contact.ID).Scan(&exists)
+			if err != nil {
+				return 0, err
+			}
+			if !exists {
+				return 0, ErrRecordNotFound
+			}
+			return 0, ErrEditConflict
+		default:
+			return 0, err
+		}
+	}
+
+	return version, nil
+}
+
+func (s *SQLiteStore) Delete(tenant string, id int64, version int32) (*Contact, error) {
+	query := `
+		DELETE FROM contacts
+		WHERE tenant = ? AND id = ? AND (? = 0 OR version = ?)
+		RETURNING ` + contactColumns
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	contact, err := scanContact(tx.QueryRowContext(ctx, query, tenant, id, version, version))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			tx.Rollback()
+			return nil, s.missingOrConflict(tenant, id)
+		default:
+			return nil, err
+		}
+	}
+
+	// the contact is gone, so it can not stay a member of any of the tenant's groups
+	_, err = tx.ExecContext(ctx, `
+		UPDATE contact_groups
+		SET version = version + 1
+		WHERE tenant = ? AND id IN (SELECT group_id FROM group_members WHERE contact_id = ?)`, tenant, id)
+	if err == nil {
+		_, err = tx.ExecContext(ctx, `
+			DELETE FROM group_members
+			WHERE contact_id = ? AND group_id IN (SELECT id FROM contact_groups WHERE tenant = ?)`, id, tenant)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return contact, nil
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.DB.Close()
+}
+
+func (s *SQLiteStore) GetGroup(tenant string, id int64) (*Group, error) {
+	query := `
+		SELECT id, tenant, name, description, version
+		FROM contact_groups
+		WHERE tenant = ? AND id = ?`
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	var group Group
+	err := s.DB.QueryRowContext(ctx, query, tenant, id).Scan(&group.ID, &group.Tenant, &group.Name, &group.Description, &group.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	members, err := s.groupMembers(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	group.ContactIDs = members[id]
+
+	return &group, nil
+}
+
+func (s *SQLiteStore) ListGroups(tenant string) ([]Group, error) {
+	query := `
+		SELECT id, tenant, name, description, version
+		FROM contact_groups
+		WHERE tenant = ?
+		ORDER BY id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	rows, err := s.DB.QueryContext(ctx, query, tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := []Group{}
+	for rows.Next() {
+		var group Group
+		err := rows.Scan(&group.ID, &group.Tenant, &group.Name, &group.Description, &group.Version)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	members, err := s.groupMembers(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+	for i := range groups {
+		groups[i].ContactIDs = members[groups[i].ID]
+	}
+
+	return groups, nil
+}
+
+func (s *SQLiteStore) InsertGroup(group *Group) error {
+	query := `
+		INSERT INTO contact_groups (tenant, name, description)
+		VALUES (?, ?, ?)
+		RETURNING id, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	err := s.DB.QueryRowContext(ctx, query, group.Tenant, group.Name, group.Description).Scan(&group.ID, &group.Version)
+	if err != nil {
+		switch {
+		case isUniqueViolation(err):
+			return ErrDuplicateGroup
+		default:
+			return err
+		}
+	}
+
+	group.ContactIDs = []int64{}
+	return nil
+}
+
+func (s *SQLiteStore) UpdateGroup(group *Group) error {
+	query := `
+		UPDATE contact_groups
+		SET name = ?, description = ?, version = version + 1
+		WHERE tenant = ? AND id = ? AND version = ?
+		RETURNING version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	args := []any{group.Name, group.Description, group.Tenant, group.ID, group.Version}
+
+	err := s.DB.QueryRowContext(ctx, query, args...).Scan(&group.Version)
+	if err != nil {
+		switch {
+		case isUniqueViolation(err):
+			return ErrDuplicateGroup
+		case errors.Is(err, sql.ErrNoRows):
+			_, err := s.GetGroup(group.Tenant, group.ID)
+			if err != nil {
+				return err
+			}
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	members, err := s.groupMembers(ctx, group.ID)
+	if err != nil {
+		return err
+	}
+	group.ContactIDs = members[group.ID]
+
+	return nil
+}
+
+func (s *SQLiteStore) DeleteGroup(tenant string, id int64, version int32) error {
+	query := `
+		DELETE FROM contact_groups
+		WHERE tenant = ? AND id = ? AND (? = 0 OR version = ?)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, query, tenant, id, version, version)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		tx.Rollback()
+		_, err := s.GetGroup(tenant, id)
+		if err != nil {
+			return err
+		}
+		return ErrEditConflict
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM group_members WHERE group_id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) AddGroupMembers(tenant string, groupID int64, contactIDs []int64) error {
+	// the SELECT yields no row, and so nothing is inserted, unless both the group and the contact exist in the tenant
+	query := `
+		INSERT OR IGNORE INTO group_members (group_id, contact_id)
+		SELECT g.id, c.id
+		FROM contact_groups g, contacts c
+		WHERE g.tenant = ? AND g.id = ? AND c.tenant = g.tenant AND c.id = ?`
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	added := int64(0)
+	for _, contactID := range contactIDs {
+		result, err := tx.ExecContext(ctx, query, tenant, groupID, contactID)
+		if err != nil {
+			return err
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		added += rowsAffected
+
+		if rowsAffected == 0 {
+			// either the contact is already a member, or the group or the contact is missing,
+			// in which case the rollback undoes the contacts added so far
+			var member bool
+			err = tx.QueryRowContext(ctx, `
+				SELECT EXISTS (
+					SELECT 1
+					FROM group_members m
+					INNER JOIN contact_groups g ON g.id = m.group_id
+					WHERE g.tenant = ? AND m.group_id = ? AND m.contact_id = ?)`,
+				tenant, groupID, contactID).Scan(&member)
+			if err != nil {
+				return err
+			}
+			if !member {
+				return ErrRecordNotFound
+			}
+		}
+	}
+
+	if added == 0 {
+		return nil
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE contact_groups SET version = version + 1 WHERE id = ?`, groupID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) RemoveGroupMember(tenant string, groupID, contactID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		DELETE FROM group_members
+		WHERE group_id = (SELECT id FROM contact_groups WHERE tenant = ? AND id = ?) AND contact_id = ?`,
+		tenant, groupID, contactID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE contact_groups SET version = version + 1 WHERE id = ?`, groupID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) GetField(name string) (*Field, error) {
+	query := `
+		SELECT name, type, required, enum_values, version
+		FROM custom_fields
+		WHERE name = ?`
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	field, err := scanField(s.DB.QueryRowContext(ctx, query, name))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return field, nil
+}
+
+func (s *SQLiteStore) ListFields() ([]Field, error) {
+	query := `
+		SELECT name, type, required, enum_values, version
+		FROM custom_fields
+		ORDER BY rowid`
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	rows, err := s.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	fields := []Field{}
+	for rows.Next() {
+		field, err := scanField(rows)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, *field)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return fields, nil
+}
+
+func (s *SQLiteStore) InsertField(field *Field) error {
+	query := `
+		INSERT INTO custom_fields (name, type, required, enum_values)
+		VALUES (?, ?, ?, ?)
+		RETURNING version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	enumValues, err := json.Marshal(field.EnumValues)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, field.Name, field.Type, field.Required, string(enumValues)).Scan(&field.Version)
+	if err != nil {
+		switch {
+		case isUniqueViolation(err):
+			return ErrDuplicateField
+		default:
+			return err
+		}
+	}
+
+	invalidated, err := countInvalidated(ctx, tx, nil, field)
+	if err != nil {
+		return err
+	}
+	if invalidated > 0 {
+		return &FieldInUseError{Contacts: invalidated}
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) UpdateField(field *Field) error {
+	query := `
+		UPDATE custom_fields
+		SET type = ?, required = ?, enum_values = ?, version = version + 1
+		WHERE name = ? AND version = ?
+		RETURNING version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	enumValues, err := json.Marshal(field.EnumValues)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	previous, err := scanField(tx.QueryRowContext(ctx, `
+		SELECT name, type, required, enum_values, version
+		FROM custom_fields
+		WHERE name = ?`, field.Name))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	var version int32
+	err = tx.QueryRowContext(ctx, query, field.Type, field.Required, string(enumValues), field.Name, field.Version).Scan(&version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	invalidated, err := countInvalidated(ctx, tx, previous, field)
+	if err != nil {
+		return err
+	}
+	if invalidated > 0 {
+		return &FieldInUseError{Contacts: invalidated}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	field.Version = version
+	return nil
+}
+
+func (s *SQLiteStore) DeleteField(name string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM custom_fields WHERE name = ?`, name)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	// the values of the field go away with it. Field names hold only letters, digits
+	// and underscores, so they can be used in a JSON path as they are.
+	_, err = tx.ExecContext(ctx, `
+		UPDATE contacts
+		SET custom = json_remove(custom, '$.' || ?), version = version + 1
+		WHERE json_type(custom, '$.' || ?) IS NOT NULL`, name, name)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) InsertUser(user *User) error {
+	query := `
+		INSERT INTO users (created_at, name, email, password_hash, activated, tenant, permissions)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		RETURNING id, version`
+
+	permissions, err := marshalPermissions(user.Permissions)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	args := []any{user.CreatedAt.Unix(), user.Name, user.Email, user.Password.hash, user.Activated, user.Tenant, permissions}
+
+	err = s.DB.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.Version)
+	if err != nil {
+		switch {
+		case isUniqueViolation(err):
+			return ErrDuplicateEmail
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *SQLiteStore) GetUser(id int64) (*User, error) {
+	query := `
+		SELECT id, created_at, name, email, password_hash, activated, tenant, permissions, version
+		FROM users
+		WHERE id = ?`
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	user, err := scanUser(s.DB.QueryRowContext(ctx, query, id))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return user, nil
+}
+
+func (s *SQLiteStore) GetUserByEmail(email string) (*User, error) {
+	query := `
+		SELECT id, created_at, name, email, password_hash, activated, tenant, permissions, version
+		FROM users
+		WHERE email = ?`
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	user, err := scanUser(s.DB.QueryRowContext(ctx, query, email))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return user, nil
+}
+
+func (s *SQLiteStore) ListUsers() ([]User, error) {
+	query := `
+		SELECT id, created_at, name, email, password_hash, activated, tenant, permissions, version
+		FROM users
+		ORDER BY id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	rows, err := s.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+func (s *SQLiteStore) UpdateUser(user *User) error {
+	query := `
+		UPDATE users
+		SET name = ?, email = ?, password_hash = ?, activated = ?, tenant = ?, permissions = ?, version = version + 1
+		WHERE id = ? AND version = ?
+		RETURNING version`
+
+	permissions, err := marshalPermissions(user.Permissions)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	args := []any{user.Name, user.Email, user.Password.hash, user.Activated, user.Tenant, permissions, user.ID, user.Version}
+
+	err = s.DB.QueryRowContext(ctx, query, args...).Scan(&user.Version)
+	if err != nil {
+		switch {
+		case isUniqueViolation(err):
+			return ErrDuplicateEmail
+		case errors.Is(err, sql.ErrNoRows):
+			var exists bool
+			err := s.DB.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE id = ?)`, user.ID).Scan(&exists)
+			if err != nil {
+				return err
+			}
+			if !exists {
+				return ErrRecordNotFound
+			}
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *SQLiteStore) InsertToken(token *Token) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// expired tokens are dropped whenever a new one is handed out
+	_, err = tx.ExecContext(ctx, `DELETE FROM tokens WHERE expiry <= ?`, time.Now().Unix())
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO tokens (hash, user_id, expiry, scope)
+		VALUES (?, ?, ?, ?)`, token.Hash, token.UserID, token.Expiry.Unix(), token.Scope)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) GetUserForToken(scope string, hash []byte, now time.Time) (*User, error) {
+	query := `
+		SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.tenant, users.permissions, users.version
+		FROM users
+		INNER JOIN tokens ON tokens.user_id = users.id
+		WHERE tokens.hash = ? AND tokens.scope = ? AND tokens.expiry > ?`
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	user, err := scanUser(s.DB.QueryRowContext(ctx, query, hash, scope, now.Unix()))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return user, nil
+}
+
+func (s *SQLiteStore) DeleteTokensForUser(scope string, userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	_, err := s.DB.ExecContext(ctx, `DELETE FROM tokens WHERE scope = ? AND user_id = ?`, scope, userID)
+	return err
+}
+
+// Scan a row holding the id, created_at, name, email, password_hash, activated, tenant, permissions and version columns into a user
+func scanUser(row interface{ Scan(dest ...any) error }) (*User, error) {
+	var user User
+	var createdAt int64
+	var permissions string
+
+	err := row.Scan(&user.ID, &createdAt, &user.Name, &user.Email, &user.Password.hash, &user.Activated, &user.Tenant, &permissions, &user.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal([]byte(permissions), &user.Permissions)
+	if err != nil {
+		return nil, err
+	}
+	if user.Permissions == nil {
+		user.Permissions = Permissions{}
+	}
+
+	user.CreatedAt = time.Unix(createdAt, 0).UTC()
+	return &user, nil
+}
+
+// Encode the permissions as the JSON array they are stored as
+func marshalPermissions(permissions Permissions) (string, error) {
+	if permissions == nil {
+		permissions = Permissions{}
+	}
+
+	js, err := json.Marshal(permissions)
+	return string(js), err
+}
+
+// Scan a row holding the name, type, required, enum_values and version columns into a field
+func scanField(row interface{ Scan(dest ...any) error }) (*Field, error) {
+	var field Field
+	var enumValues string
+
+	err := row.Scan(&field.Name, &field.Type, &field.Required, &enumValues, &field.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal([]byte(enumValues), &field.EnumValues)
+	if err != nil {
+		return nil, err
+	}
+	if len(field.EnumValues) == 0 {
+		field.EnumValues = nil
+	}
+
+	return &field, nil
+}
+
+// Number of the stored contacts, of every tenant, whose value the change of the field from previous invalidates,
+// see invalidates. Only the value of the field is read from every contact.
+func countInvalidated(ctx context.Context, tx *sql.Tx, previous, field *Field) (int, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT custom -> ('$.' || ?) FROM contacts`, field.Name)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	invalidated := 0
+	for rows.Next() {
+		var value sql.NullString
+		if err := rows.Scan(&value); err != nil {
+			return 0, err
+		}
+
+		var contact Contact
+		if value.Valid {
+			var v any
+			if err := json.Unmarshal([]byte(value.String), &v); err != nil {
+				return 0, err
+			}
+			contact.Custom = map[string]any{field.Name: v}
+		}
+
+		if invalidates(&contact, previous, field) {
+			invalidated++
+		}
+	}
+
+	return invalidated, rows.Err()
+}
+
+// Ids of the members of the group with the given id, or of every group if groupID is 0,
+// keyed by the group id. Every group has a non-nil list.
+func (s *SQLiteStore) groupMembers(ctx context.Context, groupID int64) (map[int64][]int64, error) {
+	query := `
+		SELECT g.id, m.contact_id
+		FROM contact_groups g
+		LEFT JOIN group_members m ON m.group_id = g.id
+		WHERE ? = 0 OR g.id = ?
+		ORDER BY g.id, m.contact_id`
+
+	rows, err := s.DB.QueryContext(ctx, query, groupID, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := make(map[int64][]int64)
+	for rows.Next() {
+		var id int64
+		var contactID sql.NullInt64
+		err := rows.Scan(&id, &contactID)
+		if err != nil {
+			return nil, err
+		}
+
+		if members[id] == nil {
+			members[id] = []int64{}
+		}
+		if contactID.Valid {
+			members[id] = append(members[id], contactID.Int64)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// Called when a query guarded by a version matched no rows, to find out whether
+// the contact is gone or it has been changed in the meantime
+func (s *SQLiteStore) missingOrConflict(tenant string, id int64) error {
+	_, err := s.Get(tenant, id)
+	if err != nil {
+		return err
+	}
+	return ErrEditConflict
+}
+
+// Values of every column written by Insert and Update, in the order of contactColumns without tenant, id and version
+func contactArgs(contact *Contact) ([]any, error) {
+	telephones, err := json.Marshal(contact.Telephones)
+	if err != nil {
+		return nil, err
+	}
+	emails, err := json.Marshal(contact.Emails)
+	if err != nil {
+		return nil, err
+	}
+	addresses, err := json.Marshal(contact.Addresses)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := json.Marshal(contact.Tags)
+	if err != nil {
+		return nil, err
+	}
+	custom, err := json.Marshal(contact.Custom)
+	if err != nil {
+		return nil, err
+	}
+
+	var birthday sql.NullString
+	if contact.Birthday != nil {
+		birthday = sql.NullString{String: contact.Birthday.String(), Valid: true}
+	}
+
+	return []any{
+		contact.FirstName, contact.LastName, contact.Telephone, string(telephones), string(emails), string(addresses),
+		contact.Company, contact.JobTitle, birthday, contact.Notes, string(tags), string(custom), contact.CardName,
+	}, nil
+}
+
+// Scan a row holding the contactColumns into a contact
+func scanContact(row interface{ Scan(dest ...any) error }) (*Contact, error) {
+	var contact Contact
+	var telephones, emails, addresses, tags, custom string
+	var birthday sql.NullString
+
+	err := row.Scan(
+		&contact.Tenant,
+		&contact.ID,
+		&contact.FirstName,
+		&contact.LastName,
+		&contact.Telephone,
+		&telephones,
+		&emails,
+		&addresses,
+		&contact.Company,
+		&contact.JobTitle,
+		&birthday,
+		&contact.Notes,
+		&tags,
+		&custom,
+		&contact.CardName,
+		&contact.Version,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal([]byte(telephones), &contact.Telephones)
+	if err == nil {
+		err = json.Unmarshal([]byte(emails), &contact.Emails)
+	}
+	if err == nil {
+		err = json.Unmarshal([]byte(addresses), &contact.Addresses)
+	}
+	if err == nil {
+		err = json.Unmarshal([]byte(tags), &contact.Tags)
+	}
+	if err == nil {
+		err = json.Unmarshal([]byte(custom), &contact.Custom)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// empty lists are left out of the contact, the same as in the other stores
+	if len(contact.Telephones) == 0 {
+		contact.Telephones = nil
+	}
+	if len(contact.Emails) == 0 {
+		contact.Emails = nil
+	}
+	if len(contact.Addresses) == 0 {
+		contact.Addresses = nil
+	}
+	if len(contact.Tags) == 0 {
+		contact.Tags = nil
+	}
+	if len(contact.Custom) == 0 {
+		contact.Custom = nil
+	}
+
+	if birthday.Valid {
+		date, err := ParseDate(birthday.String)
+		if err != nil {
+			return nil, err
+		}
+		contact.Birthday = &date
+	}
+
+	return &contact, nil
+}
+
+// The unique indexes on the tables make SQLite reject duplicates with this error
+func isUniqueViolation(err error) bool {
+	return strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
+
+// Apply every embedded migration newer than the version recorded in the database.
+// Migration files are named <version>_<description>.up.sql and run in version order,
+// each one in its own transaction.
+func migrate(db *sql.DB) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`)
+	if err != nil {
+		return err
+	}
+
+	var current int
+	err = db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current)
+	if err != nil {
+		return err
+	}
+
+	files, err := fs.Glob(migrationsFS, "migrations/*.up.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		name := strings.TrimPrefix(file, "migrations/")
+		version, err := strconv.Atoi(strings.SplitN(name, "_", 2)[0])
+		if err != nil {
+			return fmt.Errorf("invalid migration file name %q", name)
+		}
+
+		if version <= current {
+			continue
+		}
+
+		script, err := migrationsFS.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, string(script))
+		if err == nil {
+			_, err = tx.ExecContext(ctx, `INSERT INTO schema_migrations (version) VALUES (?)`, version)
+		}
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %s: %w", name, err)
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,47 @@
+package data
+
+import "errors"
+
+var (
+	ErrDuplicateContact = errors.New("same contact already exists")
+)
+
+// Contacts stored before versioning was introduced have no version, they all start at version 1
+func setMissingVersions(contacts []Contact) {
+	for i := range contacts {
+		if contacts[i].Version < 1 {
+			contacts[i].Version = 1
+		}
+	}
+}
+
+// ContactStore is implemented by every storage backend the contacts can be kept in.
+// ContactsModel talks only to this interface, so backends can be swapped at startup
+// without touching the HTTP handlers. Every backend keeps the groups, the custom field schema and the users as well.
+type ContactStore interface {
+	GroupStore
+	FieldStore
+	UserStore
+
+	// Get returns a copy of the tenant's contact with the given id, or ErrRecordNotFound
+	Get(tenant string, id int64) (*Contact, error)
+	// List returns copies of all the tenant's contacts, ordered by id
+	List(tenant string) ([]Contact, error)
+	// Count returns the number of contacts of every tenant which has any
+	Count() (map[string]int, error)
+	// Insert assigns the contact the next id of its tenant and stores it
+	Insert(contact *Contact) error
+	// Update replaces the stored contact which has the same tenant, id and version as the one passed in,
+	// and increments the contact's version. ErrEditConflict is returned when the versions differ.
+	Update(contact *Contact) error
+	// SaveContacts inserts the contacts without an id and updates the others, like Insert and Update do,
+	// and stores all of them in a single write. The error of every contact is returned at its index,
+	// a contact which fails leaves the others stored. When the second error is not nil nothing is stored.
+	SaveContacts(contacts []*Contact) ([]error, error)
+	// Delete removes the tenant's contact with the given id and returns it as it was stored. Unless version
+	// is AnyVersion, ErrEditConflict is returned when the stored contact is at a different version.
+	// The contact is removed from every group it was a member of.
+	Delete(tenant string, id int64, version int32) (*Contact, error)
+	// Close releases any resources held by the store
+	Close() error
+}
@@ -0,0 +1,63 @@
+package data
+
+import (
+	"cmp"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Run fn as a subtest against a ContactsModel for every storage backend, each seeded with the same contacts.
+// This way all the backends have to pass the same behavioral tests.
+func forEachStore(t *testing.T, contacts []Contact, fn func(t *testing.T, cm ContactsModel)) {
+	t.Helper()
+
+	stores := map[string]func(t *testing.T) ContactStore{
+		"memory": func(t *testing.T) ContactStore {
+			return NewMemoryStore(contacts)
+		},
+		"json": func(t *testing.T) ContactStore {
+			path := filepath.Join(t.TempDir(), "contacts.json")
+
+			js, err := json.Marshal(contacts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, js, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			store, err := NewJSONFileStore(path, DefaultBackups)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return store
+		},
+		"sqlite": func(t *testing.T) ContactStore {
+			store, err := NewSQLiteStore(":memory:")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Insert the contacts with their ids set, so tests can rely on them
+			for _, c := range contacts {
+				_, err := store.DB.Exec(`INSERT INTO contacts (tenant, id, first_name, last_name, telephone, version) VALUES (?, ?, ?, ?, ?, ?)`,
+					cmp.Or(c.Tenant, DefaultTenant), c.ID, c.FirstName, c.LastName, c.Telephone, max(c.Version, 1))
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			return store
+		},
+	}
+
+	for name, open := range stores {
+		t.Run(name, func(t *testing.T) {
+			store := open(t)
+			defer store.Close()
+
+			fn(t, NewModel(store))
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package data
+
+import (
+	"fmt"
+	"regexp"
+	"salestrekker_technical_interview.veljkoilic/internal/validator"
+	"sync"
+)
+
+// Tenants are the departments sharing one deployment. Every contact and group belongs to a tenant,
+// and is only seen through the models of that tenant. Users and API keys belong to a tenant too,
+// the one their requests go to. Records stored before there were tenants belong to DefaultTenant.
+// The custom field schema is shared by every tenant.
+const DefaultTenant = "default"
+
+const maxTenantChars = 50
+
+// Tenant names are lower case words separated by hyphens, so they can be used in paths as they are
+var tenantRX = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// Report whether the name can be the name of a tenant
+func ValidTenant(tenant string) bool {
+	return validator.MaxChars(tenant, maxTenantChars) && validator.Matches(tenant, tenantRX)
+}
+
+func ValidateTenant(v *validator.Validator, key string, tenant string) {
+	v.Check(tenant != "", key, "must be provided")
+	v.Check(ValidTenant(tenant), key, fmt.Sprintf("must be lower case letters, digits and hyphens, at most %d characters long", maxTenantChars))
+}
+
+// Put the contacts stored before there were tenants in the default tenant
+func setMissingTenants(contacts []Contact) {
+	for i := range contacts {
+		if contacts[i].Tenant == "" {
+			contacts[i].Tenant = DefaultTenant
+		}
+	}
+}
+
+// tenantIndexes holds the search index and the change journal of every tenant,
+// each created the first time the tenant's contacts are used
+type tenantIndexes struct {
+	mu      sync.Mutex
+	search  map[string]*searchIndex
+	changes map[string]*changeJournal
+}
+
+func newTenantIndexes() *tenantIndexes {
+	return &tenantIndexes{search: map[string]*searchIndex{}, changes: map[string]*changeJournal{}}
+}
+
+// Return the search index of the tenant's contacts
+func (t *tenantIndexes) searchIndex(tenant string) *searchIndex {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	idx, ok := t.search[tenant]
+	if !ok {
+		idx = newSearchIndex()
+		t.search[tenant] = idx
+	}
+	return idx
+}
+
+// Return the journal of the changes of the tenant's contacts
+func (t *tenantIndexes) journal(tenant string) *changeJournal {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	j, ok := t.changes[tenant]
+	if !ok {
+		j = newChangeJournal()
+		t.changes[tenant] = j
+	}
+	return j
+}
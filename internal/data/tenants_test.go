@@ -0,0 +1,156 @@
+package data
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidTenant(t *testing.T) {
+	testCases := []struct {
+		tenant   string
+		expected bool
+	}{
+		{DefaultTenant, true},
+		{"sales", true},
+		{"customer-support-2", true},
+		{"", false},
+		{"Sales", false},
+		{"sales team", false},
+		{"sales/", false},
+		{"-sales", false},
+		{"sales--team", false},
+	}
+
+	for _, tc := range testCases {
+		if got := ValidTenant(tc.tenant); got != tc.expected {
+			t.Errorf("%q: want %v; got %v", tc.tenant, tc.expected, got)
+		}
+	}
+}
+
+// Testing that a tenant neither sees nor changes the contacts of another tenant, even when their ids are the same
+func TestTenantContacts(t *testing.T) {
+	contacts := []Contact{
+		{ID: 1, Tenant: DefaultTenant, FirstName: "Veljko", LastName: "Ilic", Telephone: "+38163577442"},
+		{ID: 2, Tenant: DefaultTenant, FirstName: "Marko", LastName: "Markovic", Telephone: "+38163587442"},
+		{ID: 1, Tenant: "sales", FirstName: "Ana", LastName: "Anic", Telephone: "+38163597442"},
+	}
+
+	forEachStore(t, contacts, func(t *testing.T, cm ContactsModel) {
+		sales := cm.ForTenant("sales")
+
+		if got, err := sales.GetContact(1); err != nil || got.FirstName != "Ana" || got.Tenant != "sales" {
+			t.Errorf("want Ana; got %+v, %v", got, err)
+		}
+		if got, err := cm.GetContact(1); err != nil || got.FirstName != "Veljko" {
+			t.Errorf("want Veljko; got %+v, %v", got, err)
+		}
+		if _, err := sales.GetContact(2); !errors.Is(err, ErrRecordNotFound) {
+			t.Errorf("want %v for a contact of another tenant; got %v", ErrRecordNotFound, err)
+		}
+
+		if got, err := sales.ListContacts(); err != nil || len(got) != 1 {
+			t.Errorf("want 1 contact; got %v, %v", got, err)
+		}
+
+		results, err := sales.SearchContacts("Veljko", 10)
+		if err != nil || len(results) != 0 {
+			t.Errorf("want no results from another tenant; got %v, %v", results, err)
+		}
+
+		// ids are counted per tenant, and the same person can be a contact of both
+		veljko := &Contact{FirstName: "Veljko", LastName: "Ilic", Telephone: "+38163577442"}
+		if err := sales.InsertContact(veljko); err != nil || veljko.ID != 2 || veljko.Tenant != "sales" {
+			t.Errorf("want id 2 in sales; got %+v, %v", veljko, err)
+		}
+		first := &Contact{FirstName: "Ivana", LastName: "Ivic", Telephone: "+38163567442"}
+		if err := cm.ForTenant("support").InsertContact(first); err != nil || first.ID != 1 {
+			t.Errorf("want id 1 in support; got %+v, %v", first, err)
+		}
+
+		if err := sales.DeleteContact(1); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := cm.GetContact(1); err != nil {
+			t.Errorf("want the contact of the default tenant kept; got %v", err)
+		}
+		if err := sales.DeleteContact(1); !errors.Is(err, ErrRecordNotFound) {
+			t.Errorf("want %v; got %v", ErrRecordNotFound, err)
+		}
+	})
+}
+
+// Testing that groups only hold contacts of their own tenant
+func TestTenantGroups(t *testing.T) {
+	contacts := []Contact{
+		{ID: 1, Tenant: DefaultTenant, FirstName: "Veljko", LastName: "Ilic", Telephone: "+38163577442"},
+		{ID: 2, Tenant: DefaultTenant, FirstName: "Marko", LastName: "Markovic", Telephone: "+38163587442"},
+		{ID: 1, Tenant: "sales", FirstName: "Ana", LastName: "Anic", Telephone: "+38163597442"},
+	}
+
+	forEachStore(t, contacts, func(t *testing.T, cm ContactsModel) {
+		groups := NewGroupsModel(cm.Store)
+		sales := groups.ForTenant("sales")
+
+		suppliers := &Group{Name: "Suppliers"}
+		if err := sales.InsertGroup(suppliers); err != nil {
+			t.Fatal(err)
+		}
+		// names only have to be unique within a tenant
+		if err := groups.InsertGroup(&Group{Name: "Suppliers"}); err != nil {
+			t.Errorf("want the name free in the default tenant; got %v", err)
+		}
+
+		if _, err := groups.GetGroup(suppliers.ID); !errors.Is(err, ErrRecordNotFound) {
+			t.Errorf("want %v for a group of another tenant; got %v", ErrRecordNotFound, err)
+		}
+		if err := groups.AddMember(suppliers.ID, 1); !errors.Is(err, ErrRecordNotFound) {
+			t.Errorf("want %v; got %v", ErrRecordNotFound, err)
+		}
+		if err := sales.AddMember(suppliers.ID, 2); !errors.Is(err, ErrRecordNotFound) {
+			t.Errorf("want a contact of another tenant refused; got %v", err)
+		}
+
+		if err := sales.AddMember(suppliers.ID, 1); err != nil {
+			t.Fatal(err)
+		}
+
+		// deleting the contact with the same id in the default tenant leaves the group alone
+		if err := cm.DeleteContact(1); err != nil {
+			t.Fatal(err)
+		}
+		got, err := sales.GetGroup(suppliers.ID)
+		if err != nil || len(got.ContactIDs) != 1 || got.Version != 2 {
+			t.Errorf("want Ana still a member; got %+v, %v", got, err)
+		}
+
+		if err := groups.DeleteGroup(suppliers.ID, AnyVersion); !errors.Is(err, ErrRecordNotFound) {
+			t.Errorf("want %v; got %v", ErrRecordNotFound, err)
+		}
+		if got, err := groups.ListGroups(); err != nil || len(got) != 1 {
+			t.Errorf("want 1 group in the default tenant; got %v, %v", got, err)
+		}
+	})
+}
+
+func TestCountContacts(t *testing.T) {
+	contacts := []Contact{
+		{ID: 1, Tenant: DefaultTenant, FirstName: "Veljko", LastName: "Ilic", Telephone: "+38163577442"},
+		{ID: 2, Tenant: DefaultTenant, FirstName: "Marko", LastName: "Markovic", Telephone: "+38163587442"},
+		{ID: 1, Tenant: "sales", FirstName: "Ana", LastName: "Anic", Telephone: "+38163597442"},
+	}
+
+	forEachStore(t, contacts, func(t *testing.T, cm ContactsModel) {
+		got, err := cm.Store.Count()
+		if err != nil || len(got) != 2 || got[DefaultTenant] != 2 || got["sales"] != 1 {
+			t.Errorf("want 2 contacts in %s and 1 in sales; got %v, %v", DefaultTenant, got, err)
+		}
+
+		if err := cm.ForTenant("sales").DeleteContact(1); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := cm.Store.Count(); err != nil || len(got) != 1 {
+			t.Errorf("want tenants without contacts left out; got %v, %v", got, err)
+		}
+	})
+}
@@ -0,0 +1,257 @@
+package data
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"errors"
+	"golang.org/x/crypto/bcrypt"
+	"salestrekker_technical_interview.veljkoilic/internal/validator"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	ErrDuplicateEmail = errors.New("user with the same email already exists")
+)
+
+// Scopes of the tokens handed out to users. Activation tokens are sent to a new user to
+// activate the account with, authentication tokens are sent back with every request.
+const (
+	TokenActivation     = "activation"
+	TokenAuthentication = "authentication"
+)
+
+// How long the tokens stay valid
+const (
+	ActivationTokenTTL     = 3 * 24 * time.Hour
+	AuthenticationTokenTTL = 24 * time.Hour
+)
+
+// Cost of the password hashes. Every login pays it, every password guess does too.
+const passwordCost = 12
+
+// AnonymousUser is the user of requests which sent no credentials
+var AnonymousUser = &User{}
+
+// User is a member of the staff who logs in with an email and a password. Users register themselves
+// and can only log in once their account is activated. Version starts at 1 and is incremented every
+// time the user changes. Permissions are what the user may do once logged in, and Tenant is the tenant
+// whose contacts the user works with. Admins manage the permissions, superusers move users between tenants.
+type User struct {
+	ID          int64       `json:"id"`
+	CreatedAt   time.Time   `json:"created_at"`
+	Name        string      `json:"name"`
+	Email       string      `json:"email"`
+	Password    password    `json:"-"`
+	Activated   bool        `json:"activated"`
+	Tenant      string      `json:"tenant"`
+	Permissions Permissions `json:"permissions"`
+	Version     int32       `json:"-"`
+}
+
+// Report whether the user is AnonymousUser
+func (u *User) IsAnonymous() bool {
+	return u == AnonymousUser
+}
+
+// Return a deep copy of the user, without the plaintext password
+func (u *User) clone() User {
+	clone := *u
+	clone.Password.plaintext = nil
+	clone.Permissions = slices.Clone(u.Permissions)
+	if clone.Permissions == nil {
+		clone.Permissions = Permissions{}
+	}
+	return clone
+}
+
+// password holds the bcrypt hash of a user's password, and the plaintext while it is being set,
+// so it can be validated
+type password struct {
+	plaintext *string
+	hash      []byte
+}
+
+// Hash the plaintext password and keep both
+func (p *password) Set(plaintext string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(plaintext), passwordCost)
+	if err != nil {
+		return err
+	}
+
+	p.plaintext = &plaintext
+	p.hash = hash
+	return nil
+}
+
+// Report whether the plaintext password is the one the hash was made from
+func (p *password) Matches(plaintext string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword(p.hash, []byte(plaintext))
+	if err != nil {
+		switch {
+		case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// Token is a token handed out to a user. Only its SHA-256 hash is stored, the plaintext
+// is sent to the user once.
+type Token struct {
+	Plaintext string    `json:"token"`
+	Hash      []byte    `json:"-"`
+	UserID    int64     `json:"-"`
+	Expiry    time.Time `json:"expiry"`
+	Scope     string    `json:"-"`
+}
+
+// Generate a new token for the user, valid for ttl
+func generateToken(userID int64, ttl time.Duration, scope string) (*Token, error) {
+	token := &Token{
+		UserID: userID,
+		Expiry: time.Now().Add(ttl).UTC().Truncate(time.Second),
+		Scope:  scope,
+	}
+
+	randomBytes := make([]byte, 16)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	token.Plaintext = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
+	token.Hash = hashToken(token.Plaintext)
+	return token, nil
+}
+
+func hashToken(plaintext string) []byte {
+	hash := sha256.Sum256([]byte(plaintext))
+	return hash[:]
+}
+
+func ValidateEmail(v *validator.Validator, email string) {
+	v.Check(email != "", "email", "must be provided")
+	v.Check(validator.ValidEmail(email), "email", "must be a valid email address")
+}
+
+func ValidatePasswordPlaintext(v *validator.Validator, password string) {
+	v.Check(password != "", "password", "must be provided")
+	v.Check(len(password) >= 8, "password", "must be at least 8 bytes long")
+	// bcrypt ignores everything after the 72nd byte
+	v.Check(len(password) <= 72, "password", "must not be more than 72 bytes long")
+}
+
+func ValidateUser(v *validator.Validator, user *User) {
+	v.Check(user.Name != "", "name", "must be provided")
+	v.Check(validator.MaxChars(user.Name, 500), "name", "must not be more than 500 characters long")
+
+	ValidateEmail(v, user.Email)
+
+	if user.Password.plaintext != nil {
+		ValidatePasswordPlaintext(v, *user.Password.plaintext)
+	}
+
+	ValidateTenant(v, "tenant", user.Tenant)
+	ValidatePermissions(v, "permissions", user.Permissions)
+}
+
+// Tokens validate the plaintext the client sent before it is looked up
+func ValidateTokenPlaintext(v *validator.Validator, plaintext string) {
+	v.Check(plaintext != "", "token", "must be provided")
+	v.Check(len(plaintext) == 26, "token", "must be 26 bytes long")
+}
+
+// UserStore is implemented by every storage backend next to ContactStore, so the users
+// and their tokens are kept wherever the contacts are
+type UserStore interface {
+	// InsertUser assigns a new id to the user and stores it, or returns ErrDuplicateEmail if the email is taken
+	InsertUser(user *User) error
+	// GetUser returns a copy of the user with the given id, or ErrRecordNotFound
+	GetUser(id int64) (*User, error)
+	// GetUserByEmail returns a copy of the user with the given email, or ErrRecordNotFound
+	GetUserByEmail(email string) (*User, error)
+	// ListUsers returns a copy of every user, ordered by id
+	ListUsers() ([]User, error)
+	// UpdateUser replaces the stored user which has the same id and version as the one passed in,
+	// and increments the user's version. ErrEditConflict is returned when the versions differ.
+	UpdateUser(user *User) error
+	// InsertToken stores the token. Expired tokens may be removed at the same time.
+	InsertToken(token *Token) error
+	// GetUserForToken returns the user the token with the given scope and hash belongs to,
+	// or ErrRecordNotFound when there is no such token or it expired before now
+	GetUserForToken(scope string, hash []byte, now time.Time) (*User, error)
+	// DeleteTokensForUser removes every token of the user with the given scope
+	DeleteTokensForUser(scope string, userID int64) error
+}
+
+// UsersModel is what the handlers use to work with users and their tokens
+type UsersModel struct {
+	Store UserStore
+}
+
+func NewUsersModel(store UserStore) UsersModel {
+	return UsersModel{Store: store}
+}
+
+// Emails are compared case insensitively, they are stored lower case
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// Store a new user. Users not given a tenant belong to DefaultTenant.
+func (um *UsersModel) InsertUser(user *User) error {
+	if user.Tenant == "" {
+		user.Tenant = DefaultTenant
+	}
+	user.Email = normalizeEmail(user.Email)
+	user.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	return um.Store.InsertUser(user)
+}
+
+// get the user with the given id
+func (um *UsersModel) GetUser(id int64) (*User, error) {
+	return um.Store.GetUser(id)
+}
+
+// get the user with the given email
+func (um *UsersModel) GetUserByEmail(email string) (*User, error) {
+	return um.Store.GetUserByEmail(normalizeEmail(email))
+}
+
+// get every user
+func (um *UsersModel) ListUsers() ([]User, error) {
+	return um.Store.ListUsers()
+}
+
+// Save the changes made to the user
+func (um *UsersModel) UpdateUser(user *User) error {
+	user.Email = normalizeEmail(user.Email)
+	return um.Store.UpdateUser(user)
+}
+
+// Generate a token for the user, store it and return it with its plaintext
+func (um *UsersModel) NewToken(userID int64, ttl time.Duration, scope string) (*Token, error) {
+	token, err := generateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	err = um.Store.InsertToken(token)
+	return token, err
+}
+
+// get the user the unexpired token with the plaintext and scope belongs to
+func (um *UsersModel) GetUserForToken(scope, plaintext string) (*User, error) {
+	return um.Store.GetUserForToken(scope, hashToken(plaintext), time.Now())
+}
+
+// Remove every token of the user with the given scope
+func (um *UsersModel) DeleteTokensForUser(scope string, userID int64) error {
+	return um.Store.DeleteTokensForUser(scope, userID)
+}
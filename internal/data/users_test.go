@@ -0,0 +1,231 @@
+package data
+
+import (
+	"os"
+	"path/filepath"
+	"salestrekker_technical_interview.veljkoilic/internal/validator"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestValidateUser(t *testing.T) {
+	testCases := []struct {
+		name     string
+		user     User
+		password string
+		expected []string
+	}{
+		{"valid", User{Name: "Ana", Email: "ana@example.com", Tenant: DefaultTenant}, "pa55word", nil},
+		{"no name", User{Email: "ana@example.com", Tenant: DefaultTenant}, "pa55word", []string{"name"}},
+		{"bad email", User{Name: "Ana", Email: "ana", Tenant: DefaultTenant}, "pa55word", []string{"email"}},
+		{"short password", User{Name: "Ana", Email: "ana@example.com", Tenant: DefaultTenant}, "short", []string{"password"}},
+		{"bad tenant", User{Name: "Ana", Email: "ana@example.com", Tenant: "sales/"}, "pa55word", []string{"tenant"}},
+	}
+
+	for _, tc := range testCases {
+		tc.user.Password.plaintext = &tc.password
+
+		v := validator.New()
+		ValidateUser(v, &tc.user)
+
+		if len(v.Errors) != len(tc.expected) {
+			t.Errorf("%s: want errors for %v; got %v", tc.name, tc.expected, v.Errors)
+		}
+		for _, key := range tc.expected {
+			if _, ok := v.Errors[key]; !ok {
+				t.Errorf("%s: want an error for %s; got %v", tc.name, key, v.Errors)
+			}
+		}
+	}
+}
+
+func TestPassword(t *testing.T) {
+	var p password
+	if err := p.Set("pa55word"); err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, err := p.Matches("pa55word"); !ok || err != nil {
+		t.Errorf("want the password to match; got %v, %v", ok, err)
+	}
+	if ok, err := p.Matches("password"); ok || err != nil {
+		t.Errorf("want another password not to match; got %v, %v", ok, err)
+	}
+}
+
+// Testing registering and activating users, and looking them up by their tokens
+func TestUsers(t *testing.T) {
+	// one hash for every user, bcrypt is slow on purpose
+	var hash password
+	if err := hash.Set("pa55word"); err != nil {
+		t.Fatal(err)
+	}
+
+	forEachStore(t, nil, func(t *testing.T, cm ContactsModel) {
+		um := NewUsersModel(cm.Store)
+
+		user := &User{Name: "Ana", Email: " Ana@Example.com", Password: hash, Permissions: Permissions{PermissionContactsRead}}
+		if err := um.InsertUser(user); err != nil {
+			t.Fatal(err)
+		}
+		if user.ID != 1 || user.Version != 1 || user.Email != "ana@example.com" {
+			t.Errorf("want id 1, version 1 and a lower case email; got %+v", user)
+		}
+
+		if err := um.InsertUser(&User{Name: "Other Ana", Email: "ANA@example.com", Password: hash}); err != ErrDuplicateEmail {
+			t.Errorf("want %v; got %v", ErrDuplicateEmail, err)
+		}
+
+		got, err := um.GetUserByEmail("ana@EXAMPLE.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok, err := got.Password.Matches("pa55word"); !ok || err != nil || got.Activated {
+			t.Errorf("want the stored user with the password hash; got %+v, %v", got, err)
+		}
+		if !got.CreatedAt.Equal(user.CreatedAt) {
+			t.Errorf("want created at %v; got %v", user.CreatedAt, got.CreatedAt)
+		}
+		if !slices.Equal(got.Permissions, user.Permissions) {
+			t.Errorf("want permissions %v; got %v", user.Permissions, got.Permissions)
+		}
+
+		if _, err := um.GetUser(2); err != ErrRecordNotFound {
+			t.Errorf("want %v; got %v", ErrRecordNotFound, err)
+		}
+		other := &User{Name: "Bob", Email: "bob@example.com", Password: hash}
+		if err := um.InsertUser(other); err != nil {
+			t.Fatal(err)
+		}
+		users, err := um.ListUsers()
+		if err != nil || len(users) != 2 || users[0].ID != user.ID || users[1].ID != other.ID {
+			t.Fatalf("want both users ordered by id; got %+v, %v", users, err)
+		}
+		if users[1].Permissions == nil || len(users[1].Permissions) != 0 {
+			t.Errorf("want no permissions as an empty list; got %#v", users[1].Permissions)
+		}
+
+		other.Permissions = Permissions{PermissionContactsRead, PermissionContactsDelete}
+		if err := um.UpdateUser(other); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := um.GetUser(other.ID); err != nil || !got.Permissions.Include(PermissionContactsDelete) {
+			t.Errorf("want the permissions changed; got %+v, %v", got, err)
+		}
+
+		activation, err := um.NewToken(user.ID, ActivationTokenTTL, TokenActivation)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := um.GetUserForToken(TokenAuthentication, activation.Plaintext); err != ErrRecordNotFound {
+			t.Errorf("want a token of another scope refused; got %v", err)
+		}
+
+		got, err = um.GetUserForToken(TokenActivation, activation.Plaintext)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got.Activated = true
+		if err := um.UpdateUser(got); err != nil || got.Version != 2 {
+			t.Errorf("want version 2; got %d, %v", got.Version, err)
+		}
+		stale := *got
+		stale.Version = 1
+		if err := um.UpdateUser(&stale); err != ErrEditConflict {
+			t.Errorf("want %v; got %v", ErrEditConflict, err)
+		}
+
+		if err := um.DeleteTokensForUser(TokenActivation, user.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := um.GetUserForToken(TokenActivation, activation.Plaintext); err != ErrRecordNotFound {
+			t.Errorf("want the deleted token refused; got %v", err)
+		}
+
+		expired, err := um.NewToken(user.ID, -time.Minute, TokenAuthentication)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := um.GetUserForToken(TokenAuthentication, expired.Plaintext); err != ErrRecordNotFound {
+			t.Errorf("want the expired token refused; got %v", err)
+		}
+
+		authentication, err := um.NewToken(user.ID, AuthenticationTokenTTL, TokenAuthentication)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := um.GetUserForToken(TokenAuthentication, authentication.Plaintext); err != nil || !got.Activated {
+			t.Errorf("want the activated user; got %+v, %v", got, err)
+		}
+	})
+}
+
+// Testing that the JSON file keeps the password hashes, the versions and the tokens
+func TestJSONFileStoreUsers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "contacts.json")
+
+	store, err := NewJSONFileStore(path, DefaultBackups)
+	if err != nil {
+		t.Fatal(err)
+	}
+	um := NewUsersModel(store)
+
+	user := &User{Name: "Ana", Email: "ana@example.com"}
+	if err := user.Password.Set("pa55word"); err != nil {
+		t.Fatal(err)
+	}
+	if err := um.InsertUser(user); err != nil {
+		t.Fatal(err)
+	}
+	user.Activated = true
+	if err := um.UpdateUser(user); err != nil {
+		t.Fatal(err)
+	}
+	token, err := um.NewToken(user.ID, AuthenticationTokenTTL, TokenAuthentication)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := NewJSONFileStore(path, DefaultBackups)
+	if err != nil {
+		t.Fatal(err)
+	}
+	um = NewUsersModel(reopened)
+
+	got, err := um.GetUserForToken(TokenAuthentication, token.Plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Version != 2 || !got.Activated {
+		t.Errorf("want the activated user at version 2; got %+v", got)
+	}
+	if ok, err := got.Password.Matches("pa55word"); !ok || err != nil {
+		t.Errorf("want the password hash kept; got %v, %v", ok, err)
+	}
+}
+
+// Testing that users stored before there were permissions get the role new users start with
+func TestJSONFileStoreUsersWithoutPermissions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "contacts.json")
+	js := `{"contacts": [], "users": [{"id": 1, "name": "Ana", "email": "ana@example.com", "activated": true, "version": 1}]}`
+	if err := os.WriteFile(path, []byte(js), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := NewJSONFileStore(path, DefaultBackups)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	um := NewUsersModel(store)
+
+	user, err := um.GetUser(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, _ := RolePermissions(DefaultRole); !slices.Equal(user.Permissions, want) {
+		t.Errorf("want permissions %v; got %v", want, user.Permissions)
+	}
+}
@@ -0,0 +1,293 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"salestrekker_technical_interview.veljkoilic/internal/validator"
+	"salestrekker_technical_interview.veljkoilic/internal/vcard"
+	"slices"
+	"strings"
+	"time"
+)
+
+// vCard dates are written as 1990-05-17 in version 3.0, and as 19900517 in version 4.0
+const vcardBasicDateLayout = "20060102"
+
+// TYPE parameter values which say how a number or address is used, not where, so they are not labels
+var vcardNonLabelTypes = []string{"pref", "voice", "internet", "x400", "text", "msg"}
+
+// Build the vCard of the contact in the given version. Custom values have no vCard property
+// and are left out.
+func ContactVCard(contact *Contact, version string) *vcard.Card {
+	card := &vcard.Card{}
+	card.Add("VERSION", version, nil)
+	if contact.ID > 0 {
+		card.AddText("UID", fmt.Sprintf("contact-%d", contact.ID), nil)
+	}
+
+	card.AddText("FN", strings.TrimSpace(contact.FirstName+" "+contact.LastName), nil)
+	card.AddComponents("N", nil, contact.LastName, contact.FirstName, "", "", "")
+
+	// the primary number is the preferred one
+	primary := map[string][]string{"PREF": {"1"}}
+	if version == vcard.Version3 {
+		primary = map[string][]string{"TYPE": {"pref"}}
+	}
+	addVCardPhone(card, version, contact.Telephone, primary)
+
+	for _, phone := range contact.Telephones {
+		addVCardPhone(card, version, phone.Number, vcardLabelParams(phone.Label))
+	}
+
+	for _, email := range contact.Emails {
+		card.AddText("EMAIL", email.Address, vcardLabelParams(email.Label))
+	}
+
+	for _, address := range contact.Addresses {
+		card.AddComponents("ADR", vcardLabelParams(address.Label), "", "", address.Street, address.City, "", address.PostalCode, address.Country)
+	}
+
+	if contact.Company != "" {
+		card.AddComponents("ORG", nil, contact.Company)
+	}
+	if contact.JobTitle != "" {
+		card.AddText("TITLE", contact.JobTitle, nil)
+	}
+	if contact.Birthday != nil {
+		birthday := contact.Birthday.String()
+		if version == vcard.Version4 {
+			birthday = contact.Birthday.Format(vcardBasicDateLayout)
+		}
+		card.Add("BDAY", birthday, nil)
+	}
+	if contact.Notes != "" {
+		card.AddText("NOTE", contact.Notes, nil)
+	}
+	if len(contact.Tags) > 0 {
+		card.AddList("CATEGORIES", nil, contact.Tags...)
+	}
+
+	return card
+}
+
+// Add a TEL property. vCard 4.0 writes numbers as tel: URIs.
+func addVCardPhone(card *vcard.Card, version, number string, params map[string][]string) {
+	if version == vcard.Version4 {
+		params = withParam(params, "VALUE", "uri")
+		number = "tel:" + number
+	}
+	card.Add("TEL", number, params)
+}
+
+// Return the TYPE parameter a label is written as. vCards call mobile numbers cell.
+func vcardLabelParams(label string) map[string][]string {
+	label = strings.ToLower(label)
+	if label == "" {
+		return nil
+	}
+	if label == "mobile" {
+		label = "cell"
+	}
+	return map[string][]string{"TYPE": {label}}
+}
+
+// Return a copy of params with one more parameter
+func withParam(params map[string][]string, name, value string) map[string][]string {
+	copied := map[string][]string{name: {value}}
+	for n, v := range params {
+		copied[n] = v
+	}
+	return copied
+}
+
+// Return the label of a property, the first of its types which says where it is used
+func vcardLabel(p *vcard.Property) string {
+	for _, t := range p.Types() {
+		if slices.Contains(vcardNonLabelTypes, t) {
+			continue
+		}
+		if t == "cell" {
+			return "mobile"
+		}
+		return t
+	}
+	return ""
+}
+
+// Set the contact fields the card has properties for, and report the values which can not be read to v.
+// Fields the card has no properties for are left as they are.
+func applyVCard(v *validator.Validator, contact *Contact, card *vcard.Card) {
+	switch version := card.Version(); version {
+	case vcard.Version3, vcard.Version4:
+	case "":
+		v.AddError("row", "card has no VERSION")
+		return
+	default:
+		v.AddError("row", fmt.Sprintf("vCard version %s is not supported, only 3.0 and 4.0 are", version))
+		return
+	}
+
+	// the structured name is preferred, the formatted one is split at its last space
+	var family, given string
+	if n := card.Get("N"); n != nil {
+		components := n.Components()
+		family = components[0]
+		if len(components) > 1 {
+			given = components[1]
+		}
+	}
+	if fn := card.Get("FN"); family == "" && given == "" && fn != nil {
+		name := strings.TrimSpace(fn.Text())
+		if i := strings.LastIndex(name, " "); i != -1 {
+			given, family = strings.TrimSpace(name[:i]), name[i+1:]
+		} else {
+			given = name
+		}
+	}
+	if family != "" || given != "" {
+		contact.FirstName = strings.TrimSpace(given)
+		contact.LastName = strings.TrimSpace(family)
+	}
+
+	if phones := card.All("TEL"); len(phones) > 0 {
+		// the preferred number is the primary one, otherwise the first mobile, otherwise the first number
+		primary := slices.IndexFunc(phones, func(p vcard.Property) bool { return p.Preferred() })
+		if primary == -1 {
+			primary = slices.IndexFunc(phones, func(p vcard.Property) bool { return slices.Contains(p.Types(), "cell") })
+		}
+		primary = max(primary, 0)
+
+		contact.Telephone = vcardNumber(&phones[primary])
+		contact.Telephones = nil
+		for i := range phones {
+			if i != primary {
+				contact.Telephones = append(contact.Telephones, Phone{Label: vcardLabel(&phones[i]), Number: vcardNumber(&phones[i])})
+			}
+		}
+	}
+
+	if emails := card.All("EMAIL"); len(emails) > 0 {
+		contact.Emails = nil
+		for i := range emails {
+			contact.Emails = append(contact.Emails, Email{Label: vcardLabel(&emails[i]), Address: strings.TrimSpace(emails[i].Text())})
+		}
+	}
+
+	if addresses := card.All("ADR"); len(addresses) > 0 {
+		contact.Addresses = nil
+		for i := range addresses {
+			// post office box, extended address, street, locality, region, postal code, country
+			components := append(addresses[i].Components(), make([]string, 7)...)
+			contact.Addresses = append(contact.Addresses, Address{
+				Label:      vcardLabel(&addresses[i]),
+				Street:     strings.TrimSpace(components[2]),
+				City:       strings.TrimSpace(components[3]),
+				PostalCode: strings.TrimSpace(components[5]),
+				Country:    strings.TrimSpace(components[6]),
+			})
+		}
+	}
+
+	if org := card.Get("ORG"); org != nil {
+		contact.Company = strings.TrimSpace(org.Components()[0])
+	}
+	if title := card.Get("TITLE"); title != nil {
+		contact.JobTitle = strings.TrimSpace(title.Text())
+	}
+	if note := card.Get("NOTE"); note != nil {
+		contact.Notes = note.Text()
+	}
+
+	if bday := card.Get("BDAY"); bday != nil {
+		birthday, err := parseVCardDate(bday.Value)
+		if err != nil {
+			v.AddError("birthday", "must be a date in the YYYY-MM-DD or YYYYMMDD format")
+		} else {
+			contact.Birthday = &birthday
+		}
+	}
+
+	if categories := card.All("CATEGORIES"); len(categories) > 0 {
+		contact.Tags = nil
+		for i := range categories {
+			contact.Tags = append(contact.Tags, categories[i].List()...)
+		}
+	}
+}
+
+// Replace the contact fields which have vCard properties with the ones in the card, the way a CardDAV
+// PUT replaces a card. Fields the card has no properties for are cleared, while the id, version,
+// card name and custom values are kept.
+func ReplaceFromVCard(v *validator.Validator, contact *Contact, card *vcard.Card) {
+	*contact = Contact{ID: contact.ID, Version: contact.Version, Custom: contact.Custom, CardName: contact.CardName}
+	applyVCard(v, contact, card)
+}
+
+// Return the number of a TEL property, which vCard 4.0 may write as a tel: URI
+func vcardNumber(p *vcard.Property) string {
+	number := strings.TrimSpace(p.Value)
+	if len(number) >= 4 && strings.EqualFold(number[:4], "tel:") {
+		number = number[4:]
+	}
+	return number
+}
+
+// Parse a date written in either the extended or the basic format. A time of day is ignored.
+func parseVCardDate(value string) (Date, error) {
+	value, _, _ = strings.Cut(strings.TrimSpace(value), "T")
+
+	for _, layout := range []string{dateLayout, vcardBasicDateLayout} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return Date{t}, nil
+		}
+	}
+	return Date{}, ErrInvalidDateFormat
+}
+
+// Write the contacts passing the filter as a single vCard file, one card per contact
+func (cm *ContactsModel) ExportVCards(w io.Writer, match ContactFilter, version string) error {
+	enc := vcard.NewEncoder(w)
+
+	return cm.EachContact(match, func(contact *Contact) error {
+		return enc.Encode(ContactVCard(contact, version))
+	})
+}
+
+// Import every card of a vCard file. Each card is imported like a CSV row: it is validated with
+// ValidateContact, duplicates are handled as duplicates says, and a card which can not be read or
+// mapped to a contact is reported in the summary without stopping the import.
+func (cm *ContactsModel) ImportVCards(r io.Reader, duplicates string, fields []Field) (*ImportSummary, error) {
+	// cards carry no custom values, see OptionalFields
+	fields = OptionalFields(fields)
+
+	imp, err := cm.newImporter(&ImportSummary{Rows: []ImportRow{}}, duplicates, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := vcard.NewDecoder(r)
+
+	for {
+		card, err := dec.Decode()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		var syntaxErr *vcard.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			imp.add(ImportRow{Line: syntaxErr.Line, Status: ImportFailed, Errors: map[string]string{"row": syntaxErr.Msg}})
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		apply := func(v *validator.Validator, contact *Contact) {
+			applyVCard(v, contact, card)
+		}
+
+		imp.importContact(card.Line, apply)
+	}
+
+	return imp.save()
+}
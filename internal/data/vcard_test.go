@@ -0,0 +1,98 @@
+package data
+
+import (
+	"bytes"
+	"reflect"
+	"salestrekker_technical_interview.veljkoilic/internal/vcard"
+	"strings"
+	"testing"
+)
+
+// Testing that contacts exported as vCards are imported back the same, in both versions
+func TestVCardRoundTrip(t *testing.T) {
+	birthday, err := ParseDate("1990-05-17")
+	if err != nil {
+		t.Fatal(err)
+	}
+	contact := Contact{
+		FirstName:  "Veljko",
+		LastName:   "Ilic",
+		Telephone:  "+38163577442",
+		Telephones: []Phone{{Label: "work", Number: "+381112345678"}, {Label: "mobile", Number: "+38164111222"}},
+		Emails:     []Email{{Label: "home", Address: "veljko@example.com"}},
+		Addresses:  []Address{{Label: "work", Street: "Knez Mihailova 1", City: "Beograd", PostalCode: "11000", Country: "Serbia"}},
+		Company:    "Salestrekker; d.o.o.",
+		JobTitle:   "Engineer",
+		Birthday:   &birthday,
+		Notes:      "Met at the conference,\nin Belgrade",
+		Tags:       []string{"vip", "supplier, local"},
+	}
+
+	for _, version := range []string{vcard.Version3, vcard.Version4} {
+		t.Run(version, func(t *testing.T) {
+			source := NewModel(NewMemoryStore(nil))
+			stored := contact.clone()
+			if err := source.InsertContact(&stored); err != nil {
+				t.Fatal(err)
+			}
+
+			var buf bytes.Buffer
+			if err := source.ExportVCards(&buf, ContactFilter{}, version); err != nil {
+				t.Fatal(err)
+			}
+
+			target := NewModel(NewMemoryStore(nil))
+			summary, err := target.ImportVCards(&buf, ImportSkip, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if summary.Created != 1 {
+				t.Fatalf("want 1 created card; got %+v", summary)
+			}
+
+			got, err := target.GetContact(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(*got, stored) {
+				t.Errorf("want %+v; got %+v", stored, *got)
+			}
+		})
+	}
+}
+
+// Testing how cards written by other address books are mapped, and that cards which can not be mapped are reported
+func TestImportVCards(t *testing.T) {
+	input := "BEGIN:VCARD\r\nVERSION:3.0\r\nFN:Ana Maria Anic\r\nTEL;TYPE=HOME:011 2345 678\r\nTEL;TYPE=CELL:063111222\r\nBDAY:1985-04-12T00:00:00Z\r\nEND:VCARD\r\n" +
+		"BEGIN:VCARD\r\nVERSION:4.0\r\nN:Petrovic;Petar;;;\r\nFN:Petar Petrovic\r\nEND:VCARD\r\n" +
+		"BEGIN:VCARD\r\nVERSION:2.1\r\nN:Old;Card\r\nTEL:063111333\r\nEND:VCARD\r\n" +
+		"BEGIN:VCARD\r\nVERSION:4.0\r\nFN:Bad Birthday\r\nTEL:063111444\r\nBDAY:--0412\r\nEND:VCARD\r\n" +
+		"BEGIN:VCARD\r\nVERSION:4.0\r\nthis line has no value\r\nEND:VCARD\r\n"
+
+	cm := NewModel(NewMemoryStore(nil))
+
+	summary, err := cm.ImportVCards(strings.NewReader(input), ImportSkip, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []ImportRow{
+		{Line: 1, Status: ImportCreated, ID: 1},
+		{Line: 8, Status: ImportFailed, Errors: map[string]string{"telephone": "must be provided"}},
+		{Line: 13, Status: ImportFailed, Errors: map[string]string{"row": "vCard version 2.1 is not supported, only 3.0 and 4.0 are"}},
+		{Line: 18, Status: ImportFailed, Errors: map[string]string{"birthday": "must be a date in the YYYY-MM-DD or YYYYMMDD format"}},
+		{Line: 26, Status: ImportFailed, Errors: map[string]string{"row": "line has no value"}},
+	}
+	if !reflect.DeepEqual(summary.Rows, want) {
+		t.Errorf("want %+v; got %+v", want, summary.Rows)
+	}
+
+	got, err := cm.GetContact(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.FirstName != "Ana Maria" || got.LastName != "Anic" || got.Telephone != "+38163111222" ||
+		!reflect.DeepEqual(got.Telephones, []Phone{{Label: "home", Number: "+381112345678"}}) || got.Birthday.String() != "1985-04-12" {
+		t.Errorf("want Ana Maria Anic with her mobile as the primary number; got %+v", got)
+	}
+}
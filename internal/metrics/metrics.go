@@ -0,0 +1,388 @@
+// Package metrics keeps counters, gauges and histograms and writes them in the Prometheus
+// text exposition format (version 0.0.4), so they can be scraped without a client library.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Content type of the exposition Write produces
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Upper bounds of the default histogram buckets, in seconds. They suit the latency of HTTP
+// requests and of disk writes, from a few milliseconds to ten seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Registry holds the metrics which are written together. It is safe for concurrent use.
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+	names   map[string]bool
+}
+
+// metric is implemented by every kind of metric the registry writes
+type metric interface {
+	// write the HELP and TYPE lines and the samples of the metric
+	write(w *bufio.Writer)
+}
+
+// Returns a new empty Registry
+func NewRegistry() *Registry {
+	return &Registry{names: map[string]bool{}}
+}
+
+// Add the metric under name, panicking when the name is taken or not a valid metric name,
+// as both are programming errors
+func (r *Registry) register(name string, labels []string, m metric) {
+	if !validName(name) {
+		panic(fmt.Sprintf("metrics: invalid metric name %q", name))
+	}
+	for _, label := range labels {
+		if !validName(label) || strings.Contains(label, ":") || strings.HasPrefix(label, "__") || label == "le" {
+			panic(fmt.Sprintf("metrics: invalid label name %q of %s", label, name))
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.names[name] {
+		panic(fmt.Sprintf("metrics: %s registered twice", name))
+	}
+	r.names[name] = true
+	r.metrics = append(r.metrics, m)
+}
+
+// Write every metric to w, in the order they were registered
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, m := range r.metrics {
+		m.write(bw)
+	}
+	return bw.Flush()
+}
+
+// Counter is a value which only goes up, kept for every combination of its label values
+type Counter struct {
+	family
+}
+
+// Create a counter and add it to the registry. Its values are set with as many label values as labels are given here.
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{newFamily(name, help, "counter", labels)}
+	r.register(name, labels, c)
+	return c
+}
+
+// Inc adds 1 to the counter of the label values
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add adds v to the counter of the label values. It panics when v is negative, counters never go down.
+func (c *Counter) Add(v float64, values ...string) {
+	if v < 0 {
+		panic(fmt.Sprintf("metrics: counter %s decreased", c.name))
+	}
+	c.add(v, values)
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.writeValues(w)
+}
+
+// Gauge is a value which goes up and down, kept for every combination of its label values
+type Gauge struct {
+	family
+}
+
+// Create a gauge and add it to the registry. Its values are set with as many label values as labels are given here.
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{newFamily(name, help, "gauge", labels)}
+	r.register(name, labels, g)
+	return g
+}
+
+// Set sets the gauge of the label values to v
+func (g *Gauge) Set(v float64, values ...string) {
+	g.set(v, values)
+}
+
+// Add adds v, which may be negative, to the gauge of the label values
+func (g *Gauge) Add(v float64, values ...string) {
+	g.add(v, values)
+}
+
+// Inc adds 1 to the gauge of the label values
+func (g *Gauge) Inc(values ...string) {
+	g.add(1, values)
+}
+
+// Dec subtracts 1 from the gauge of the label values
+func (g *Gauge) Dec(values ...string) {
+	g.add(-1, values)
+}
+
+// Reset forgets the values of all label values, so only those set from now on are written
+func (g *Gauge) Reset() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	clear(g.series)
+}
+
+func (g *Gauge) write(w *bufio.Writer) {
+	g.writeValues(w)
+}
+
+// Histogram counts observations in buckets, kept for every combination of its label values
+type Histogram struct {
+	family
+	buckets []float64
+	counts  map[string]*histogramCounts
+}
+
+type histogramCounts struct {
+	buckets []uint64
+	count   uint64
+	sum     float64
+}
+
+// Create a histogram with buckets of the given upper bounds and add it to the registry.
+// The bounds have to be sorted, an upper bound of +Inf is always added.
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if !slices.IsSorted(buckets) {
+		panic(fmt.Sprintf("metrics: buckets of %s are not sorted", name))
+	}
+	buckets = slices.DeleteFunc(slices.Clone(buckets), func(b float64) bool { return math.IsInf(b, 1) })
+
+	h := &Histogram{family: newFamily(name, help, "histogram", labels), buckets: buckets, counts: map[string]*histogramCounts{}}
+	r.register(name, labels, h)
+	return h
+}
+
+// Observe counts v in the buckets of the label values
+func (h *Histogram) Observe(v float64, values ...string) {
+	key := h.key(values)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	counts, ok := h.counts[key]
+	if !ok {
+		counts = &histogramCounts{buckets: make([]uint64, len(h.buckets))}
+		h.counts[key] = counts
+		h.series[key] = &series{values: slices.Clone(values)}
+	}
+
+	// only the first bucket v fits in is counted, the buckets are made cumulative when written
+	if i, _ := slices.BinarySearch(h.buckets, v); i < len(h.buckets) {
+		counts.buckets[i]++
+	}
+	counts.count++
+	counts.sum += v
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.writeHeader(w)
+	for _, s := range h.sorted() {
+		counts := h.counts[h.key(s.values)]
+
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += counts.buckets[i]
+			h.writeSample(w, "_bucket", s.values, formatFloat(bound), float64(cumulative))
+		}
+		h.writeSample(w, "_bucket", s.values, "+Inf", float64(counts.count))
+		h.writeSample(w, "_sum", s.values, "", counts.sum)
+		h.writeSample(w, "_count", s.values, "", float64(counts.count))
+	}
+}
+
+// GaugeFunc is a gauge without labels whose value is read from a function every time it is written
+type GaugeFunc struct {
+	family
+	fn func() float64
+}
+
+// Create a gauge whose value is returned by fn and add it to the registry. fn must be safe for concurrent use.
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) *GaugeFunc {
+	g := &GaugeFunc{newFamily(name, help, "gauge", nil), fn}
+	r.register(name, nil, g)
+	return g
+}
+
+func (g *GaugeFunc) write(w *bufio.Writer) {
+	g.writeHeader(w)
+	g.writeSample(w, "", nil, "", g.fn())
+}
+
+// CounterFunc is a counter without labels whose value is read from a function every time it is written
+type CounterFunc struct {
+	family
+	fn func() float64
+}
+
+// Create a counter whose value is returned by fn and add it to the registry. fn must be safe for concurrent use,
+// and must never return less than it did before.
+func (r *Registry) NewCounterFunc(name, help string, fn func() float64) *CounterFunc {
+	c := &CounterFunc{newFamily(name, help, "counter", nil), fn}
+	r.register(name, nil, c)
+	return c
+}
+
+func (c *CounterFunc) write(w *bufio.Writer) {
+	c.writeHeader(w)
+	c.writeSample(w, "", nil, "", c.fn())
+}
+
+// family is what every kind of metric has in common: the name, the help text and the values,
+// one series for every combination of label values
+type family struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	values []string
+	value  float64
+}
+
+func newFamily(name, help, kind string, labels []string) family {
+	return family{name: name, help: help, kind: kind, labels: labels, series: map[string]*series{}}
+}
+
+// Key of the series of the label values, panicking when their number does not match the labels
+func (f *family) key(values []string) string {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s has %d labels, got %d values", f.name, len(f.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+func (f *family) add(v float64, values []string) {
+	key := f.key(values)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{values: slices.Clone(values)}
+		f.series[key] = s
+	}
+	s.value += v
+}
+
+func (f *family) set(v float64, values []string) {
+	key := f.key(values)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.series[key] = &series{values: slices.Clone(values), value: v}
+}
+
+// The series ordered by their label values, so the output does not change from one scrape to the next
+func (f *family) sorted() []*series {
+	all := make([]*series, 0, len(f.series))
+	for _, s := range f.series {
+		all = append(all, s)
+	}
+	slices.SortFunc(all, func(a, b *series) int { return slices.Compare(a.values, b.values) })
+	return all
+}
+
+func (f *family) writeValues(w *bufio.Writer) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.writeHeader(w)
+	for _, s := range f.sorted() {
+		f.writeSample(w, "", s.values, "", s.value)
+	}
+}
+
+func (f *family) writeHeader(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, helpReplacer.Replace(f.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.kind)
+}
+
+// Write one sample line of the metric, the name followed by suffix. le is added as the last label when it is not empty.
+func (f *family) writeSample(w *bufio.Writer, suffix string, values []string, le string, v float64) {
+	w.WriteString(f.name)
+	w.WriteString(suffix)
+
+	if len(values) > 0 || le != "" {
+		w.WriteByte('{')
+		for i, value := range values {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, `%s="%s"`, f.labels[i], labelValueReplacer.Replace(value))
+		}
+		if le != "" {
+			if len(values) > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, `le="%s"`, le)
+		}
+		w.WriteByte('}')
+	}
+
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(v))
+	w.WriteByte('\n')
+}
+
+var (
+	helpReplacer       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelValueReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+// Metric and label names are made of ASCII letters, digits, underscores and colons, and do not start with a digit
+func validName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_', c == ':':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,172 @@
+package metrics
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Return what the registry writes, failing the test on a write error
+func exposition(t *testing.T, r *Registry) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := r.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestWrite(t *testing.T) {
+	r := NewRegistry()
+
+	requests := r.NewCounter("requests_total", "Requests served.", "method", "status")
+	requests.Inc("POST", "201")
+	requests.Inc("GET", "200")
+	requests.Add(2, "GET", "200")
+
+	inFlight := r.NewGauge("in_flight", "Requests in flight.")
+	inFlight.Inc()
+	inFlight.Inc()
+	inFlight.Dec()
+
+	duration := r.NewHistogram("duration_seconds", "Request latency.", []float64{0.1, 1}, "route")
+	duration.Observe(0.05, "/a")
+	duration.Observe(0.1, "/a")
+	duration.Observe(0.5, "/a")
+	duration.Observe(3, "/a")
+
+	r.NewGaugeFunc("answer", "The answer.", func() float64 { return 42 })
+	r.NewCounterFunc("ticks_total", "Ticks.", func() float64 { return 7 })
+
+	want := `# HELP requests_total Requests served.
+# TYPE requests_total counter
+requests_total{method="GET",status="200"} 3
+requests_total{method="POST",status="201"} 1
+# HELP in_flight Requests in flight.
+# TYPE in_flight gauge
+in_flight 1
+# HELP duration_seconds Request latency.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{route="/a",le="0.1"} 2
+duration_seconds_bucket{route="/a",le="1"} 3
+duration_seconds_bucket{route="/a",le="+Inf"} 4
+duration_seconds_sum{route="/a"} 3.65
+duration_seconds_count{route="/a"} 4
+# HELP answer The answer.
+# TYPE answer gauge
+answer 42
+# HELP ticks_total Ticks.
+# TYPE ticks_total counter
+ticks_total 7
+`
+	if got := exposition(t, r); got != want {
+		t.Errorf("want\n%s\ngot\n%s", want, got)
+	}
+}
+
+func TestEscaping(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("escaped_total", "Help with a \\ and a\nnew line.", "value").Inc("a \"quoted\"\\\nvalue")
+
+	want := `# HELP escaped_total Help with a \\ and a\nnew line.
+# TYPE escaped_total counter
+escaped_total{value="a \"quoted\"\\\nvalue"} 1
+`
+	if got := exposition(t, r); got != want {
+		t.Errorf("want\n%s\ngot\n%s", want, got)
+	}
+}
+
+func TestGaugeReset(t *testing.T) {
+	r := NewRegistry()
+	contacts := r.NewGauge("contacts", "Contacts stored.", "tenant")
+	contacts.Set(3, "default")
+	contacts.Set(1, "sales")
+
+	contacts.Reset()
+	contacts.Set(2, "default")
+
+	if got := exposition(t, r); strings.Contains(got, "sales") || !strings.Contains(got, `contacts{tenant="default"} 2`) {
+		t.Errorf("want only the value set after the reset; got\n%s", got)
+	}
+}
+
+func TestFormatFloat(t *testing.T) {
+	testCases := []struct {
+		value    float64
+		expected string
+	}{
+		{0, "0"},
+		{1.5, "1.5"},
+		{0.005, "0.005"},
+		{1e21, "1e+21"},
+		{math.Inf(1), "+Inf"},
+		{math.Inf(-1), "-Inf"},
+		{math.NaN(), "NaN"},
+	}
+
+	for _, tc := range testCases {
+		if got := formatFloat(tc.value); got != tc.expected {
+			t.Errorf("%v: want %s; got %s", tc.value, tc.expected, got)
+		}
+	}
+}
+
+// Testing that the mistakes which would make the exposition invalid are caught when the metrics are created
+func TestRegisterPanics(t *testing.T) {
+	testCases := []struct {
+		name     string
+		register func(r *Registry)
+	}{
+		{"invalid name", func(r *Registry) { r.NewCounter("requests-total", "") }},
+		{"name starting with a digit", func(r *Registry) { r.NewGauge("1st", "") }},
+		{"invalid label", func(r *Registry) { r.NewCounter("requests_total", "", "status code") }},
+		{"reserved label", func(r *Registry) { r.NewHistogram("duration_seconds", "", DefaultBuckets, "le") }},
+		{"unsorted buckets", func(r *Registry) { r.NewHistogram("duration_seconds", "", []float64{1, 0.5}) }},
+		{"registered twice", func(r *Registry) { r.NewGauge("in_flight", ""); r.NewGauge("in_flight", "") }},
+		{"missing label value", func(r *Registry) { r.NewCounter("requests_total", "", "method").Inc() }},
+		{"decreasing counter", func(r *Registry) { r.NewCounter("requests_total", "").Add(-1) }},
+	}
+
+	for _, tc := range testCases {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: want a panic; got none", tc.name)
+				}
+			}()
+			tc.register(NewRegistry())
+		}()
+	}
+}
+
+func TestRegisterRuntime(t *testing.T) {
+	r := NewRegistry()
+	r.RegisterRuntime()
+	got := exposition(t, r)
+
+	if !strings.Contains(got, `go_info{version="go`) {
+		t.Errorf("want go_info with the Go version; got\n%s", got)
+	}
+
+	for _, m := range runtimeMetrics {
+		found := false
+		for line := range strings.Lines(got) {
+			value, ok := strings.CutPrefix(strings.TrimSpace(line), m.name+" ")
+			if !ok {
+				continue
+			}
+			found = true
+
+			if v, err := strconv.ParseFloat(value, 64); err != nil || math.IsNaN(v) || v < 0 {
+				t.Errorf("%s: want a value read from the runtime; got %q", m.name, value)
+			}
+		}
+		if !found {
+			t.Errorf("want %s written; got\n%s", m.name, got)
+		}
+	}
+}
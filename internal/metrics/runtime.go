@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"math"
+	"runtime"
+	runtimemetrics "runtime/metrics"
+)
+
+// The Go runtime metrics exposed by RegisterRuntime, each read from runtime/metrics,
+// which unlike runtime.ReadMemStats does not stop the world
+var runtimeMetrics = []struct {
+	name    string
+	help    string
+	counter bool
+	sample  string
+}{
+	{"go_goroutines", "Number of goroutines that currently exist.", false, "/sched/goroutines:goroutines"},
+	{"go_sched_gomaxprocs_threads", "Number of goroutines that can execute simultaneously (GOMAXPROCS).", false, "/sched/gomaxprocs:threads"},
+	{"go_memstats_heap_alloc_bytes", "Number of heap bytes occupied by live and not yet freed objects.", false, "/memory/classes/heap/objects:bytes"},
+	{"go_memstats_heap_objects", "Number of objects, live or not yet freed, occupying the heap.", false, "/gc/heap/objects:objects"},
+	{"go_memstats_sys_bytes", "Number of bytes of memory mapped by the Go runtime.", false, "/memory/classes/total:bytes"},
+	{"go_memstats_next_gc_bytes", "Heap size the next garbage collection cycle aims for.", false, "/gc/heap/goal:bytes"},
+	{"go_memstats_alloc_bytes_total", "Total number of bytes allocated on the heap.", true, "/gc/heap/allocs:bytes"},
+	{"go_gc_cycles_total", "Number of completed garbage collection cycles.", true, "/gc/cycles/total:gc-cycles"},
+}
+
+// RegisterRuntime adds metrics of the Go runtime to the registry: the goroutines, the memory held
+// and the garbage collection, along with go_info telling the Go version the program was built with
+func (r *Registry) RegisterRuntime() {
+	r.NewGauge("go_info", "Information about the Go environment.", "version").Set(1, runtime.Version())
+
+	for _, m := range runtimeMetrics {
+		if m.counter {
+			r.NewCounterFunc(m.name, m.help, readRuntimeMetric(m.sample))
+		} else {
+			r.NewGaugeFunc(m.name, m.help, readRuntimeMetric(m.sample))
+		}
+	}
+}
+
+// Returns a function reading the runtime metric, or returning NaN if this Go version does not have it
+func readRuntimeMetric(name string) func() float64 {
+	return func() float64 {
+		sample := []runtimemetrics.Sample{{Name: name}}
+		runtimemetrics.Read(sample)
+
+		switch sample[0].Value.Kind() {
+		case runtimemetrics.KindUint64:
+			return float64(sample[0].Value.Uint64())
+		case runtimemetrics.KindFloat64:
+			return sample[0].Value.Float64()
+		default:
+			return math.NaN()
+		}
+	}
+}
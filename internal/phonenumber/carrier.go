@@ -0,0 +1,85 @@
+package phonenumber
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// The carrier table maps number prefixes, written as the E.164 digits without the leading +,
+// to the network the numbers were originally assigned to. Numbers ported to another network
+// keep their prefix, so the carrier is the one the number was allocated to, not necessarily
+// the one serving it today.
+//
+//go:embed carriers.json
+var carriersJSON []byte
+
+type carrierPrefix struct {
+	Prefix  string `json:"prefix"`
+	Carrier string `json:"carrier"`
+}
+
+var carriers = struct {
+	sync.RWMutex
+	prefixes map[string]string
+	// length of the longest prefix in the table, no longer prefix has to be looked up
+	longest int
+}{}
+
+func init() {
+	err := LoadCarriers(bytes.NewReader(carriersJSON))
+	if err != nil {
+		panic(fmt.Sprintf("phonenumber: invalid carrier table: %v", err))
+	}
+}
+
+// LoadCarriers replaces the carrier table with the one read from r, which has the format
+// of the embedded carriers.json. It lets the table be updated without rebuilding the binary.
+func LoadCarriers(r io.Reader) error {
+	var table []carrierPrefix
+	err := json.NewDecoder(r).Decode(&table)
+	if err != nil {
+		return err
+	}
+
+	prefixes := make(map[string]string, len(table))
+	longest := 0
+	for i, entry := range table {
+		if entry.Prefix == "" || strings.Trim(entry.Prefix, "0123456789") != "" {
+			return fmt.Errorf("entry %d: prefix must contain digits only", i)
+		}
+		if entry.Carrier == "" {
+			return fmt.Errorf("entry %d: carrier must be provided", i)
+		}
+
+		prefixes[entry.Prefix] = entry.Carrier
+		longest = max(longest, len(entry.Prefix))
+	}
+
+	carriers.Lock()
+	defer carriers.Unlock()
+	carriers.prefixes = prefixes
+	carriers.longest = longest
+
+	return nil
+}
+
+// Carrier returns the network the number was assigned to, found by the longest matching prefix
+// in the carrier table, or an empty string if no prefix matches
+func Carrier(n Number) string {
+	digits := n.CountryCode + n.National
+
+	carriers.RLock()
+	defer carriers.RUnlock()
+
+	for length := min(len(digits), carriers.longest); length > 0; length-- {
+		if carrier, ok := carriers.prefixes[digits[:length]]; ok {
+			return carrier
+		}
+	}
+	return ""
+}
@@ -0,0 +1,58 @@
+package phonenumber
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCarrier(t *testing.T) {
+	testCases := []struct {
+		raw     string
+		carrier string
+	}{
+		{"+38160123456", "A1"},
+		{"063 577 442", "Yettel"},
+		{"064 111 222", "mts"},
+		{"0677 123 456", "Globaltel"},
+		{"0671 234 567", ""},
+		{"011 123 4567", ""},
+		{"+49 151 23456789", ""},
+	}
+
+	for _, tc := range testCases {
+		number, err := Parse(tc.raw, "RS")
+		if err != nil {
+			t.Fatalf("%q: %v", tc.raw, err)
+		}
+
+		if got := Carrier(number); got != tc.carrier {
+			t.Errorf("%q: want %q; got %q", tc.raw, tc.carrier, got)
+		}
+	}
+}
+
+func TestLoadCarriers(t *testing.T) {
+	// put the embedded table back for the other tests
+	defer LoadCarriers(strings.NewReader(string(carriersJSON)))
+
+	number, _ := Parse("+38163577442", "RS")
+
+	err := LoadCarriers(strings.NewReader(`[{"prefix": "381635", "carrier": "Test"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := Carrier(number); got != "Test" {
+		t.Errorf("want Test; got %q", got)
+	}
+
+	for _, table := range []string{`[{"prefix": "+381", "carrier": "Test"}]`, `[{"prefix": "381"}]`, `{`} {
+		if err := LoadCarriers(strings.NewReader(table)); err == nil {
+			t.Errorf("%s: want error; got nil", table)
+		}
+	}
+
+	// a table which failed to load leaves the previous one in place
+	if got := Carrier(number); got != "Test" {
+		t.Errorf("want Test; got %q", got)
+	}
+}
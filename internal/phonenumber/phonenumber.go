@@ -0,0 +1,204 @@
+// Package phonenumber parses telephone numbers written in national or international format,
+// normalizes them to E.164 and tells which region they belong to and what type of line they are.
+//
+// The rules for every supported region live in metadata.json, which is embedded in the binary.
+// They cover the number lengths and leading digits of each type of line, which is enough to
+// reject numbers which can not exist, but not to tell whether a number is actually assigned.
+package phonenumber
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrInvalidNumber = errors.New("invalid telephone number")
+	ErrUnknownRegion = errors.New("unknown region")
+)
+
+// Type is the kind of line a number belongs to
+type Type int
+
+const (
+	Unknown Type = iota
+	FixedLine
+	Mobile
+	// Some regions, like the US, do not tell fixed lines and mobiles apart by the number
+	FixedLineOrMobile
+	TollFree
+)
+
+func (t Type) String() string {
+	switch t {
+	case FixedLine:
+		return "fixed_line"
+	case Mobile:
+		return "mobile"
+	case FixedLineOrMobile:
+		return "fixed_line_or_mobile"
+	case TollFree:
+		return "toll_free"
+	default:
+		return "unknown"
+	}
+}
+
+// Number is a parsed telephone number
+type Number struct {
+	// Country calling code, without the leading +
+	CountryCode string
+	// National significant number, the digits following the country code
+	National string
+	// ISO 3166-1 alpha-2 code of the region the number belongs to
+	Region string
+	Type   Type
+}
+
+// E164 returns the number in the E.164 format, for example +38163577442
+func (n Number) E164() string {
+	return "+" + n.CountryCode + n.National
+}
+
+//go:embed metadata.json
+var metadataJSON []byte
+
+// Numbering rules of one region, as stored in metadata.json. The patterns have to match
+// the whole national significant number.
+type regionMetadata struct {
+	Region            string `json:"region"`
+	CountryCode       string `json:"country_code"`
+	NationalPrefix    string `json:"national_prefix"`
+	Mobile            string `json:"mobile"`
+	FixedLine         string `json:"fixed_line"`
+	FixedLineOrMobile string `json:"fixed_line_or_mobile"`
+	TollFree          string `json:"toll_free"`
+
+	patterns []typePattern
+}
+
+type typePattern struct {
+	numberType Type
+	rx         *regexp.Regexp
+}
+
+var (
+	regions      = map[string]*regionMetadata{}
+	countryCodes = map[string]*regionMetadata{}
+)
+
+func init() {
+	var metadata []*regionMetadata
+	if err := json.Unmarshal(metadataJSON, &metadata); err != nil {
+		panic(fmt.Sprintf("phonenumber: invalid metadata: %v", err))
+	}
+
+	for _, region := range metadata {
+		// toll-free numbers go first, in some regions they would match the other patterns as well
+		for _, p := range []struct {
+			numberType Type
+			pattern    string
+		}{
+			{TollFree, region.TollFree},
+			{Mobile, region.Mobile},
+			{FixedLine, region.FixedLine},
+			{FixedLineOrMobile, region.FixedLineOrMobile},
+		} {
+			if p.pattern == "" {
+				continue
+			}
+			region.patterns = append(region.patterns, typePattern{p.numberType, regexp.MustCompile("^(?:" + p.pattern + ")$")})
+		}
+
+		regions[region.Region] = region
+		if _, exists := countryCodes[region.CountryCode]; !exists {
+			countryCodes[region.CountryCode] = region
+		}
+	}
+}
+
+// IsRegion reports whether numbers of the region can be parsed
+func IsRegion(region string) bool {
+	_, ok := regions[strings.ToUpper(region)]
+	return ok
+}
+
+// Parse a telephone number. Numbers starting with + or 00 are read as international numbers,
+// any other number is read as a national number of defaultRegion. Spaces, dashes, dots,
+// slashes and parentheses between the digits are ignored.
+func Parse(raw string, defaultRegion string) (Number, error) {
+	raw = strings.TrimSpace(raw)
+
+	international := strings.HasPrefix(raw, "+")
+	if international {
+		raw = raw[1:]
+	}
+
+	digits, ok := stripFormatting(raw)
+	if !ok || digits == "" {
+		return Number{}, ErrInvalidNumber
+	}
+
+	if !international && strings.HasPrefix(digits, "00") {
+		international = true
+		digits = digits[2:]
+	}
+
+	if international {
+		// country calling codes are one to three digits long and no code is a prefix of another
+		for length := 1; length <= 3 && length < len(digits); length++ {
+			if region, ok := countryCodes[digits[:length]]; ok {
+				return region.parseNational(digits[length:], false)
+			}
+		}
+		return Number{}, ErrInvalidNumber
+	}
+
+	region, ok := regions[strings.ToUpper(defaultRegion)]
+	if !ok {
+		return Number{}, ErrUnknownRegion
+	}
+
+	return region.parseNational(digits, true)
+}
+
+// Classify the national significant number. When the number was written in the national format
+// it may start with the national prefix (trunk code), which is not part of the number.
+func (r *regionMetadata) parseNational(digits string, national bool) (Number, error) {
+	if national && r.NationalPrefix != "" && strings.HasPrefix(digits, r.NationalPrefix) {
+		if number, err := r.classify(strings.TrimPrefix(digits, r.NationalPrefix)); err == nil {
+			return number, nil
+		}
+	}
+
+	return r.classify(digits)
+}
+
+func (r *regionMetadata) classify(nsn string) (Number, error) {
+	for _, p := range r.patterns {
+		if p.rx.MatchString(nsn) {
+			return Number{CountryCode: r.CountryCode, National: nsn, Region: r.Region, Type: p.numberType}, nil
+		}
+	}
+
+	return Number{}, ErrInvalidNumber
+}
+
+// Return the digits of a number, dropping the formatting characters people type between them.
+// Reports false if the number holds anything else.
+func stripFormatting(raw string) (string, bool) {
+	var b strings.Builder
+	for _, r := range raw {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case strings.ContainsRune(" -./()", r):
+		default:
+			return "", false
+		}
+	}
+	return b.String(), true
+}
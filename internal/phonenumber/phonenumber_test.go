@@ -0,0 +1,79 @@
+package phonenumber
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		raw           string
+		defaultRegion string
+		e164          string
+		region        string
+		numberType    Type
+	}{
+		{"+38163577442", "RS", "+38163577442", "RS", Mobile},
+		{"063 577 442", "RS", "+38163577442", "RS", Mobile},
+		{"00381 63 577-442", "RS", "+38163577442", "RS", Mobile},
+		{"(011) 123-4567", "RS", "+381111234567", "RS", FixedLine},
+		{"0800 100 100", "RS", "+381800100100", "RS", TollFree},
+		{"+49 30 1234567", "RS", "+49301234567", "DE", FixedLine},
+		{"0151 23456789", "DE", "+4915123456789", "DE", Mobile},
+		{"06 20 123 4567", "HU", "+36201234567", "HU", Mobile},
+		{"06 123 456 78", "rs", "+381612345678", "RS", Mobile},
+		{"02 1234 5678", "IT", "+390212345678", "IT", FixedLine},
+		{"+1 (212) 555-1234", "RS", "+12125551234", "US", FixedLineOrMobile},
+		{"1 800 555 1234", "US", "+18005551234", "US", TollFree},
+		{"212.555.1234", "US", "+12125551234", "US", FixedLineOrMobile},
+		{"8 916 123-45-67", "RU", "+79161234567", "RU", Mobile},
+	}
+
+	for _, tc := range testCases {
+		number, err := Parse(tc.raw, tc.defaultRegion)
+		if err != nil {
+			t.Errorf("%q: want no error; got %v", tc.raw, err)
+			continue
+		}
+
+		if number.E164() != tc.e164 {
+			t.Errorf("%q: want %s; got %s", tc.raw, tc.e164, number.E164())
+		}
+		if number.Region != tc.region {
+			t.Errorf("%q: want region %s; got %s", tc.raw, tc.region, number.Region)
+		}
+		if number.Type != tc.numberType {
+			t.Errorf("%q: want type %v; got %v", tc.raw, tc.numberType, number.Type)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	testCases := []struct {
+		raw           string
+		defaultRegion string
+		expectedErr   error
+	}{
+		{"", "RS", ErrInvalidNumber},
+		{"4738473843", "RS", ErrInvalidNumber},
+		{"+3816", "RS", ErrInvalidNumber},
+		{"011123", "RS", ErrInvalidNumber},
+		{"+38163577442x", "RS", ErrInvalidNumber},
+		{"063 577 442 ext. 12", "RS", ErrInvalidNumber},
+		{"+999 123 456 789", "RS", ErrInvalidNumber},
+		{"063577442", "XX", ErrUnknownRegion},
+	}
+
+	for _, tc := range testCases {
+		_, err := Parse(tc.raw, tc.defaultRegion)
+		if err != tc.expectedErr {
+			t.Errorf("%q: want %v; got %v", tc.raw, tc.expectedErr, err)
+		}
+	}
+}
+
+func TestIsRegion(t *testing.T) {
+	if !IsRegion("RS") || !IsRegion("de") {
+		t.Error("want RS and de to be supported regions")
+	}
+	if IsRegion("XX") {
+		t.Error("want XX not to be a supported region")
+	}
+}
@@ -1,9 +1,13 @@
 package validator
 
-import "regexp"
+import (
+	"regexp"
+	"time"
+	"unicode/utf8"
+)
 
 var (
-	PhoneRX = regexp.MustCompile("^(\\+)(3816)([0-9]){6,9}$")
+	EmailRX = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+\\/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
 )
 
 // Validator contains a map of validation errors
@@ -39,3 +43,39 @@ func (v *Validator) Check(ok bool, key, message string) {
 func Matches(value string, rx *regexp.Regexp) bool {
 	return rx.MatchString(value)
 }
+
+// PermittedValue returns true if a specific value is in a list of permitted values
+func PermittedValue[T comparable](value T, permittedValues ...T) bool {
+	for i := range permittedValues {
+		if value == permittedValues[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// MaxChars returns true if a string value contains no more than n characters
+func MaxChars(value string, n int) bool {
+	return utf8.RuneCountInString(value) <= n
+}
+
+// ValidEmail returns true if a string value looks like an email address
+func ValidEmail(value string) bool {
+	return len(value) <= 254 && EmailRX.MatchString(value)
+}
+
+// InDateRange returns true if t is between min and max, both included
+func InDateRange(t, min, max time.Time) bool {
+	return !t.Before(min) && !t.After(max)
+}
+
+// Unique returns true if all values in a slice are unique
+func Unique[T comparable](values []T) bool {
+	uniqueValues := make(map[T]bool)
+
+	for _, value := range values {
+		uniqueValues[value] = true
+	}
+
+	return len(values) == len(uniqueValues)
+}
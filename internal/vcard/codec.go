@@ -0,0 +1,300 @@
+package vcard
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// Lines longer than this many bytes are folded when written
+const maxLineBytes = 75
+
+// SyntaxError is returned by the Decoder for a card it can not read. The Decoder skips to
+// the end of such a card, so the cards following it can still be read.
+type SyntaxError struct {
+	Line int
+	Msg  string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("vcard: line %d: %s", e.Line, e.Msg)
+}
+
+// Decoder reads the cards of a vCard file one by one
+type Decoder struct {
+	r *bufio.Reader
+	// number of the last physical line read
+	line int
+	// the next unfolded line, and the physical line it started at, if it was read ahead
+	next     string
+	nextLine int
+	hasNext  bool
+}
+
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: bufio.NewReader(r)}
+}
+
+// Read the next card. io.EOF is returned when there are no more cards,
+// and a *SyntaxError when the next card is malformed.
+func (d *Decoder) Decode() (*Card, error) {
+	// skip the blank lines between the cards
+	var line string
+	var start int
+	for {
+		var err error
+		line, start, err = d.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(line) != "" {
+			break
+		}
+	}
+
+	if !strings.EqualFold(strings.TrimSpace(line), "BEGIN:VCARD") {
+		d.skipCard()
+		return nil, &SyntaxError{Line: start, Msg: "expected BEGIN:VCARD"}
+	}
+
+	card := &Card{Line: start}
+
+	// nested cards, like the vCard 2.1 AGENT property, are skipped along with their parent
+	depth := 0
+	var syntaxErr *SyntaxError
+
+	for {
+		line, number, err := d.readLine()
+		if errors.Is(err, io.EOF) {
+			return nil, &SyntaxError{Line: start, Msg: "card has no END:VCARD"}
+		} else if err != nil {
+			return nil, err
+		}
+
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		switch trimmed := strings.TrimSpace(line); {
+		case strings.EqualFold(trimmed, "BEGIN:VCARD"):
+			depth++
+			continue
+		case strings.EqualFold(trimmed, "END:VCARD"):
+			if depth > 0 {
+				depth--
+				continue
+			}
+			if syntaxErr != nil {
+				return nil, syntaxErr
+			}
+			return card, nil
+		}
+
+		if depth > 0 || syntaxErr != nil {
+			continue
+		}
+
+		property, err := parseProperty(line)
+		if err != nil {
+			syntaxErr = &SyntaxError{Line: number, Msg: err.Error()}
+			continue
+		}
+		card.Properties = append(card.Properties, property)
+	}
+}
+
+// Read lines up to and including the next END:VCARD, after the start of a card could not be read
+func (d *Decoder) skipCard() {
+	for {
+		line, _, err := d.readLine()
+		if err != nil || strings.EqualFold(strings.TrimSpace(line), "END:VCARD") {
+			return
+		}
+	}
+}
+
+// Read the next unfolded line, together with the number of the physical line it starts at.
+// Lines starting with a space or a tab continue the line before them.
+func (d *Decoder) readLine() (string, int, error) {
+	var line string
+	var start int
+
+	if d.hasNext {
+		line, start, d.hasNext = d.next, d.nextLine, false
+	} else {
+		var err error
+		line, err = d.readPhysicalLine()
+		if err != nil {
+			return "", 0, err
+		}
+		start = d.line
+	}
+
+	for {
+		next, err := d.readPhysicalLine()
+		if errors.Is(err, io.EOF) {
+			return line, start, nil
+		} else if err != nil {
+			return "", 0, err
+		}
+
+		if next != "" && (next[0] == ' ' || next[0] == '\t') {
+			line += next[1:]
+			continue
+		}
+
+		d.next, d.nextLine, d.hasNext = next, d.line, true
+		return line, start, nil
+	}
+}
+
+// Read a single physical line, without its line ending
+func (d *Decoder) readPhysicalLine() (string, error) {
+	line, err := d.r.ReadString('\n')
+	if err != nil && (!errors.Is(err, io.EOF) || line == "") {
+		return "", err
+	}
+
+	d.line++
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// Parse a content line into its group, name, parameters and value
+func parseProperty(line string) (Property, error) {
+	var p Property
+
+	// the name ends at the first semicolon or colon
+	end := strings.IndexAny(line, ";:")
+	if end == -1 {
+		return p, errors.New("line has no value")
+	}
+
+	name := line[:end]
+	if group, rest, ok := strings.Cut(name, "."); ok {
+		p.Group, name = group, rest
+	}
+	if name == "" {
+		return p, errors.New("property has no name")
+	}
+	p.Name = strings.ToUpper(name)
+
+	rest := line[end:]
+	for rest[0] == ';' {
+		rest = rest[1:]
+
+		// parameter values in quotes may contain semicolons and colons
+		i := 0
+		inQuotes := false
+		for ; i < len(rest); i++ {
+			if rest[i] == '"' {
+				inQuotes = !inQuotes
+			} else if !inQuotes && (rest[i] == ';' || rest[i] == ':') {
+				break
+			}
+		}
+		if i == len(rest) {
+			return p, errors.New("line has no value")
+		}
+
+		param := rest[:i]
+		rest = rest[i:]
+
+		paramName, value, ok := strings.Cut(param, "=")
+		if !ok {
+			// vCard 2.1 lists the types on their own, as in TEL;WORK;VOICE
+			paramName, value = "TYPE", param
+		}
+		if p.Params == nil {
+			p.Params = make(map[string][]string)
+		}
+		paramName = strings.ToUpper(paramName)
+		p.Params[paramName] = append(p.Params[paramName], strings.Trim(value, `"`))
+	}
+
+	p.Value = rest[1:]
+	return p, nil
+}
+
+// Encoder writes cards in the vCard format, with CRLF line endings and long lines folded
+type Encoder struct {
+	w io.Writer
+}
+
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// Write the card, wrapped in BEGIN:VCARD and END:VCARD
+func (e *Encoder) Encode(card *Card) error {
+	var b strings.Builder
+
+	b.WriteString("BEGIN:VCARD\r\n")
+	for _, p := range card.Properties {
+		writeFolded(&b, formatProperty(&p))
+	}
+	b.WriteString("END:VCARD\r\n")
+
+	_, err := io.WriteString(e.w, b.String())
+	return err
+}
+
+// Format the property as a content line
+func formatProperty(p *Property) string {
+	var b strings.Builder
+
+	if p.Group != "" {
+		b.WriteString(p.Group + ".")
+	}
+	b.WriteString(p.Name)
+
+	// parameters are written in a fixed order, so the same card is always written the same
+	names := make([]string, 0, len(p.Params))
+	for name := range p.Params {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		values := p.Params[name]
+		if len(values) == 0 {
+			continue
+		}
+
+		b.WriteString(";" + name + "=")
+		for i, value := range values {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			if strings.ContainsAny(value, `;:,`) {
+				value = `"` + strings.ReplaceAll(value, `"`, "'") + `"`
+			}
+			b.WriteString(value)
+		}
+	}
+
+	b.WriteString(":" + p.Value)
+	return b.String()
+}
+
+// Write the line, folding it so no physical line is longer than maxLineBytes.
+// Lines are never folded inside a UTF-8 encoded character.
+func writeFolded(b *strings.Builder, line string) {
+	limit := maxLineBytes
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+
+		b.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+
+		// the continuation lines start with a space, which counts towards their length
+		limit = maxLineBytes - 1
+	}
+	b.WriteString(line + "\r\n")
+}
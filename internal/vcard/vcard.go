@@ -0,0 +1,191 @@
+// Package vcard reads and writes vCards, the format address books exchange contacts in.
+// It understands the syntax shared by vCard 3.0 (RFC 2426) and 4.0 (RFC 6350): folded lines,
+// property groups and parameters, and the escaping of text values. What the properties mean
+// is left to the caller.
+package vcard
+
+import (
+	"strings"
+)
+
+// Versions of the format the Encoder can write
+const (
+	Version3 = "3.0"
+	Version4 = "4.0"
+)
+
+// MediaType is the media type of vCard files
+const MediaType = "text/vcard"
+
+// Property is a single content line of a card, like TEL;TYPE=work:+38163577442.
+// Names and parameter names are upper case. Value is kept as it is written in the card,
+// use Text or Components to read text values.
+type Property struct {
+	Group  string
+	Name   string
+	Params map[string][]string
+	Value  string
+}
+
+// Return the values of the parameter with the given name
+func (p *Property) Param(name string) []string {
+	return p.Params[strings.ToUpper(name)]
+}
+
+// Return the values of the TYPE parameter in lower case. Values listed with commas,
+// as in TYPE=WORK,VOICE, are returned one by one.
+func (p *Property) Types() []string {
+	var types []string
+	for _, value := range p.Param("TYPE") {
+		for t := range strings.SplitSeq(value, ",") {
+			if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+				types = append(types, t)
+			}
+		}
+	}
+	return types
+}
+
+// Report whether the property is marked as preferred, either with the vCard 4.0 PREF parameter
+// or the vCard 3.0 TYPE=pref
+func (p *Property) Preferred() bool {
+	if len(p.Param("PREF")) > 0 {
+		return true
+	}
+	for _, t := range p.Types() {
+		if t == "pref" {
+			return true
+		}
+	}
+	return false
+}
+
+// Return the value as unescaped text
+func (p *Property) Text() string {
+	return UnescapeText(p.Value)
+}
+
+// Return the unescaped components of a structured value, like the family and given name in N
+func (p *Property) Components() []string {
+	return splitUnescaped(p.Value, ';')
+}
+
+// Return the unescaped values of a list, like the categories in CATEGORIES
+func (p *Property) List() []string {
+	return splitUnescaped(p.Value, ',')
+}
+
+// Card is a single vCard. Line is the line the card started at, when it was read by a Decoder.
+type Card struct {
+	Properties []Property
+	Line       int
+}
+
+// Return the version of the card, or "" if it has none
+func (c *Card) Version() string {
+	if p := c.Get("VERSION"); p != nil {
+		return p.Value
+	}
+	return ""
+}
+
+// Return the first property with the given name, or nil
+func (c *Card) Get(name string) *Property {
+	name = strings.ToUpper(name)
+	for i := range c.Properties {
+		if c.Properties[i].Name == name {
+			return &c.Properties[i]
+		}
+	}
+	return nil
+}
+
+// Return every property with the given name
+func (c *Card) All(name string) []Property {
+	name = strings.ToUpper(name)
+
+	var properties []Property
+	for _, p := range c.Properties {
+		if p.Name == name {
+			properties = append(properties, p)
+		}
+	}
+	return properties
+}
+
+// Add a property. The value is written as it is, so text has to be escaped with EscapeText,
+// or passed to AddText.
+func (c *Card) Add(name, value string, params map[string][]string) {
+	c.Properties = append(c.Properties, Property{Name: strings.ToUpper(name), Params: params, Value: value})
+}
+
+// Add a property with a text value
+func (c *Card) AddText(name, text string, params map[string][]string) {
+	c.Add(name, EscapeText(text), params)
+}
+
+// Add a property with a structured value made of the given text components
+func (c *Card) AddComponents(name string, params map[string][]string, components ...string) {
+	escaped := make([]string, len(components))
+	for i, component := range components {
+		escaped[i] = EscapeText(component)
+	}
+	c.Add(name, strings.Join(escaped, ";"), params)
+}
+
+// Add a property with a value which is a list of text values
+func (c *Card) AddList(name string, params map[string][]string, values ...string) {
+	escaped := make([]string, len(values))
+	for i, value := range values {
+		escaped[i] = EscapeText(value)
+	}
+	c.Add(name, strings.Join(escaped, ","), params)
+}
+
+var textEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, ",", `\,`, ";", `\;`, "\r", "")
+
+// Escape the backslashes, newlines, commas and semicolons in text
+func EscapeText(text string) string {
+	return textEscaper.Replace(text)
+}
+
+// Undo the escaping of EscapeText. Backslashes before other characters are dropped.
+func UnescapeText(value string) string {
+	if !strings.Contains(value, `\`) {
+		return value
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' || i == len(value)-1 {
+			b.WriteByte(value[i])
+			continue
+		}
+
+		i++
+		switch value[i] {
+		case 'n', 'N':
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(value[i])
+		}
+	}
+	return b.String()
+}
+
+// Split the value at every sep which is not escaped, and unescape the parts
+func splitUnescaped(value string, sep byte) []string {
+	var parts []string
+
+	start := 0
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			i++
+		case sep:
+			parts = append(parts, UnescapeText(value[start:i]))
+			start = i + 1
+		}
+	}
+	return append(parts, UnescapeText(value[start:]))
+}
@@ -0,0 +1,132 @@
+package vcard
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Testing reading folded lines, groups, parameters and escaped values
+func TestDecode(t *testing.T) {
+	input := "BEGIN:VCARD\r\n" +
+		"VERSION:3.0\r\n" +
+		"N:Ili\\;c;Vel\r\n" +
+		" jko;;;\r\n" +
+		"item1.TEL;TYPE=WORK,VOICE;TYPE=pref:+381 11 234 5678\r\n" +
+		"TEL;CELL:063577442\n" +
+		"ADR;LABEL=\"Home; main: door\":;;Knez Mihailova 1;Beograd;;11000;Serbia\r\n" +
+		"NOTE:first line\\nsecond\\, line\r\n" +
+		"CATEGORIES:vip,supplier\\, local\r\n" +
+		"END:VCARD\r\n"
+
+	card, err := NewDecoder(strings.NewReader(input)).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := card.Version(); got != Version3 {
+		t.Errorf("want %q; got %q", Version3, got)
+	}
+	if got := card.Get("n").Components(); !reflect.DeepEqual(got, []string{"Ili;c", "Veljko", "", "", ""}) {
+		t.Errorf("want the name components; got %q", got)
+	}
+
+	phones := card.All("TEL")
+	if len(phones) != 2 {
+		t.Fatalf("want 2 phones; got %d", len(phones))
+	}
+	if phones[0].Group != "item1" || !reflect.DeepEqual(phones[0].Types(), []string{"work", "voice", "pref"}) || !phones[0].Preferred() {
+		t.Errorf("want a preferred work phone in item1; got %+v", phones[0])
+	}
+	if !reflect.DeepEqual(phones[1].Types(), []string{"cell"}) || phones[1].Value != "063577442" {
+		t.Errorf("want a cell phone; got %+v", phones[1])
+	}
+
+	adr := card.Get("ADR")
+	if got := adr.Param("label"); !reflect.DeepEqual(got, []string{"Home; main: door"}) {
+		t.Errorf("want the quoted label; got %q", got)
+	}
+	if got := adr.Components()[2]; got != "Knez Mihailova 1" {
+		t.Errorf("want the street; got %q", got)
+	}
+
+	if got := card.Get("NOTE").Text(); got != "first line\nsecond, line" {
+		t.Errorf("want the unescaped note; got %q", got)
+	}
+	if got := card.Get("CATEGORIES").List(); !reflect.DeepEqual(got, []string{"vip", "supplier, local"}) {
+		t.Errorf("want the categories; got %q", got)
+	}
+}
+
+// Testing that the cards following a malformed one are still read
+func TestDecodeSyntaxErrors(t *testing.T) {
+	input := "BEGIN:VCARD\nVERSION:4.0\nFN:First\nEND:VCARD\n" +
+		"\n" +
+		"BEGIN:VCARD\nVERSION:4.0\nno value here\nFN:Broken\nEND:VCARD\n" +
+		"BEGIN:VCARD\nVERSION:4.0\nAGENT:\nBEGIN:VCARD\nFN:Nested\nEND:VCARD\nFN:Third\nEND:VCARD\n" +
+		"BEGIN:VCARD\nFN:Unfinished\n"
+
+	dec := NewDecoder(strings.NewReader(input))
+
+	testCases := []struct {
+		wantFN   string
+		wantLine int
+	}{
+		{"First", 1},
+		{"", 8},
+		{"Third", 11},
+		{"", 19},
+	}
+
+	for _, tc := range testCases {
+		card, err := dec.Decode()
+
+		var syntaxErr *SyntaxError
+		switch {
+		case tc.wantFN == "" && (!errors.As(err, &syntaxErr) || syntaxErr.Line != tc.wantLine):
+			t.Errorf("want a syntax error at line %d; got %v", tc.wantLine, err)
+		case tc.wantFN != "" && err != nil:
+			t.Errorf("want %s; got %v", tc.wantFN, err)
+		case tc.wantFN != "" && (card.Get("FN").Text() != tc.wantFN || card.Line != tc.wantLine):
+			t.Errorf("want %s at line %d; got %s at line %d", tc.wantFN, tc.wantLine, card.Get("FN").Text(), card.Line)
+		}
+	}
+
+	if _, err := dec.Decode(); err != io.EOF {
+		t.Errorf("want %v; got %v", io.EOF, err)
+	}
+}
+
+// Testing that written cards are folded and read back the same
+func TestEncode(t *testing.T) {
+	card := &Card{}
+	card.Add("VERSION", Version4, nil)
+	card.AddText("FN", "Veljko Ilić", nil)
+	card.AddText("NOTE", strings.Repeat("čćžšđ; ", 30), nil)
+	card.Add("TEL", "tel:+38163577442", map[string][]string{"VALUE": {"uri"}, "TYPE": {"work", "home, office"}})
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(card); err != nil {
+		t.Fatal(err)
+	}
+
+	for line := range strings.SplitSeq(strings.TrimSuffix(buf.String(), "\r\n"), "\r\n") {
+		if len(line) > maxLineBytes {
+			t.Errorf("want lines of at most %d bytes; got %d in %q", maxLineBytes, len(line), line)
+		}
+	}
+	if !strings.Contains(buf.String(), "TEL;TYPE=work,\"home, office\";VALUE=uri:tel:+38163577442\r\n") {
+		t.Errorf("want the parameters in order; got %q", buf.String())
+	}
+
+	got, err := NewDecoder(&buf).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Get("NOTE").Text() != card.Get("NOTE").Text() || got.Get("FN").Text() != "Veljko Ilić" {
+		t.Errorf("want %+v; got %+v", card, got)
+	}
+}